@@ -4,12 +4,19 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/app"
 	handler "github.com/yarikTri/dbms-term-proj/internal/app/delivery"
 	repo "github.com/yarikTri/dbms-term-proj/internal/app/repository"
 	usecase "github.com/yarikTri/dbms-term-proj/internal/app/usecase"
+	"github.com/yarikTri/dbms-term-proj/internal/idempotency"
+	"github.com/yarikTri/dbms-term-proj/internal/markdown"
+	"github.com/yarikTri/dbms-term-proj/internal/ratelimit"
+	"github.com/yarikTri/dbms-term-proj/internal/storage"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx"
 	"github.com/valyala/fasthttp"
@@ -25,6 +32,77 @@ func applicationJSONMiddleware(_ *mux.Router) mux.MiddlewareFunc {
 	}
 }
 
+// requestIDMiddleware keeps the request id the client sent or assigns a new
+// one, so that log and audit entries can be traced back to a response.
+func requestIDMiddleware(_ *mux.Router) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-Id")
+			if id == "" {
+				id = uuid.NewString()
+				r.Header.Set("X-Request-Id", id)
+			}
+
+			w.Header().Set("X-Request-Id", id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// reconcileOverlap takes every pass back before the start of the previous
+// one, so that the posts created before it but committed after it are
+// checked.
+const reconcileOverlap = time.Minute
+
+// runReconciliation checks the threads with posts created since the previous
+// pass. A failed pass leaves its posts to the next one.
+func runReconciliation(uc app.UseCase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	since := time.Now()
+	for range time.Tick(interval) {
+		started := time.Now()
+		fixed, err := uc.ReconcileThreadCounters(since.Add(-reconcileOverlap))
+		if err != nil {
+			log.Printf("reconcile thread counters: %s", err.Error())
+			continue
+		}
+		since = started
+
+		if fixed > 0 {
+			log.Printf("reconcile thread counters: repaired %d threads", fixed)
+		}
+	}
+}
+
+func runHotRefresh(uc app.UseCase, interval, window time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	for range time.Tick(interval) {
+		if _, err := uc.RefreshThreadHot(window); err != nil {
+			log.Printf("refresh hot threads: %s", err.Error())
+		}
+	}
+}
+
+func runAttachmentCleanup(uc app.UseCase, interval time.Duration) {
+	for range time.Tick(interval) {
+		removed, err := uc.CleanupAttachments()
+		if err != nil {
+			log.Printf("cleanup attachments: %s", err.Error())
+			continue
+		}
+
+		if removed > 0 {
+			log.Printf("cleanup attachments: removed %d orphaned files", removed)
+		}
+	}
+}
+
 func main() {
 	router := mux.NewRouter()
 
@@ -54,10 +132,56 @@ func main() {
 	}
 
 	repo := repo.NewPostgresAppRepository(pool)
-	usecase := usecase.NewAppUseCase(repo)
-	handler.NewAppHandler(router, usecase)
+	storage, err := storage.NewLocalStorage(configs.StorageConfig.Root)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	usecase := usecase.NewAppUseCase(repo, storage)
+	renderer := markdown.NewRenderer(configs.MarkdownConfig.CacheSize)
+	handler.NewAppHandler(router, usecase, renderer)
+
+	go runReconciliation(usecase, configs.JobsConfig.ReconcileInterval)
+	go runHotRefresh(usecase, configs.JobsConfig.HotInterval, configs.JobsConfig.HotWindow)
+	go runAttachmentCleanup(usecase, configs.StorageConfig.CleanupInterval)
 
 	router.Use(applicationJSONMiddleware(router))
+	router.Use(requestIDMiddleware(router))
+
+	if configs.RateLimitConfig.Enabled {
+		var limiter ratelimit.Store
+		switch configs.RateLimitConfig.Store {
+		case "postgres":
+			limiter = ratelimit.NewPostgresStore(pool)
+		default:
+			limiter = ratelimit.NewMemoryStore()
+		}
+
+		router.Use(ratelimit.Middleware(limiter, configs.RateLimitConfig.Groups, configs.RateLimitConfig.TrustForwardedFor))
+	}
+
+	if configs.IdempotencyConfig.Enabled {
+		var keys idempotency.Store
+		switch configs.IdempotencyConfig.Store {
+		case "postgres":
+			keys = idempotency.NewPostgresStore(pool)
+		default:
+			keys = idempotency.NewMemoryStore(configs.IdempotencyConfig.MemoryMaxBytes)
+		}
+
+		router.Use(idempotency.Middleware(keys, configs.IdempotencyConfig.TTL, configs.IdempotencyConfig.Routes))
+	}
+
+	// Inside the idempotency middleware, which then sees the redirects to
+	// renamed resources rather than the 404 turned into them.
+	router.Use(handler.RenameRedirectMiddleware(usecase))
+
+	server := fasthttp.Server{
+		Handler: fasthttpadaptor.NewFastHTTPHandler(router),
+		// Uploads of the maximum size come with the multipart framing around
+		// them, the handler allows the same margin.
+		MaxRequestBodySize: int(configs.StorageConfig.MaxSize + 1<<20),
+	}
 
-	log.Fatal(fasthttp.ListenAndServe(":5000", fasthttpadaptor.NewFastHTTPHandler(router)))
+	log.Fatal(server.ListenAndServe(":5000"))
 }
@@ -0,0 +1,13 @@
+package configs
+
+type adminConfig struct {
+	Nicknames []string
+}
+
+var AdminConfig adminConfig
+
+func init() {
+	AdminConfig = adminConfig{
+		Nicknames: []string{},
+	}
+}
@@ -0,0 +1,13 @@
+package configs
+
+type conversationConfig struct {
+	MaxMembers int
+}
+
+var ConversationConfig conversationConfig
+
+func init() {
+	ConversationConfig = conversationConfig{
+		MaxMembers: 10,
+	}
+}
@@ -0,0 +1,36 @@
+package configs
+
+import "time"
+
+type idempotencyConfig struct {
+	Enabled bool
+	// Store is "memory" for a single instance or "postgres" to share the keys
+	// between instances.
+	Store string
+	// MemoryMaxBytes bounds what the memory store keeps, the oldest keys are
+	// forgotten first when it is full.
+	MemoryMaxBytes int64
+	// TTL is how long a key is kept and its response replayed.
+	TTL time.Duration
+	// Routes are the path templates of the create endpoints taking keys.
+	Routes []string
+}
+
+var IdempotencyConfig idempotencyConfig
+
+func init() {
+	IdempotencyConfig = idempotencyConfig{
+		Enabled:        true,
+		Store:          "memory",
+		MemoryMaxBytes: 64 << 20,
+		TTL:            24 * time.Hour,
+		Routes: []string{
+			"/api/user/{nickname}/create",
+			"/api/forum/create",
+			"/api/forum/{slug}/create",
+			"/api/forum/{slug}/create-with-posts",
+			"/api/thread/{slug_or_id}/create",
+			"/api/thread/{slug_or_id}/vote",
+		},
+	}
+}
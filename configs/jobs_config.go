@@ -0,0 +1,24 @@
+package configs
+
+import "time"
+
+type jobsConfig struct {
+	// ReconcileInterval is how often the thread counters are checked against
+	// the posts created since the previous check, 0 turns the job off. One
+	// instance running it is enough.
+	ReconcileInterval time.Duration
+	// HotInterval is how often the hot ranking of the threads created within
+	// HotWindow is rescored, 0 turns the job off.
+	HotInterval time.Duration
+	HotWindow   time.Duration
+}
+
+var JobsConfig jobsConfig
+
+func init() {
+	JobsConfig = jobsConfig{
+		ReconcileInterval: 10 * time.Minute,
+		HotInterval:       5 * time.Minute,
+		HotWindow:         7 * 24 * time.Hour,
+	}
+}
@@ -0,0 +1,13 @@
+package configs
+
+type markdownConfig struct {
+	CacheSize int
+}
+
+var MarkdownConfig markdownConfig
+
+func init() {
+	MarkdownConfig = markdownConfig{
+		CacheSize: 10000,
+	}
+}
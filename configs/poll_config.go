@@ -0,0 +1,15 @@
+package configs
+
+type pollConfig struct {
+	MinOptions int
+	MaxOptions int
+}
+
+var PollConfig pollConfig
+
+func init() {
+	PollConfig = pollConfig{
+		MinOptions: 2,
+		MaxOptions: 20,
+	}
+}
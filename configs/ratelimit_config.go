@@ -0,0 +1,83 @@
+package configs
+
+import (
+	"net/http"
+
+	"github.com/yarikTri/dbms-term-proj/internal/ratelimit"
+)
+
+type rateLimitConfig struct {
+	Enabled bool
+	// Store is "memory" for a single instance or "postgres" to share the
+	// limits between instances.
+	Store             string
+	TrustForwardedFor bool
+	// Groups are matched in order, the first matching one applies.
+	Groups []ratelimit.Group
+}
+
+var RateLimitConfig rateLimitConfig
+
+// The flood limits of threads and posts, shared by the routes creating them.
+var (
+	postsPerIP     = ratelimit.Limit{Rate: 20, Burst: 200}
+	postsPerUser   = ratelimit.Limit{Rate: 2, Burst: 20}
+	threadsPerIP   = ratelimit.Limit{Rate: 2, Burst: 20}
+	threadsPerUser = ratelimit.Limit{Rate: 0.2, Burst: 5}
+)
+
+func init() {
+	RateLimitConfig = rateLimitConfig{
+		Enabled:           true,
+		Store:             "memory",
+		TrustForwardedFor: false,
+		Groups: []ratelimit.Group{
+			{
+				Name:   "service",
+				Prefix: "/api/service/",
+			},
+			// Posts and threads cost a token per object in the body, against
+			// the authors named there.
+			{
+				Name:    "posts",
+				Methods: []string{http.MethodPost},
+				Routes:  []string{"/api/thread/{slug_or_id}/create"},
+				PerIP:   postsPerIP,
+				PerUser: postsPerUser,
+				Charge:  ratelimit.BodyAuthors(""),
+			},
+			{
+				Name:    "threads",
+				Methods: []string{http.MethodPost},
+				Routes:  []string{"/api/forum/{slug}/create"},
+				PerIP:   threadsPerIP,
+				PerUser: threadsPerUser,
+				Charge:  ratelimit.BodyAuthors(""),
+			},
+			// A thread created with its posts counts as both.
+			{
+				Name:     "posts",
+				Methods:  []string{http.MethodPost},
+				Routes:   []string{"/api/forum/{slug}/create-with-posts"},
+				PerIP:    postsPerIP,
+				PerUser:  postsPerUser,
+				Charge:   ratelimit.BodyAuthors("posts"),
+				Continue: true,
+			},
+			{
+				Name:    "threads",
+				Methods: []string{http.MethodPost},
+				Routes:  []string{"/api/forum/{slug}/create-with-posts"},
+				PerIP:   threadsPerIP,
+				PerUser: threadsPerUser,
+				Charge:  ratelimit.BodyAuthors("thread"),
+			},
+			{
+				Name:    "writes",
+				Methods: []string{http.MethodPost, http.MethodPut, http.MethodDelete},
+				PerIP:   ratelimit.Limit{Rate: 50, Burst: 500},
+				PerUser: ratelimit.Limit{Rate: 10, Burst: 100},
+			},
+		},
+	}
+}
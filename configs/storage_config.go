@@ -0,0 +1,33 @@
+package configs
+
+import "time"
+
+type storageConfig struct {
+	Root          string
+	MaxSize       int64
+	AllowedTypes  []string
+	ThumbnailSize int
+	// ThumbnailMaxPixels bounds the dimensions of images decoded for
+	// thumbnails, larger ones are stored without a thumbnail.
+	ThumbnailMaxPixels int
+	CleanupInterval    time.Duration
+}
+
+var StorageConfig storageConfig
+
+func init() {
+	StorageConfig = storageConfig{
+		Root:    "./attachments",
+		MaxSize: 10 << 20,
+		AllowedTypes: []string{
+			"image/png",
+			"image/jpeg",
+			"image/gif",
+			"application/pdf",
+			"text/plain",
+		},
+		ThumbnailSize:      256,
+		ThumbnailMaxPixels: 4096 * 4096,
+		CleanupInterval:    time.Hour,
+	}
+}
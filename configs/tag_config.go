@@ -0,0 +1,15 @@
+package configs
+
+type tagConfig struct {
+	MaxTags   int
+	MaxLength int
+}
+
+var TagConfig tagConfig
+
+func init() {
+	TagConfig = tagConfig{
+		MaxTags:   10,
+		MaxLength: 32,
+	}
+}
@@ -4,7 +4,21 @@ CREATE UNLOGGED TABLE users (
     nickname CITEXT PRIMARY KEY,
     fullname TEXT NOT NULL,
     about TEXT,
-    email CITEXT UNIQUE
+    email CITEXT UNIQUE,
+    -- version is bumped by every update of a row, see bump_version.
+    version INT NOT NULL DEFAULT 1
+);
+
+-- posts and threads of a category are rolled up from the forums below it.
+CREATE UNLOGGED TABLE category (
+    id       SERIAL PRIMARY KEY,
+    title    TEXT   NOT NULL,
+    parent   INT,
+    position INT    NOT NULL DEFAULT 0,
+    posts    BIGINT NOT NULL DEFAULT 0,
+    threads  BIGINT NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (parent) REFERENCES "category" (id)
 );
 
 CREATE UNLOGGED TABLE forum (
@@ -13,8 +27,21 @@ CREATE UNLOGGED TABLE forum (
     "user"  CITEXT,
     posts   BIGINT DEFAULT 0,
     threads BIGINT DEFAULT 0,
-
-    FOREIGN KEY ("user") REFERENCES "users" (nickname)
+    visibility TEXT NOT NULL DEFAULT 'public',
+    archived   BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Threads of Q&A forums are questions that may get an accepted answer.
+    qa         BOOLEAN NOT NULL DEFAULT FALSE,
+    parent     CITEXT,
+    category   INT,
+    position   INT     NOT NULL DEFAULT 0,
+    -- Own posts and threads plus those of the sub-forums.
+    total_posts   BIGINT NOT NULL DEFAULT 0,
+    total_threads BIGINT NOT NULL DEFAULT 0,
+    version       INT    NOT NULL DEFAULT 1,
+
+    FOREIGN KEY ("user") REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (parent) REFERENCES "forum" (slug) ON DELETE SET NULL ON UPDATE CASCADE,
+    FOREIGN KEY (category) REFERENCES "category" (id)
 );
 
 CREATE UNLOGGED TABLE thread (
@@ -26,9 +53,19 @@ CREATE UNLOGGED TABLE thread (
     slug    CITEXT UNIQUE,
     title   TEXT NOT NULL,
     votes   INT                      DEFAULT 0,
-
-    FOREIGN KEY (author) REFERENCES "users" (nickname),
-    FOREIGN KEY (forum)  REFERENCES "forum" (slug)
+    posts   INT                      DEFAULT 0,
+    last_post_at TIMESTAMP WITH TIME ZONE,
+    last_post_author CITEXT,
+    locked  BOOLEAN                  DEFAULT FALSE,
+    hot     DOUBLE PRECISION         DEFAULT 0,
+    shadow  BOOLEAN                  DEFAULT FALSE,
+    answer  BIGINT,
+    -- slug_generated marks slugs made from the title when none was given.
+    slug_generated BOOLEAN           DEFAULT FALSE,
+    version INT                      NOT NULL DEFAULT 1,
+
+    FOREIGN KEY (author) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (forum)  REFERENCES "forum" (slug) ON UPDATE CASCADE
 );
 
 CREATE UNLOGGED TABLE post (
@@ -41,20 +78,26 @@ CREATE UNLOGGED TABLE post (
     parent   BIGINT                   DEFAULT 0,
     thread   INT,
     Path     BIGINT[]                 DEFAULT ARRAY []::INTEGER[],
+    children INT                      DEFAULT 0,
+    hidden   BOOLEAN                  DEFAULT FALSE,
+    shadow   BOOLEAN                  DEFAULT FALSE,
+    version  INT                      NOT NULL DEFAULT 1,
 
-    FOREIGN KEY (author) REFERENCES "users"  (nickname),
-    FOREIGN KEY (forum)  REFERENCES "forum"  (slug),
+    FOREIGN KEY (author) REFERENCES "users"  (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (forum)  REFERENCES "forum"  (slug) ON UPDATE CASCADE,
     FOREIGN KEY (thread) REFERENCES "thread" (id),
     FOREIGN KEY (parent) REFERENCES "post"   (id)
 );
 
+ALTER TABLE thread ADD FOREIGN KEY (answer) REFERENCES "post" (id) ON DELETE SET NULL;
+
 CREATE UNLOGGED TABLE votes
 (
     nickname  citext,
     voice     INT,
     thread_id INT,
 
-    FOREIGN KEY (nickname) REFERENCES "users" (nickname),
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
     FOREIGN KEY (thread_id) REFERENCES "thread" (id),
     UNIQUE (nickname, thread_id)
 );
@@ -67,11 +110,350 @@ CREATE UNLOGGED TABLE users_forum
     email    CITEXT,
     slug     citext NOT NULL,
 
-    FOREIGN KEY (nickname) REFERENCES "users" (nickname),
-    FOREIGN KEY (slug) REFERENCES "forum" (slug),
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (slug) REFERENCES "forum" (slug) ON UPDATE CASCADE,
     UNIQUE (nickname, slug)
 );
 
+-- forum is copied from the thread for the tag directory of the forum.
+CREATE UNLOGGED TABLE thread_tag
+(
+    thread INT    NOT NULL,
+    forum  CITEXT NOT NULL,
+    tag    CITEXT NOT NULL,
+
+    FOREIGN KEY (thread) REFERENCES "thread" (id),
+    PRIMARY KEY (thread, tag)
+);
+
+CREATE UNLOGGED TABLE poll
+(
+    id         SERIAL PRIMARY KEY,
+    thread     INT     NOT NULL UNIQUE,
+    question   TEXT    NOT NULL,
+    multiple   BOOLEAN NOT NULL DEFAULT FALSE,
+    anonymous  BOOLEAN NOT NULL DEFAULT FALSE,
+    closes     TIMESTAMP WITH TIME ZONE,
+    created_by CITEXT  NOT NULL,
+    created    TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    voters     INT     NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (thread) REFERENCES "thread" (id),
+    FOREIGN KEY (created_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE poll_option
+(
+    id       SERIAL PRIMARY KEY,
+    poll     INT  NOT NULL,
+    position INT  NOT NULL,
+    title    TEXT NOT NULL,
+    votes    INT  NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (poll) REFERENCES "poll" (id)
+);
+
+CREATE UNLOGGED TABLE poll_vote
+(
+    poll     INT    NOT NULL,
+    option   INT    NOT NULL,
+    nickname CITEXT NOT NULL,
+    created  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (poll) REFERENCES "poll" (id),
+    FOREIGN KEY (option) REFERENCES "poll_option" (id),
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    PRIMARY KEY (poll, nickname, option)
+);
+
+CREATE UNLOGGED TABLE thread_read
+(
+    nickname  CITEXT NOT NULL,
+    thread_id INT    NOT NULL,
+    post_id   BIGINT NOT NULL DEFAULT 0,
+    seen      INT    NOT NULL DEFAULT 0,
+    updated   TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES "thread" (id),
+    PRIMARY KEY (nickname, thread_id)
+);
+
+CREATE UNLOGGED TABLE attachment
+(
+    id            BIGSERIAL PRIMARY KEY,
+    post          BIGINT,
+    name          TEXT   NOT NULL,
+    content_type  TEXT   NOT NULL,
+    size          BIGINT NOT NULL,
+    storage_key   TEXT   NOT NULL,
+    thumbnail_key TEXT,
+    created       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (post) REFERENCES "post" (id) ON DELETE SET NULL
+);
+
+CREATE UNLOGGED TABLE forum_moderator
+(
+    forum    CITEXT NOT NULL,
+    nickname CITEXT NOT NULL,
+
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    PRIMARY KEY (forum, nickname)
+);
+
+CREATE UNLOGGED TABLE report
+(
+    id          SERIAL PRIMARY KEY,
+    reporter    CITEXT NOT NULL,
+    forum       CITEXT NOT NULL,
+    thread      INT    NOT NULL,
+    post        BIGINT,
+    reason      TEXT   NOT NULL,
+    comment     TEXT   NOT NULL DEFAULT '',
+    status      TEXT   NOT NULL DEFAULT 'open',
+    created     TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    resolved_by CITEXT,
+    resolved    TIMESTAMP WITH TIME ZONE,
+    action      TEXT,
+
+    FOREIGN KEY (reporter) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (thread) REFERENCES "thread" (id),
+    FOREIGN KEY (post) REFERENCES "post" (id),
+    FOREIGN KEY (resolved_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE moderation_log
+(
+    id        SERIAL PRIMARY KEY,
+    report    INT,
+    forum     CITEXT NOT NULL,
+    moderator CITEXT NOT NULL,
+    action    TEXT   NOT NULL,
+    target    TEXT   NOT NULL,
+    comment   TEXT   NOT NULL DEFAULT '',
+    created   TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (report) REFERENCES "report" (id),
+    FOREIGN KEY (moderator) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+-- Members of a forum, its owner and moderators included.
+CREATE UNLOGGED TABLE forum_member
+(
+    forum    CITEXT NOT NULL,
+    nickname CITEXT NOT NULL,
+    role     TEXT   NOT NULL DEFAULT 'member',
+    joined   TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    PRIMARY KEY (forum, nickname)
+);
+
+CREATE UNLOGGED TABLE join_request
+(
+    id         SERIAL PRIMARY KEY,
+    forum      CITEXT NOT NULL,
+    nickname   CITEXT NOT NULL,
+    message    TEXT   NOT NULL DEFAULT '',
+    status     TEXT   NOT NULL DEFAULT 'pending',
+    created    TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    decided_by CITEXT,
+    decided    TIMESTAMP WITH TIME ZONE,
+
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (decided_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE invitation
+(
+    token      TEXT PRIMARY KEY,
+    forum      CITEXT NOT NULL,
+    nickname   CITEXT,
+    created_by CITEXT NOT NULL,
+    expires    TIMESTAMP WITH TIME ZONE,
+    max_uses   INT    NOT NULL DEFAULT 0,
+    uses       INT    NOT NULL DEFAULT 0,
+    created    TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE conversation
+(
+    id              SERIAL PRIMARY KEY,
+    title           TEXT    NOT NULL DEFAULT '',
+    direct          BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by      CITEXT  NOT NULL,
+    created         TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_message_at TIMESTAMP WITH TIME ZONE,
+    messages        INT     NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (created_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+-- seen is the number of messages up to last_read, see thread_read.
+CREATE UNLOGGED TABLE conversation_member
+(
+    conversation INT    NOT NULL,
+    nickname     CITEXT NOT NULL,
+    last_read    BIGINT NOT NULL DEFAULT 0,
+    seen         INT    NOT NULL DEFAULT 0,
+    joined       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (conversation) REFERENCES "conversation" (id),
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    PRIMARY KEY (conversation, nickname)
+);
+
+CREATE UNLOGGED TABLE conversation_message
+(
+    id           BIGSERIAL PRIMARY KEY,
+    conversation INT     NOT NULL,
+    author       CITEXT  NOT NULL,
+    message      TEXT    NOT NULL,
+    created      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    isEdited     BOOLEAN NOT NULL DEFAULT FALSE,
+
+    FOREIGN KEY (conversation) REFERENCES "conversation" (id),
+    FOREIGN KEY (author) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE user_block
+(
+    blocker CITEXT NOT NULL,
+    blocked CITEXT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (blocker) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (blocked) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    PRIMARY KEY (blocker, blocked)
+);
+
+CREATE UNLOGGED TABLE user_mute
+(
+    muter   CITEXT NOT NULL,
+    muted   CITEXT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (muter) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (muted) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    PRIMARY KEY (muter, muted)
+);
+
+CREATE UNLOGGED TABLE ban
+(
+    id         SERIAL PRIMARY KEY,
+    nickname   CITEXT NOT NULL,
+    forum      CITEXT,
+    reason     TEXT   NOT NULL DEFAULT '',
+    expires    TIMESTAMP WITH TIME ZONE,
+    shadow     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by CITEXT NOT NULL,
+    created    TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (nickname) REFERENCES "users" (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE filter_rule
+(
+    id             SERIAL PRIMARY KEY,
+    forum          CITEXT,
+    kind           TEXT    NOT NULL,
+    action         TEXT    NOT NULL DEFAULT 'reject',
+    words          TEXT    NOT NULL DEFAULT '',
+    pattern        TEXT    NOT NULL DEFAULT '',
+    replacement    TEXT    NOT NULL DEFAULT '',
+    max_links      INT     NOT NULL DEFAULT 0,
+    new_user_posts INT     NOT NULL DEFAULT 0,
+    window_seconds INT     NOT NULL DEFAULT 0,
+    dry_run        BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by     CITEXT  NOT NULL,
+    created        TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (forum) REFERENCES "forum" (slug) ON UPDATE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES "users" (nickname) ON UPDATE CASCADE
+);
+
+CREATE UNLOGGED TABLE filter_hit
+(
+    id      SERIAL PRIMARY KEY,
+    rule    INT     NOT NULL,
+    forum   CITEXT  NOT NULL,
+    author  CITEXT  NOT NULL,
+    action  TEXT    NOT NULL,
+    dry_run BOOLEAN NOT NULL,
+    excerpt TEXT    NOT NULL,
+    created TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    FOREIGN KEY (rule) REFERENCES "filter_rule" (id) ON DELETE CASCADE
+);
+
+-- Earlier forum slugs, thread slugs and nicknames with the name each one
+-- was renamed to, so that requests by an old name can be redirected.
+CREATE UNLOGGED TABLE rename_history
+(
+    kind    TEXT   NOT NULL,
+    old     CITEXT NOT NULL,
+    name    CITEXT NOT NULL,
+    renamed TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (kind, old)
+);
+
+-- Append-only: the audit log survives /api/service/clear and rejects changes.
+-- Unlike the rest it is logged, so that it survives a crash as well.
+CREATE TABLE audit_log
+(
+    id          BIGSERIAL PRIMARY KEY,
+    actor       CITEXT NOT NULL DEFAULT '',
+    action      TEXT   NOT NULL,
+    target_type TEXT   NOT NULL,
+    target_id   TEXT   NOT NULL,
+    before      JSONB,
+    after       JSONB,
+    request_id  TEXT   NOT NULL DEFAULT '',
+    created     TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Token buckets of the PostgreSQL rate limit store.
+CREATE UNLOGGED TABLE rate_limit
+(
+    key     TEXT PRIMARY KEY,
+    tokens  DOUBLE PRECISION         NOT NULL,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    allowed BOOLEAN                  NOT NULL DEFAULT TRUE
+);
+
+-- Keys of the PostgreSQL idempotency store. status and body stay NULL until
+-- the first request with the key is answered.
+CREATE UNLOGGED TABLE idempotency_key
+(
+    key     TEXT PRIMARY KEY,
+    hash    TEXT                     NOT NULL,
+    status  INT,
+    header  JSONB,
+    body    BYTEA,
+    expires TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION reject_audit_change() RETURNS TRIGGER AS
+$reject_audit_change$
+BEGIN
+    RAISE EXCEPTION 'audit log is append-only';
+end
+$reject_audit_change$
+LANGUAGE plpgsql;
+
+
 CREATE OR REPLACE FUNCTION update_user_forum() RETURNS TRIGGER AS
 $update_users_forum$
 DECLARE
@@ -79,6 +461,9 @@ DECLARE
     m_about    CITEXT;
     m_email CITEXT;
 BEGIN
+    IF NEW.shadow THEN
+        return NEW;
+    END IF;
     SELECT fullname, about, email FROM users WHERE nickname = NEW.author INTO m_fullname, m_about, m_email;
     INSERT INTO users_forum (nickname, fullname, about, email, slug)
     VALUES (NEW.author, m_fullname, m_about, m_email, NEW.forum) on conflict do nothing;
@@ -113,7 +498,9 @@ LANGUAGE plpgsql;
 CREATE OR REPLACE FUNCTION update_count_of_threads() RETURNS TRIGGER AS
 $update_users_forum$
 BEGIN
-    UPDATE forum SET threads = threads + 1 WHERE slug=NEW.forum;
+    IF NOT NEW.shadow THEN
+        UPDATE forum SET threads = threads + 1 WHERE slug=NEW.forum;
+    END IF;
     return NEW;
 end
 $update_users_forum$
@@ -136,19 +523,183 @@ BEGIN
         end if;
 
         NEW.path := NEW.path || parentPath || new.id;
+        UPDATE post SET children = children + 1 WHERE id = new.parent;
     end if;
-    UPDATE forum SET posts = posts + 1 WHERE forum.slug = new.forum;
+    IF NOT NEW.shadow THEN
+        UPDATE forum SET posts = posts + 1 WHERE forum.slug = new.forum;
+    END IF;
     RETURN new;
 end
 $update_path$
 LANGUAGE plpgsql;
 
 
+-- Hacker News-like ranking: the thread score divided by a power of its age in
+-- hours, so threads sink as they get older. The value is taken at the given
+-- time: writes to a thread score it at once and the hot job rescores recent
+-- threads on a schedule, as the ranking changes without any write.
+CREATE OR REPLACE FUNCTION thread_hot(votes INT, posts INT, created TIMESTAMP WITH TIME ZONE, at TIMESTAMP WITH TIME ZONE) RETURNS DOUBLE PRECISION AS
+$thread_hot$
+    SELECT (votes + posts)::DOUBLE PRECISION
+        / power(greatest(extract(EPOCH FROM at - created)::DOUBLE PRECISION / 3600, 0) + 2, 1.8);
+$thread_hot$
+LANGUAGE sql IMMUTABLE;
+
+
+CREATE OR REPLACE FUNCTION update_thread_hot() RETURNS TRIGGER AS
+$update_thread_hot$
+BEGIN
+    NEW.hot := thread_hot(NEW.votes, NEW.posts, NEW.created, NOW());
+    return NEW;
+end
+$update_thread_hot$
+LANGUAGE plpgsql;
+
+
+-- Keeps the totals of the forum in step with its own counters.
+CREATE OR REPLACE FUNCTION update_forum_own_totals() RETURNS TRIGGER AS
+$update_forum_own_totals$
+BEGIN
+    NEW.total_posts := NEW.total_posts + NEW.posts - OLD.posts;
+    NEW.total_threads := NEW.total_threads + NEW.threads - OLD.threads;
+    return NEW;
+end
+$update_forum_own_totals$
+LANGUAGE plpgsql;
+
+
+-- Adds the counts to the parent forum or, for top forums, to the category.
+CREATE OR REPLACE FUNCTION roll_up_forum(m_parent CITEXT, m_category INT, m_posts BIGINT, m_threads BIGINT) RETURNS VOID AS
+$roll_up_forum$
+BEGIN
+    IF m_posts = 0 AND m_threads = 0 THEN
+        RETURN;
+    END IF;
+    IF m_parent IS NOT NULL THEN
+        UPDATE forum SET total_posts = total_posts + m_posts, total_threads = total_threads + m_threads
+        WHERE slug = m_parent;
+    ELSIF m_category IS NOT NULL THEN
+        UPDATE category SET posts = posts + m_posts, threads = threads + m_threads WHERE id = m_category;
+    END IF;
+end
+$roll_up_forum$
+LANGUAGE plpgsql;
+
+
+CREATE OR REPLACE FUNCTION roll_up_category(m_parent INT, m_posts BIGINT, m_threads BIGINT) RETURNS VOID AS
+$roll_up_category$
+BEGIN
+    IF m_parent IS NOT NULL AND (m_posts <> 0 OR m_threads <> 0) THEN
+        UPDATE category SET posts = posts + m_posts, threads = threads + m_threads WHERE id = m_parent;
+    END IF;
+end
+$roll_up_category$
+LANGUAGE plpgsql;
+
+
+-- Moves the totals along when a forum changes its place and takes them away
+-- when it is deleted.
+CREATE OR REPLACE FUNCTION update_forum_totals() RETURNS TRIGGER AS
+$update_forum_totals$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM roll_up_forum(OLD.parent, OLD.category, -OLD.total_posts, -OLD.total_threads);
+        return OLD;
+    END IF;
+    -- A renamed parent passes its new slug down and the sub-forum stays put.
+    IF OLD.parent IS NOT NULL AND NEW.parent IS NOT NULL
+        AND NOT EXISTS(SELECT 1 FROM forum WHERE slug = OLD.parent) THEN
+        return NEW;
+    END IF;
+    IF OLD.parent IS DISTINCT FROM NEW.parent OR OLD.category IS DISTINCT FROM NEW.category THEN
+        PERFORM roll_up_forum(OLD.parent, OLD.category, -OLD.total_posts, -OLD.total_threads);
+        PERFORM roll_up_forum(NEW.parent, NEW.category, NEW.total_posts, NEW.total_threads);
+    ELSE
+        PERFORM roll_up_forum(NEW.parent, NEW.category,
+                              NEW.total_posts - OLD.total_posts, NEW.total_threads - OLD.total_threads);
+    END IF;
+    return NEW;
+end
+$update_forum_totals$
+LANGUAGE plpgsql;
+
+
+CREATE OR REPLACE FUNCTION update_category_totals() RETURNS TRIGGER AS
+$update_category_totals$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM roll_up_category(OLD.parent, -OLD.posts, -OLD.threads);
+        return OLD;
+    END IF;
+    IF OLD.parent IS DISTINCT FROM NEW.parent THEN
+        PERFORM roll_up_category(OLD.parent, -OLD.posts, -OLD.threads);
+        PERFORM roll_up_category(NEW.parent, NEW.posts, NEW.threads);
+    ELSE
+        PERFORM roll_up_category(NEW.parent, NEW.posts - OLD.posts, NEW.threads - OLD.threads);
+    END IF;
+    return NEW;
+end
+$update_category_totals$
+LANGUAGE plpgsql;
+
+
+-- Every change makes a new version of the row, which the detail endpoints
+-- serve as the ETag. Counters count as changes, as they are shown too.
+CREATE OR REPLACE FUNCTION bump_version() RETURNS TRIGGER AS
+$bump_version$
+BEGIN
+    NEW.version := OLD.version + 1;
+    return NEW;
+end
+$bump_version$
+LANGUAGE plpgsql;
+
+
+CREATE TRIGGER users_version_trigger
+    BEFORE UPDATE
+    ON users
+    FOR EACH ROW EXECUTE PROCEDURE bump_version();
+
+CREATE TRIGGER forum_version_trigger
+    BEFORE UPDATE
+    ON forum
+    FOR EACH ROW EXECUTE PROCEDURE bump_version();
+
+CREATE TRIGGER thread_version_trigger
+    BEFORE UPDATE
+    ON thread
+    FOR EACH ROW EXECUTE PROCEDURE bump_version();
+
+CREATE TRIGGER post_version_trigger
+    BEFORE UPDATE
+    ON post
+    FOR EACH ROW EXECUTE PROCEDURE bump_version();
+
+CREATE TRIGGER forum_own_totals_trigger
+    BEFORE UPDATE OF posts, threads
+    ON forum
+    FOR EACH ROW EXECUTE PROCEDURE update_forum_own_totals();
+
+CREATE TRIGGER forum_totals_trigger
+    AFTER UPDATE OR DELETE
+    ON forum
+    FOR EACH ROW EXECUTE PROCEDURE update_forum_totals();
+
+CREATE TRIGGER category_totals_trigger
+    AFTER UPDATE OR DELETE
+    ON category
+    FOR EACH ROW EXECUTE PROCEDURE update_category_totals();
+
 CREATE TRIGGER add_thread_in_forum
     BEFORE INSERT
     ON thread
     FOR EACH ROW EXECUTE PROCEDURE update_count_of_threads();
 
+CREATE TRIGGER thread_hot_trigger
+    BEFORE INSERT OR UPDATE OF votes, posts, created
+    ON thread
+    FOR EACH ROW EXECUTE PROCEDURE update_thread_hot();
+
 CREATE TRIGGER add_voice
     BEFORE INSERT
     ON votes
@@ -159,6 +710,16 @@ CREATE TRIGGER edit_voice
     ON votes
     FOR EACH ROW EXECUTE PROCEDURE update_votes();
 
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE reject_audit_change();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE reject_audit_change();
+
 CREATE TRIGGER update_path_trigger
     BEFORE INSERT
     ON post
@@ -186,12 +747,42 @@ CREATE INDEX IF NOT EXISTS user_email     ON users  USING HASH (email);
 CREATE INDEX IF NOT EXISTS forum_slug     ON forum  USING HASH (slug);
 CREATE INDEX IF NOT EXISTS thr_slug       ON thread USING HASH (slug);
 CREATE INDEX IF NOT EXISTS thr_forum      ON thread USING HASH (forum);
+CREATE INDEX IF NOT EXISTS poll_option_poll ON poll_option (poll, position);
+CREATE INDEX IF NOT EXISTS poll_vote_option ON poll_vote (option, nickname);
+CREATE INDEX IF NOT EXISTS thread_tag_forum ON thread_tag (forum, tag);
+CREATE INDEX IF NOT EXISTS thread_tag_tag   ON thread_tag (tag, thread);
+CREATE INDEX IF NOT EXISTS forum_parent   ON forum (parent, position);
+CREATE INDEX IF NOT EXISTS forum_category ON forum (category, position);
+CREATE INDEX IF NOT EXISTS category_parent ON category (parent, position);
 CREATE INDEX IF NOT EXISTS thr_date       ON thread (created);
 CREATE INDEX IF NOT EXISTS thr_forum_date ON thread (forum, created);
+CREATE INDEX IF NOT EXISTS thr_author_date ON thread (author, created);
+CREATE INDEX IF NOT EXISTS thr_forum_votes    ON thread (forum, votes, id);
+CREATE INDEX IF NOT EXISTS thr_forum_posts    ON thread (forum, posts, id);
+CREATE INDEX IF NOT EXISTS thr_forum_activity ON thread (forum, (COALESCE(last_post_at, created)), id);
+CREATE INDEX IF NOT EXISTS thr_forum_hot      ON thread (forum, hot, id);
+CREATE INDEX IF NOT EXISTS thr_hot            ON thread (hot, id);
 CREATE INDEX IF NOT EXISTS post_id_path   ON post   (id, (path[1]));
 CREATE INDEX IF NOT EXISTS post_path1     ON post   ((path[1]));
 CREATE INDEX IF NOT EXISTS post_thread_id ON post   (thread, id);
 CREATE INDEX IF NOT EXISTS post_thread    ON post   (thread);
+CREATE INDEX IF NOT EXISTS post_author_date ON post (author, created, id);
+CREATE INDEX IF NOT EXISTS post_parent      ON post (parent);
+CREATE INDEX IF NOT EXISTS post_created     ON post (created);
+CREATE INDEX IF NOT EXISTS attachment_post  ON attachment (post);
+CREATE INDEX IF NOT EXISTS report_forum_status ON report (forum, status, id);
+CREATE INDEX IF NOT EXISTS moderation_log_forum ON moderation_log (forum, id);
+CREATE INDEX IF NOT EXISTS ban_nickname_forum   ON ban (nickname, forum);
+CREATE INDEX IF NOT EXISTS forum_member_nickname ON forum_member (nickname, forum);
+CREATE UNIQUE INDEX IF NOT EXISTS join_request_pending ON join_request (forum, nickname) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS join_request_forum_status ON join_request (forum, status, id);
+CREATE INDEX IF NOT EXISTS conversation_member_nickname ON conversation_member (nickname, conversation);
+CREATE INDEX IF NOT EXISTS conversation_message_conversation ON conversation_message (conversation, id);
+CREATE INDEX IF NOT EXISTS user_block_blocked ON user_block (blocked, blocker);
+CREATE INDEX IF NOT EXISTS filter_rule_forum    ON filter_rule (forum, id);
+CREATE INDEX IF NOT EXISTS filter_hit_forum     ON filter_hit (forum, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor      ON audit_log (actor, id);
+CREATE INDEX IF NOT EXISTS audit_log_target     ON audit_log (target_type, target_id, id);
 CREATE INDEX IF NOT EXISTS post_thread_id_path1_parent ON post (thread, id, (path[1]), parent);
 CREATE INDEX IF NOT EXISTS post_thread_path_id         ON post (thread, path, id);
 CREATE INDEX IF NOT EXISTS post_path1_path_id_desc     ON post ((path[1]) DESC, path, id);
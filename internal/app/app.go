@@ -1,6 +1,9 @@
 package app
 
 import (
+	"io"
+	"time"
+
 	"github.com/yarikTri/dbms-term-proj/internal/models"
 )
 
@@ -10,6 +13,8 @@ type Repository interface {
 	SelectUserByEmail(email string) (models.User, error)
 	UpdateUser(user models.User) (models.User, error)
 	SelectUsersByNickAndEmail(nickname, email string) ([]models.User, error)
+	SelectThreadsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Thread, error)
+	SelectPostsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Post, error)
 
 	InsertForum(forum models.Forum) (models.Forum, error)
 	SelectForumBySlug(slug string) (models.Forum, error)
@@ -22,14 +27,122 @@ type Repository interface {
 	UpdateVote(vote models.Vote) (models.Vote, error)
 	GetServiceStatus() (map[string]int, error)
 	ClearDatabase() error
+	ReconcileThreadCounters(since time.Time) (int, error)
+	RefreshThreadHot(window time.Duration) (int, error)
 	SelectUsersByForum(slugForum string, parameters models.QueryParameters) ([]models.User, error)
 	SelectThreadsByForum(slugForum string, parameters models.QueryParameters) ([]models.Thread, error)
+	SelectTrendingThreads(parameters models.QueryParameters) ([]models.Thread, error)
 	SelectPostById(id int) (models.Post, error)
-	UpdatePost(id int, message string) (models.Post, error)
-	SelectPostsByThread(thread models.Thread, limit, since int, sort string, desc bool) ([]models.Post, error)
+	UpdatePost(id int, message string, version int) (models.Post, error)
+	SelectPostsByThread(thread models.Thread, limit, since int, sort string, desc bool, viewer string) ([]models.Post, error)
 	SelectThreadByForum(forum string) (models.Thread, error)
+	SelectPostChildren(post models.Post, parameters models.PostTreeParameters) ([]models.Post, error)
+	SelectPostAncestors(post models.Post, viewer string) ([]models.Post, error)
 
 	SelectThreadIdBySlug(slug string) (int, error)
+	SelectSlugSuffix(base string) (int, error)
+
+	UpsertReadMarker(marker models.ReadMarker) (models.ReadMarker, error)
+	SelectUnreadCounts(nickname string, threads []int) (map[int]int, error)
+	SelectUnreadThreads(nickname string, parameters models.QueryParameters) ([]models.UnreadThread, error)
+	SelectUnreadTotal(nickname string) (int, error)
+
+	InsertAttachment(attachment models.Attachment) (models.Attachment, error)
+	SelectAttachmentById(id int) (models.Attachment, error)
+	SelectAttachmentsByPosts(posts []int) (map[int][]models.Attachment, error)
+	SelectOrphanedAttachments() ([]models.Attachment, error)
+	SelectAllAttachments() ([]models.Attachment, error)
+	DeleteAttachment(id int) error
+
+	InsertReport(report models.Report) (models.Report, error)
+	SelectReportById(id int) (models.Report, error)
+	LockReport(id int) (models.Report, error)
+	SelectReportsByForum(forum, status string, parameters models.QueryParameters) ([]models.Report, error)
+	ResolveReport(report models.Report, entry models.ModerationLogEntry) (models.Report, error)
+	SelectModerationLog(forum string, parameters models.QueryParameters) ([]models.ModerationLogEntry, error)
+	IsForumModerator(forum, nickname string) (bool, error)
+	InsertForumModerator(forum, nickname string) error
+	SelectForumModerators(forum string) ([]string, error)
+	HidePost(id int) error
+	LockThread(id int) error
+
+	InsertBan(ban models.Ban) (models.Ban, error)
+	SelectBanById(id int) (models.Ban, error)
+	SelectBans(forum string, parameters models.QueryParameters) ([]models.Ban, error)
+	SelectActiveBans(forum string, nicknames []string) ([]models.Ban, error)
+	DeleteBan(id int) error
+
+	InsertFilterRule(rule models.FilterRule) (models.FilterRule, error)
+	SelectFilterRules(forum string) ([]models.FilterRule, error)
+	DeleteFilterRule(id int) error
+	InsertFilterHits(hits []models.FilterHit) error
+	SelectFilterHits(parameters models.QueryParameters) ([]models.FilterHit, error)
+	CountPostsByAuthor(nickname string) (int, error)
+	HasRecentMessage(nickname, message string, window int) (bool, error)
+
+	UpdateForumVisibility(forum, visibility string) (models.Forum, error)
+	IsForumMember(forum, nickname string) (bool, error)
+	InsertForumMember(forum, nickname string) (models.ForumMember, error)
+	DeleteForumMember(forum, nickname string) error
+	SelectForumMembers(forum string, parameters models.QueryParameters) ([]models.ForumMember, error)
+	InsertJoinRequest(request models.JoinRequest) (models.JoinRequest, error)
+	SelectJoinRequestById(id int) (models.JoinRequest, error)
+	SelectJoinRequests(forum, status string, parameters models.QueryParameters) ([]models.JoinRequest, error)
+	DecideJoinRequest(request models.JoinRequest) (models.JoinRequest, error)
+	InsertInvitation(invitation models.Invitation) (models.Invitation, error)
+	AcceptInvitation(token, nickname string) (models.ForumMember, error)
+
+	InsertConversation(conversation models.Conversation) (models.Conversation, error)
+	SelectDirectConversation(viewer, other string) (models.Conversation, error)
+	SelectConversationById(id int, viewer string) (models.Conversation, error)
+	SelectConversations(nickname string, parameters models.QueryParameters) ([]models.Conversation, error)
+	InsertConversationMessage(message models.ConversationMessage) (models.ConversationMessage, error)
+	SelectConversationMessageById(id int) (models.ConversationMessage, error)
+	SelectConversationMessages(conversation int, parameters models.QueryParameters) ([]models.ConversationMessage, error)
+	UpdateConversationMessage(id int, message string) (models.ConversationMessage, error)
+	MarkConversationRead(conversation int, nickname string, message int) (int, error)
+	InsertUserBlock(blocker, blocked string) (models.UserBlock, error)
+	DeleteUserBlock(blocker, blocked string) error
+	SelectUserBlocks(blocker string) ([]models.UserBlock, error)
+	SelectBlockers(nickname string, users []string) ([]string, error)
+	InsertUserMute(muter, muted string) (models.UserMute, error)
+	DeleteUserMute(muter, muted string) error
+	SelectUserMutes(muter string) ([]models.UserMute, error)
+	SelectHiddenAuthors(nickname string) ([]string, error)
+	SelectPostAuthors(ids []int) (map[int]string, error)
+
+	SelectForums(parameters models.QueryParameters) ([]models.Forum, error)
+	UpdateForum(forum models.Forum) (models.Forum, error)
+	ArchiveForum(slug string) (models.Forum, error)
+	DeleteForum(slug string) error
+	InsertCategory(category models.Category) (models.Category, error)
+	UpdateCategory(category models.Category) (models.Category, error)
+	SelectCategoryById(id int) (models.Category, error)
+	SelectCategories() ([]models.Category, error)
+	SelectPlacedForums() ([]models.Forum, error)
+	UpdateForumPlacement(slug string, placement models.ForumPlacement) (models.Forum, error)
+	IsCategoryDescendant(id, candidate int) (bool, error)
+	IsForumDescendant(slug, candidate string) (bool, error)
+	ReplaceThreadTags(thread int, forum string, tags []string) error
+	SelectThreadTags(threads []int) (map[int][]string, error)
+	SelectForumTags(forum string, parameters models.QueryParameters) ([]models.TagUsage, error)
+	SelectThreadsByTag(parameters models.QueryParameters) ([]models.Thread, error)
+	InsertPoll(poll models.Poll) (models.Poll, error)
+	SelectPollByThread(thread int, viewer string) (models.Poll, error)
+	ReplacePollVote(poll int, nickname string, options []int) error
+	UpdateForumQA(forum string, qa bool) (models.Forum, error)
+	UpdateThreadAnswer(thread, post int) (models.Thread, error)
+	RenameForum(slug, name string) (models.Forum, error)
+	RenameThread(id int, slug string) (models.Thread, error)
+	RenameUser(nickname, name string) (models.User, error)
+	SelectRenamed(kind, old string) (string, error)
+
+	// InTransaction runs fn as a unit of work: every call on the repository
+	// passed to fn takes part in one transaction.
+	InTransaction(fn func(Repository) error) error
+
+	InsertAuditEntry(entry models.AuditEntry) error
+	SelectAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, error)
 }
 
 type UseCase interface {
@@ -38,6 +151,8 @@ type UseCase interface {
 	CheckUserByNickname(nickname string) (models.User, error)
 	HasUser(user models.User) ([]models.User, error)
 	EditUser(newUser models.User) (models.User, error)
+	CheckThreadsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Thread, error)
+	CheckPostsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Post, error)
 
 	CreateForum(forum models.Forum) (models.Forum, error)
 	CheckForumBySlug(slug string) (models.Forum, error)
@@ -45,17 +160,98 @@ type UseCase interface {
 	CheckThreadBySlug(slug string) (models.Thread, error)
 	CheckThreadById(id int) (models.Thread, error)
 	CreatePosts(posts []models.Post, id int) ([]models.Post, error)
-	EditThread(thread models.Thread) (models.Thread, error)
+	EditThread(thread models.Thread, caller string) (models.Thread, error)
 	AddVote(vote models.Vote) (models.Vote, error)
 	UpdateVote(vote models.Vote) (models.Vote, error)
 	GetServiceStatus() (map[string]int, error)
-	ClearDatabase() error
+	ClearDatabase(caller string) error
+	ReconcileThreadCounters(since time.Time) (int, error)
+	ReconcileThreadCountersAs(caller string) (int, error)
+	RefreshThreadHot(window time.Duration) (int, error)
 	CheckUsersByForum(slugForum string, parameters models.QueryParameters) ([]models.User, error)
 	CheckThreadsByForum(slugForum string, parameters models.QueryParameters) ([]models.Thread, error)
+	CheckTrendingThreads(parameters models.QueryParameters) ([]models.Thread, error)
 	CheckPostById(id int, related []string) (map[string]interface{}, error)
-	EditPost(id int, message string) (models.Post, error)
-	CheckPostsByThread(thread models.Thread, limit, since int, sort string, desc bool) ([]models.Post, error)
+	EditPost(id int, message string, version int, caller string) (models.Post, error)
+	CheckPostsByThread(thread models.Thread, limit, since int, sort string, desc bool, viewer string) ([]models.Post, error)
 	CheckThreadByForum(forum string) (models.Thread, error)
+	CheckPostChildren(id int, parameters models.PostTreeParameters) ([]models.Post, error)
+	CheckPostAncestors(id int, viewer string) ([]models.Post, error)
 
 	CheckThreadIdBySlug(slug string) (int, error)
+
+	MarkThreadRead(marker models.ReadMarker) (models.ReadMarker, error)
+	CheckUnreadThreads(nickname string, parameters models.QueryParameters) ([]models.UnreadThread, int, error)
+
+	AddAttachments(post int, uploads []models.Upload, caller string) ([]models.Attachment, error)
+	CheckAttachmentById(id int) (models.Attachment, error)
+	OpenAttachment(key string) (io.ReadCloser, error)
+	CleanupAttachments() (int, error)
+
+	CreateReport(report models.Report) (models.Report, error)
+	CheckForumReports(forum, moderator, status string, parameters models.QueryParameters) ([]models.Report, error)
+	ResolveReport(id int, action models.ModerationAction) (models.Report, error)
+	CheckModerationLog(forum, moderator string, parameters models.QueryParameters) ([]models.ModerationLogEntry, error)
+	CheckForumModerators(forum string) ([]string, error)
+	AddForumModerator(forum, nickname, owner string) error
+
+	CreateBan(ban models.Ban) (models.Ban, error)
+	CheckBans(forum, caller string, parameters models.QueryParameters) ([]models.Ban, error)
+	LiftBan(id int, caller string) (models.Ban, error)
+
+	CreateFilterRule(rule models.FilterRule) (models.FilterRule, error)
+	CheckFilterRules(forum, caller string) ([]models.FilterRule, error)
+	RemoveFilterRule(id int, caller string) error
+	CheckFilterHits(caller string, parameters models.QueryParameters) ([]models.FilterHit, error)
+	TestFilters(check models.FilterCheck, caller string) (models.FilterCheck, error)
+
+	SetForumVisibility(forum, visibility, caller string) (models.Forum, error)
+	JoinForum(request models.JoinRequest) (models.JoinRequest, error)
+	CheckJoinRequests(forum, moderator, status string, parameters models.QueryParameters) ([]models.JoinRequest, error)
+	DecideJoinRequest(id int, decision models.JoinDecision) (models.JoinRequest, error)
+	CreateInvitation(invitation models.Invitation) (models.Invitation, error)
+	AcceptInvitation(token, nickname string) (models.ForumMember, error)
+	CheckForumMembers(forum, viewer string, parameters models.QueryParameters) ([]models.ForumMember, error)
+	RemoveForumMember(forum, nickname, caller string) error
+	CheckForumAccess(forum, viewer string) error
+
+	CreateConversation(conversation models.Conversation) (models.Conversation, error)
+	CheckConversations(nickname string, parameters models.QueryParameters) ([]models.Conversation, error)
+	CheckConversation(id int, viewer string) (models.Conversation, error)
+	SendMessage(message models.ConversationMessage) (models.ConversationMessage, error)
+	CheckConversationMessages(id int, viewer string, parameters models.QueryParameters) ([]models.ConversationMessage, error)
+	EditConversationMessage(id int, text, caller string) (models.ConversationMessage, error)
+	MarkConversationRead(id int, viewer string, message int) (int, error)
+	BlockUser(blocker, blocked, caller string) (models.UserBlock, error)
+	UnblockUser(blocker, blocked, caller string) error
+	CheckUserBlocks(blocker, caller string) ([]models.UserBlock, error)
+	MuteUser(muter, muted, caller string) (models.UserMute, error)
+	UnmuteUser(muter, muted, caller string) error
+	CheckUserMutes(muter, caller string) ([]models.UserMute, error)
+	CheckHiddenAuthors(viewer string) (map[string]bool, error)
+
+	CheckForums(parameters models.QueryParameters) ([]models.Forum, error)
+	EditForum(forum models.Forum, caller string) (models.Forum, error)
+	DeleteForum(slug, mode, caller string) (models.Forum, error)
+	CreateCategory(category models.Category, caller string) (models.Category, error)
+	CheckCategory(id int) (models.Category, error)
+	EditCategory(category models.Category, caller string) (models.Category, error)
+	PlaceForum(slug string, placement models.ForumPlacement, caller string) (models.Forum, error)
+	CheckCategoryTree() ([]models.Category, error)
+	CheckForumTags(forum string, parameters models.QueryParameters) ([]models.TagUsage, error)
+	CheckThreadsByTag(parameters models.QueryParameters) ([]models.Thread, error)
+	CreatePoll(thread int, poll models.Poll, caller string) (models.Poll, error)
+	CheckPoll(thread int, viewer string) (models.Poll, error)
+	VotePoll(thread int, viewer string, vote models.PollVote) (models.Poll, error)
+	SetForumQA(forum string, qa bool, caller string) (models.Forum, error)
+	AcceptAnswer(thread int, answer models.AcceptedAnswer, caller string) (models.Thread, error)
+	AcceptedAnswerFirst(posts []models.Post, since, limit int, viewer string) ([]models.Post, error)
+	RenameForum(slug string, rename models.Rename, caller string) (models.Forum, error)
+	RenameThread(id int, rename models.Rename, caller string) (models.Thread, error)
+	RenameUser(nickname string, rename models.Rename, caller string) (models.User, error)
+	ResolveRename(kind, old string) (string, error)
+	CreateThreadWithPosts(thread models.Thread, posts []models.Post) (models.Thread, []models.Post, error)
+
+	RecordAudit(entry models.AuditEntry) error
+	CheckAuditLog(filter models.AuditFilter, caller string) ([]models.AuditEntry, error)
 }
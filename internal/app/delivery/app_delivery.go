@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/yarikTri/dbms-term-proj/internal/app"
+	"github.com/yarikTri/dbms-term-proj/internal/markdown"
 	"github.com/yarikTri/dbms-term-proj/internal/models"
 
 	"github.com/gorilla/mux"
@@ -15,32 +16,97 @@ import (
 
 type AppHandler struct {
 	appUseCase app.UseCase
+	renderer   *markdown.Renderer
 }
 
-func NewAppHandler(router *mux.Router, appUseCase app.UseCase) {
+func NewAppHandler(router *mux.Router, appUseCase app.UseCase, renderer *markdown.Renderer) {
 	handler := &AppHandler{
 		appUseCase: appUseCase,
+		renderer:   renderer,
 	}
 
 	router.HandleFunc("/api/user/{nickname}/create", handler.CreateUser).Methods(http.MethodPost)
 	router.HandleFunc("/api/user/{nickname}/profile", handler.UserProfile).Methods(http.MethodGet, http.MethodPost)
-
+	router.HandleFunc("/api/user/{nickname}/threads", handler.UserThreads).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/{nickname}/posts", handler.UserPosts).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/{nickname}/unread", handler.UserUnread).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/{nickname}/rename", handler.RenameUser).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/{nickname}/blocks", handler.UserBlocks).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/user/{nickname}/block/{blocked}", handler.UnblockUser).Methods(http.MethodDelete)
+	router.HandleFunc("/api/user/{nickname}/mutes", handler.UserMutes).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/user/{nickname}/mute/{muted}", handler.UnmuteUser).Methods(http.MethodDelete)
+
+	router.HandleFunc("/api/categories", handler.Categories).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/category/{id}/details", handler.CategoryDetails).Methods(http.MethodGet, http.MethodPost)
+
+	router.HandleFunc("/api/forums", handler.Forums).Methods(http.MethodGet)
 	router.HandleFunc("/api/forum/create", handler.CreateForum).Methods(http.MethodPost)
-	router.HandleFunc("/api/forum/{slug}/details", handler.ForumDetails).Methods(http.MethodGet)
+	router.HandleFunc("/api/forum/{slug}/details", handler.ForumDetails).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/details", handler.DeleteForum).Methods(http.MethodDelete)
+	router.HandleFunc("/api/forum/{slug}/placement", handler.ForumPlacement).Methods(http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/qa", handler.ForumQA).Methods(http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/rename", handler.RenameForum).Methods(http.MethodPost)
 	router.HandleFunc("/api/forum/{slug}/create", handler.CreateThread).Methods(http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/create-with-posts", handler.CreateThreadWithPosts).Methods(http.MethodPost)
 	router.HandleFunc("/api/forum/{slug}/threads", handler.ForumThreads).Methods(http.MethodGet)
+	router.HandleFunc("/api/forum/{slug}/tags", handler.ForumTags).Methods(http.MethodGet)
 	router.HandleFunc("/api/forum/{slug}/users", handler.ForumUsers).Methods(http.MethodGet)
-
+	router.HandleFunc("/api/forum/{slug}/reports", handler.ForumReports).Methods(http.MethodGet)
+	router.HandleFunc("/api/forum/{slug}/moderation/log", handler.ForumModerationLog).Methods(http.MethodGet)
+	router.HandleFunc("/api/forum/{slug}/moderators", handler.ForumModerators).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/bans", handler.ForumBans).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/visibility", handler.ForumVisibility).Methods(http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/join", handler.JoinForum).Methods(http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/requests", handler.ForumJoinRequests).Methods(http.MethodGet)
+	router.HandleFunc("/api/forum/{slug}/invitations", handler.CreateInvitation).Methods(http.MethodPost)
+	router.HandleFunc("/api/forum/{slug}/members", handler.ForumMembers).Methods(http.MethodGet)
+	router.HandleFunc("/api/forum/{slug}/member/{nickname}", handler.RemoveForumMember).Methods(http.MethodDelete)
+
+	router.HandleFunc("/api/threads/trending", handler.TrendingThreads).Methods(http.MethodGet)
+	router.HandleFunc("/api/tags/{tag}/threads", handler.TagThreads).Methods(http.MethodGet)
 	router.HandleFunc("/api/thread/{slug_or_id}/create", handler.CreatePosts).Methods(http.MethodPost)
 	router.HandleFunc("/api/thread/{slug_or_id}/vote", handler.VoteThread).Methods(http.MethodPost)
 	router.HandleFunc("/api/thread/{slug_or_id}/details", handler.ThreadDetails).Methods(http.MethodGet, http.MethodPost)
 
 	router.HandleFunc("/api/thread/{slug_or_id}/posts", handler.ThreadPosts).Methods(http.MethodGet)
+	router.HandleFunc("/api/thread/{slug_or_id}/read", handler.ReadThread).Methods(http.MethodPost)
+	router.HandleFunc("/api/thread/{slug_or_id}/poll", handler.ThreadPoll).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/thread/{slug_or_id}/poll/vote", handler.VotePoll).Methods(http.MethodPost)
+	router.HandleFunc("/api/thread/{slug_or_id}/answer", handler.AcceptAnswer).Methods(http.MethodPost)
+	router.HandleFunc("/api/thread/{slug_or_id}/rename", handler.RenameThread).Methods(http.MethodPost)
 
 	router.HandleFunc("/api/post/{id}/details", handler.PostDetails).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/post/{id}/children", handler.PostChildren).Methods(http.MethodGet)
+	router.HandleFunc("/api/post/{id}/ancestors", handler.PostAncestors).Methods(http.MethodGet)
+	router.HandleFunc("/api/post/{id}/attachments", handler.UploadAttachments).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/report", handler.CreateReport).Methods(http.MethodPost)
+	router.HandleFunc("/api/report/{id}/resolve", handler.ResolveReport).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/conversations", handler.Conversations).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/conversation/{id}/details", handler.ConversationDetails).Methods(http.MethodGet)
+	router.HandleFunc("/api/conversation/{id}/messages", handler.ConversationMessages).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/conversation/{id}/read", handler.ReadConversation).Methods(http.MethodPost)
+	router.HandleFunc("/api/message/{id}/details", handler.MessageDetails).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/join-request/{id}/decide", handler.DecideJoinRequest).Methods(http.MethodPost)
+	router.HandleFunc("/api/invitation/{token}/accept", handler.AcceptInvitation).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/bans", handler.GlobalBans).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/ban/{id}", handler.LiftBan).Methods(http.MethodDelete)
+
+	router.HandleFunc("/api/admin/filters", handler.FilterRules).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/api/admin/filters/hits", handler.FilterHits).Methods(http.MethodGet)
+	router.HandleFunc("/api/admin/filters/test", handler.TestFilters).Methods(http.MethodPost)
+	router.HandleFunc("/api/admin/filter/{id}", handler.DeleteFilterRule).Methods(http.MethodDelete)
+	router.HandleFunc("/api/admin/audit", handler.AuditLog).Methods(http.MethodGet)
+
+	router.HandleFunc("/api/attachment/{id}", handler.AttachmentContent).Methods(http.MethodGet)
+	router.HandleFunc("/api/attachment/{id}/thumbnail", handler.AttachmentContent).Methods(http.MethodGet)
 
 	router.HandleFunc("/api/service/status", handler.StatusHandler).Methods(http.MethodGet)
 	router.HandleFunc("/api/service/clear", handler.ClearHandler).Methods(http.MethodPost)
+	router.HandleFunc("/api/service/reconcile", handler.ReconcileHandler).Methods(http.MethodPost)
 }
 
 func errorMarshal(message string) ([]byte, error) {
@@ -53,6 +119,96 @@ func errorMarshal(message string) ([]byte, error) {
 	return body, nil
 }
 
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	writer.WriteHeader(status)
+	writer.Write(body)
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	body, err := errorMarshal(message)
+	if err != nil {
+		return
+	}
+
+	writer.WriteHeader(status)
+	writer.Write(body)
+}
+
+// viewerNickname returns the nickname the caller acts as. There are no sessions,
+// so clients identify themselves with a header.
+func viewerNickname(request *http.Request) string {
+	return request.Header.Get("X-Nickname")
+}
+
+func threadView(thread models.Thread) interface{} {
+	if thread.SlugGenerated {
+		return models.ThreadToWithout(thread)
+	}
+
+	return thread
+}
+
+// wantsHTML reports whether the client asked for rendered messages.
+func wantsHTML(request *http.Request) bool {
+	html, err := strconv.ParseBool(request.URL.Query().Get("html"))
+
+	return err == nil && html
+}
+
+func (h AppHandler) renderThread(request *http.Request, thread *models.Thread) {
+	if wantsHTML(request) {
+		thread.MessageHTML = h.renderer.Render(thread.Message)
+	}
+}
+
+func (h AppHandler) renderThreads(request *http.Request, threads []models.Thread) {
+	for i := range threads {
+		h.renderThread(request, &threads[i])
+	}
+}
+
+func (h AppHandler) renderPost(request *http.Request, post *models.Post) {
+	if wantsHTML(request) {
+		post.MessageHTML = h.renderer.Render(post.Message)
+	}
+}
+
+func (h AppHandler) renderPosts(request *http.Request, posts []models.Post) {
+	for i := range posts {
+		h.renderPost(request, &posts[i])
+	}
+}
+
+func parseQueryParameters(request *http.Request, defaultLimit int) models.QueryParameters {
+	var parameters models.QueryParameters
+	limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+	if err != nil {
+		limit = defaultLimit
+	}
+	parameters.Limit = limit
+
+	parameters.Since = request.URL.Query().Get("since")
+
+	desc, err := strconv.ParseBool(request.URL.Query().Get("desc"))
+	if err != nil {
+		desc = false
+	}
+	parameters.Desc = desc
+
+	parameters.Forum = request.URL.Query().Get("forum")
+	parameters.From = request.URL.Query().Get("from")
+	parameters.To = request.URL.Query().Get("to")
+	parameters.Sort = request.URL.Query().Get("sort")
+	parameters.Viewer = viewerNickname(request)
+
+	return parameters
+}
+
 func (h AppHandler) CreateUser(writer http.ResponseWriter, request *http.Request) {
 	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/create")
 
@@ -105,6 +261,11 @@ func (h AppHandler) UserProfile(writer http.ResponseWriter, request *http.Reques
 
 			return
 		}
+
+		if notModified(writer, request, etag(user.Version)) {
+			return
+		}
+
 		body, err := json.Marshal(user)
 		if err != nil {
 			return
@@ -123,7 +284,25 @@ func (h AppHandler) UserProfile(writer http.ResponseWriter, request *http.Reques
 	}
 	user.Nickname = nickname
 
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		writePreconditionFailed(writer)
+
+		return
+	}
+	user.Version = version
+
+	before, _ := h.appUseCase.CheckUserByNickname(nickname)
+
 	result, err := h.appUseCase.EditUser(user)
+	if writeBanError(writer, err) {
+		return
+	}
+	if err == models.ErrVersionMismatch {
+		writePreconditionFailed(writer)
+
+		return
+	}
 	if err != nil {
 		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" {
 			body, err := errorMarshal("Conflict email\n")
@@ -149,6 +328,10 @@ func (h AppHandler) UserProfile(writer http.ResponseWriter, request *http.Reques
 	}
 	// check conflict with constraint unique on email
 
+	h.audit(request, "user.edit", "user", result.Nickname, before, result)
+
+	writer.Header().Set("ETag", etag(result.Version))
+
 	body, err := json.Marshal(result)
 	if err != nil {
 		return
@@ -181,6 +364,14 @@ func (h AppHandler) CreateForum(writer http.ResponseWriter, request *http.Reques
 	forum.User = user.Nickname
 
 	f, err := h.appUseCase.CreateForum(forum)
+	if writeBanError(writer, err) {
+		return
+	}
+	if err == models.ErrBadVisibility {
+		writeError(writer, http.StatusBadRequest, err.Error())
+
+		return
+	}
 	if pgErr, ok := err.(pgx.PgError); ok {
 		switch pgErr.Code {
 		case "23505":
@@ -220,6 +411,11 @@ func (h AppHandler) CreateForum(writer http.ResponseWriter, request *http.Reques
 
 func (h AppHandler) ForumDetails(writer http.ResponseWriter, request *http.Request) {
 	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/details")
+	if request.Method == http.MethodPost {
+		h.editForum(writer, request, slug)
+
+		return
+	}
 
 	forum, err := h.appUseCase.CheckForumBySlug(slug)
 	if err != nil {
@@ -234,6 +430,10 @@ func (h AppHandler) ForumDetails(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
+	if notModified(writer, request, etag(forum.Version)) {
+		return
+	}
+
 	body, err := json.Marshal(forum)
 	if err != nil {
 		return
@@ -243,6 +443,11 @@ func (h AppHandler) ForumDetails(writer http.ResponseWriter, request *http.Reque
 	writer.Write(body)
 }
 
+// generatedSlugTaken answers a thread creation whose slug, made from the
+// title, was taken by concurrent threads on every attempt. It goes out as a
+// 503 so that an idempotent retry isn't replayed the same answer.
+const generatedSlugTaken = "Can't pick a free slug for this title, try again"
+
 func (h AppHandler) CreateThread(writer http.ResponseWriter, request *http.Request) {
 	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/create")
 
@@ -252,12 +457,28 @@ func (h AppHandler) CreateThread(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	flag := thread.Slug == ""
-
 	newThread, err := h.appUseCase.CreateForumThread(thread)
+	if writeBanError(writer, err) || writeFilterError(writer, err) || writeAccessError(writer, err) || writeBlockError(writer, err) {
+		return
+	}
+	if err == models.ErrBadTags || err == models.ErrBadPoll {
+		writeError(writer, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
 	if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" {
+		// A generated slug stayed taken through every retry.
+		if thread.Slug == "" {
+			writeError(writer, http.StatusServiceUnavailable, generatedSlugTaken)
+
+			return
+		}
+
 		oldThread, err := h.appUseCase.CheckThreadBySlug(thread.Slug)
 		if err != nil {
+			writeError(writer, http.StatusConflict, "Thread with this slug exists")
+
 			return
 		}
 
@@ -297,37 +518,76 @@ func (h AppHandler) CreateThread(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	if flag {
-		threadWithoutSlug := models.ThreadWithoutSlug{
-			Id:      newThread.Id,
-			Author:  newThread.Author,
-			Created: newThread.Created,
-			Forum:   forum.Slug,
-			Title:   newThread.Title,
-			Message: newThread.Message,
-			Votes:   newThread.Votes,
-		}
+	newThread.Forum = forum.Slug
 
-		body, err := json.Marshal(threadWithoutSlug)
-		if err != nil {
-			return
-		}
+	body, err := json.Marshal(threadView(newThread))
+	if err != nil {
+		return
+	}
 
-		writer.WriteHeader(http.StatusCreated)
-		writer.Write(body)
+	writer.WriteHeader(http.StatusCreated)
+	writer.Write(body)
+}
+
+// CreateThreadWithPosts creates a thread with its first posts, all or nothing.
+func (h AppHandler) CreateThreadWithPosts(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/create-with-posts")
+
+	var body models.ThreadWithPosts
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
 
 		return
 	}
+	body.Thread.Forum = slug
 
-	newThread.Forum = forum.Slug
+	thread, posts, err := h.appUseCase.CreateThreadWithPosts(body.Thread, body.Posts)
+	if writeBanError(writer, err) || writeFilterError(writer, err) || writeAccessError(writer, err) || writeBlockError(writer, err) {
+		return
+	}
+	if err == models.ErrBadTags || err == models.ErrBadPoll {
+		writeError(writer, http.StatusBadRequest, err.Error())
 
-	body, err := json.Marshal(newThread)
+		return
+	}
+	if pgErr, ok := err.(pgx.PgError); ok {
+		switch {
+		case pgErr.Code == "23505" && body.Thread.Slug != "":
+			oldThread, err := h.appUseCase.CheckThreadBySlug(body.Thread.Slug)
+			if err != nil {
+				writeError(writer, http.StatusConflict, "Thread with this slug exists")
+
+				return
+			}
+
+			writeJSON(writer, http.StatusConflict, oldThread)
+
+			return
+		case pgErr.Code == "23505":
+			writeError(writer, http.StatusServiceUnavailable, generatedSlugTaken)
+
+			return
+		case pgErr.Code == "00409" || pgErr.Message == models.PostParentError:
+			writeError(writer, http.StatusConflict, "Parent post was created in another thread")
+
+			return
+		}
+	}
 	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find forum or user")
+
 		return
 	}
 
-	writer.WriteHeader(http.StatusCreated)
-	writer.Write(body)
+	if posts == nil {
+		posts = []models.Post{}
+	}
+
+	writeJSON(writer, http.StatusCreated, map[string]interface{}{
+		"thread": threadView(thread),
+		"posts":  posts,
+	})
 }
 
 func (h AppHandler) CreatePosts(writer http.ResponseWriter, request *http.Request) {
@@ -385,6 +645,15 @@ func (h AppHandler) CreatePosts(writer http.ResponseWriter, request *http.Reques
 	author := posts[0].Author
 
 	resultPosts, err := h.appUseCase.CreatePosts(posts, id)
+	if err == models.ErrThreadLocked {
+		writeError(writer, http.StatusForbidden, "Thread is locked")
+
+		return
+	}
+	if writeBanError(writer, err) || writeFilterError(writer, err) || writeAccessError(writer, err) || writeBlockError(writer, err) {
+		return
+	}
+
 	if len(resultPosts) == 0 {
 		err = pgx.ErrNoRows
 	}
@@ -462,6 +731,14 @@ func (h AppHandler) ThreadDetails(writer http.ResponseWriter, request *http.Requ
 			thread, err = h.appUseCase.CheckThreadById(id)
 		}
 
+		if err == nil && thread.Shadow && !strings.EqualFold(thread.Author, viewerNickname(request)) {
+			err = pgx.ErrNoRows
+		}
+
+		if err == nil && !h.forumReadable(writer, request, thread.Forum) {
+			return
+		}
+
 		if err != nil {
 			body, err := errorMarshal("can't find thread")
 			if err != nil {
@@ -474,22 +751,17 @@ func (h AppHandler) ThreadDetails(writer http.ResponseWriter, request *http.Requ
 			return
 		}
 
-		if models.IsUUID(thread.Slug) {
-			result := models.ThreadToWithout(thread)
-
-			body, err := json.Marshal(result)
-			if err != nil {
-				return
-			}
-
-			writer.WriteHeader(http.StatusOK)
-			writer.Write(body)
+		thread.Poll = h.threadPoll(request, thread.Id)
+		h.renderThread(request, &thread)
 
+		body, err := json.Marshal(threadView(thread))
+		if err != nil {
 			return
 		}
 
-		body, err := json.Marshal(thread)
-		if err != nil {
+		// The poll choices shown depend on the viewer.
+		writer.Header().Set("Vary", "X-Nickname")
+		if notModified(writer, request, bodyETag(body, thread.Version)) {
 			return
 		}
 
@@ -511,7 +783,35 @@ func (h AppHandler) ThreadDetails(writer http.ResponseWriter, request *http.Requ
 		thread.Id = id
 	}
 
-	newThread, err := h.appUseCase.EditThread(thread)
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		writePreconditionFailed(writer)
+
+		return
+	}
+	thread.Version = version
+
+	var before models.Thread
+	if thread.Slug != "" {
+		before, _ = h.appUseCase.CheckThreadBySlug(thread.Slug)
+	} else {
+		before, _ = h.appUseCase.CheckThreadById(thread.Id)
+	}
+
+	newThread, err := h.appUseCase.EditThread(thread, viewerNickname(request))
+	if writeBanError(writer, err) || writeFilterError(writer, err) {
+		return
+	}
+	if err == models.ErrVersionMismatch {
+		writePreconditionFailed(writer)
+
+		return
+	}
+	if err == models.ErrBadTags {
+		writeError(writer, http.StatusBadRequest, err.Error())
+
+		return
+	}
 	if err != nil {
 		body, err := errorMarshal("can't find thread")
 		if err != nil {
@@ -524,7 +824,13 @@ func (h AppHandler) ThreadDetails(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
-	if models.IsUUID(newThread.Slug) {
+	h.audit(request, "thread.edit", "thread", strconv.Itoa(newThread.Id), before, newThread)
+
+	writer.Header().Set("ETag", etag(newThread.Version))
+
+	h.renderThread(request, &newThread)
+
+	if newThread.SlugGenerated {
 		result := models.ThreadToWithout(newThread)
 
 		body, err := json.Marshal(result)
@@ -581,9 +887,15 @@ func (h AppHandler) VoteThread(writer http.ResponseWriter, request *http.Request
 	vote.IdThread = id
 
 	_, err = h.appUseCase.AddVote(vote)
+	if writeBanError(writer, err) || writeAccessError(writer, err) {
+		return
+	}
 	if err != nil {
 		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" {
 			_, err := h.appUseCase.UpdateVote(vote)
+			if writeBanError(writer, err) {
+				return
+			}
 			if err != nil {
 				body, err := errorMarshal("can't find thread or this")
 				if err != nil {
@@ -609,8 +921,9 @@ func (h AppHandler) VoteThread(writer http.ResponseWriter, request *http.Request
 	}
 
 	thread, err = h.appUseCase.CheckThreadById(id)
+	h.renderThread(request, &thread)
 
-	if models.IsUUID(thread.Slug) {
+	if thread.SlugGenerated {
 		result := models.ThreadToWithout(thread)
 
 		body, err := json.Marshal(result)
@@ -655,7 +968,14 @@ func (h AppHandler) StatusHandler(writer http.ResponseWriter, request *http.Requ
 }
 
 func (h AppHandler) ClearHandler(writer http.ResponseWriter, request *http.Request) {
-	err := h.appUseCase.ClearDatabase()
+	before, _ := h.appUseCase.GetServiceStatus()
+
+	err := h.appUseCase.ClearDatabase(viewerNickname(request))
+	if err == models.ErrForbidden {
+		writeError(writer, http.StatusForbidden, "Only administrators can clear the database")
+
+		return
+	}
 	if err != nil {
 		body, err := errorMarshal("ochen ploho")
 		if err != nil {
@@ -664,11 +984,33 @@ func (h AppHandler) ClearHandler(writer http.ResponseWriter, request *http.Reque
 
 		writer.WriteHeader(http.StatusNotFound)
 		writer.Write(body)
+
+		return
 	}
 
+	h.audit(request, "service.clear", "service", "database", before, nil)
+
 	writer.WriteHeader(http.StatusOK)
 }
 
+func (h AppHandler) ReconcileHandler(writer http.ResponseWriter, request *http.Request) {
+	fixed, err := h.appUseCase.ReconcileThreadCountersAs(viewerNickname(request))
+	if err == models.ErrForbidden {
+		writeError(writer, http.StatusForbidden, "Only administrators can reconcile counters")
+
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, "Can't reconcile thread counters")
+
+		return
+	}
+
+	h.audit(request, "service.reconcile", "service", "thread_counters", nil, map[string]int{"thread": fixed})
+
+	writeJSON(writer, http.StatusOK, map[string]int{"thread": fixed})
+}
+
 func (h AppHandler) ForumUsers(writer http.ResponseWriter, request *http.Request) {
 	var parameters models.QueryParameters
 	limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
@@ -687,6 +1029,9 @@ func (h AppHandler) ForumUsers(writer http.ResponseWriter, request *http.Request
 	parameters.Desc = desc
 
 	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/users")
+	if !h.forumReadable(writer, request, slug) {
+		return
+	}
 
 	users, err := h.appUseCase.CheckUsersByForum(slug, parameters)
 	if err != nil {
@@ -751,9 +1096,37 @@ func (h AppHandler) ForumThreads(writer http.ResponseWriter, request *http.Reque
 	}
 	parameters.Desc = desc
 
+	parameters.Viewer = viewerNickname(request)
+	parameters.Tag = request.URL.Query().Get("tag")
+
+	if solved := request.URL.Query().Get("solved"); solved != "" {
+		value, err := strconv.ParseBool(solved)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Bad solved filter")
+
+			return
+		}
+		parameters.Solved = strconv.FormatBool(value)
+	}
+
+	parameters.Sort = request.URL.Query().Get("sort")
+	if !models.IsThreadSort(parameters.Sort) {
+		writeError(writer, http.StatusBadRequest, "Unknown sort")
+
+		return
+	}
+
 	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/threads")
+	if !h.forumReadable(writer, request, slug) {
+		return
+	}
 
 	threads, err := h.appUseCase.CheckThreadsByForum(slug, parameters)
+	if err == models.ErrBadTags {
+		writeError(writer, http.StatusBadRequest, err.Error())
+
+		return
+	}
 	if err == pgx.ErrNoRows || len(threads) == 0 {
 		_, err := h.appUseCase.CheckThreadByForum(slug)
 		if err == nil {
@@ -779,9 +1152,12 @@ func (h AppHandler) ForumThreads(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	var result []interface{}
+	threads = h.muteThreads(request, threads)
+	h.renderThreads(request, threads)
+
+	result := []interface{}{}
 	for _, thr := range threads {
-		if models.IsUUID(thr.Slug) {
+		if thr.SlugGenerated {
 			tw := models.ThreadToWithout(thr)
 
 			result = append(result, tw)
@@ -809,6 +1185,12 @@ func (h AppHandler) PostDetails(writer http.ResponseWriter, request *http.Reques
 		related := strings.Split(request.URL.Query().Get("related"), ",")
 
 		data, err := h.appUseCase.CheckPostById(id, related)
+		if post, ok := data["post"].(models.Post); ok && post.Shadow && !strings.EqualFold(post.Author, viewerNickname(request)) {
+			err = pgx.ErrNoRows
+		}
+		if post, ok := data["post"].(models.Post); ok && err == nil && !h.forumReadable(writer, request, post.Forum) {
+			return
+		}
 		if err != nil {
 			body, err := errorMarshal("can't find something")
 			if err != nil {
@@ -821,11 +1203,31 @@ func (h AppHandler) PostDetails(writer http.ResponseWriter, request *http.Reques
 			return
 		}
 
+		if wantsHTML(request) {
+			if post, ok := data["post"].(models.Post); ok {
+				h.renderPost(request, &post)
+				data["post"] = post
+			}
+
+			switch thread := data["thread"].(type) {
+			case models.Thread:
+				h.renderThread(request, &thread)
+				data["thread"] = thread
+			case models.ThreadWithoutSlug:
+				thread.MessageHTML = h.renderer.Render(thread.Message)
+				data["thread"] = thread
+			}
+		}
+
 		body, err := json.Marshal(data)
 		if err != nil {
 			return
 		}
 
+		if notModified(writer, request, bodyETag(body, postVersions(data)...)) {
+			return
+		}
+
 		writer.WriteHeader(http.StatusOK)
 		writer.Write(body)
 
@@ -838,7 +1240,24 @@ func (h AppHandler) PostDetails(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
-	post, err = h.appUseCase.EditPost(id, post.Message)
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		writePreconditionFailed(writer)
+
+		return
+	}
+
+	before, _ := h.appUseCase.CheckPostById(id, nil)
+
+	post, err = h.appUseCase.EditPost(id, post.Message, version, viewerNickname(request))
+	if writeBanError(writer, err) || writeFilterError(writer, err) {
+		return
+	}
+	if err == models.ErrVersionMismatch {
+		writePreconditionFailed(writer)
+
+		return
+	}
 	if err != nil {
 		body, err := errorMarshal("can't find something")
 		if err != nil {
@@ -851,6 +1270,12 @@ func (h AppHandler) PostDetails(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
+	h.audit(request, "post.edit", "post", strconv.Itoa(id), before["post"], post)
+
+	writer.Header().Set("ETag", etag(post.Version))
+
+	h.renderPost(request, &post)
+
 	body, err := json.Marshal(post)
 	if err != nil {
 		return
@@ -887,7 +1312,10 @@ func (h AppHandler) ThreadPosts(writer http.ResponseWriter, request *http.Reques
 		thread.Id = id
 	}
 
-	posts, err := h.appUseCase.CheckPostsByThread(thread, limit, since, sort, desc)
+	posts, err := h.appUseCase.CheckPostsByThread(thread, limit, since, sort, desc, viewerNickname(request))
+	if err == nil && len(posts) > 0 && !h.forumReadable(writer, request, posts[0].Forum) {
+		return
+	}
 	if err != nil {
 		body, err := errorMarshal("can't find something this")
 		if err != nil {
@@ -940,6 +1368,24 @@ func (h AppHandler) ThreadPosts(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
+	if wantsAnswerFirst(request) {
+		// Pages of parent trees are counted in root posts.
+		pageSize := limit
+		if sort == "parent_tree" {
+			pageSize = 0
+		}
+
+		posts, err = h.appUseCase.AcceptedAnswerFirst(posts, since, pageSize, viewerNickname(request))
+		if err != nil {
+			writeError(writer, http.StatusNotFound, "Can't find accepted answer")
+
+			return
+		}
+	}
+
+	posts = h.mutePosts(request, posts)
+	h.renderPosts(request, posts)
+
 	body, err := json.Marshal(posts)
 	if err != nil {
 		return
@@ -948,3 +1394,84 @@ func (h AppHandler) ThreadPosts(writer http.ResponseWriter, request *http.Reques
 	writer.WriteHeader(http.StatusOK)
 	writer.Write(body)
 }
+
+func (h AppHandler) UserThreads(writer http.ResponseWriter, request *http.Request) {
+	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/threads")
+	parameters := parseQueryParameters(request, 100)
+
+	threads, err := h.appUseCase.CheckThreadsByAuthor(nickname, parameters)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad query parameters")
+
+		return
+	}
+
+	if len(threads) == 0 {
+		if _, err := h.appUseCase.CheckUserByNickname(nickname); err != nil {
+			writeError(writer, http.StatusNotFound, "Can't find user")
+
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, []int{})
+
+		return
+	}
+
+	h.renderThreads(request, threads)
+
+	result := make([]interface{}, 0, len(threads))
+	for _, thr := range threads {
+		result = append(result, threadView(thr))
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) UserPosts(writer http.ResponseWriter, request *http.Request) {
+	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/posts")
+	parameters := parseQueryParameters(request, 100)
+
+	posts, err := h.appUseCase.CheckPostsByAuthor(nickname, parameters)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad query parameters")
+
+		return
+	}
+
+	if len(posts) == 0 {
+		if _, err := h.appUseCase.CheckUserByNickname(nickname); err != nil {
+			writeError(writer, http.StatusNotFound, "Can't find user")
+
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, []int{})
+
+		return
+	}
+
+	h.renderPosts(request, posts)
+
+	writeJSON(writer, http.StatusOK, posts)
+}
+
+func (h AppHandler) TrendingThreads(writer http.ResponseWriter, request *http.Request) {
+	parameters := parseQueryParameters(request, 20)
+
+	threads, err := h.appUseCase.CheckTrendingThreads(parameters)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad query parameters")
+
+		return
+	}
+
+	h.renderThreads(request, threads)
+
+	result := make([]interface{}, 0, len(threads))
+	for _, thr := range threads {
+		result = append(result, threadView(thr))
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
@@ -0,0 +1,140 @@
+package delivery
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (h AppHandler) UploadAttachments(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/post/"), "/attachments"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find post")
+
+		return
+	}
+
+	// Leave room for the multipart framing around a file of the maximum size.
+	request.Body = http.MaxBytesReader(writer, request.Body, configs.StorageConfig.MaxSize+1<<20)
+	if err := request.ParseMultipartForm(configs.StorageConfig.MaxSize); err != nil {
+		writeError(writer, http.StatusRequestEntityTooLarge, "Attachment is too large")
+
+		return
+	}
+	defer request.MultipartForm.RemoveAll()
+
+	files := request.MultipartForm.File["file"]
+	if len(files) == 0 {
+		writeError(writer, http.StatusBadRequest, "No file in request")
+
+		return
+	}
+
+	uploads := make([]models.Upload, 0, len(files))
+	for _, header := range files {
+		if header.Size > configs.StorageConfig.MaxSize {
+			writeError(writer, http.StatusRequestEntityTooLarge, "Attachment is too large")
+
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Can't read file")
+
+			return
+		}
+
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Can't read file")
+
+			return
+		}
+
+		uploads = append(uploads, models.Upload{Name: header.Filename, Data: data})
+	}
+
+	attachments, err := h.appUseCase.AddAttachments(id, uploads, viewerNickname(request))
+	if writeBanError(writer, err) {
+		return
+	}
+	if err != nil {
+		switch err {
+		case models.ErrForbidden:
+			writeError(writer, http.StatusForbidden, "Only the author or a moderator can attach files")
+		case models.ErrAttachmentTooLarge:
+			writeError(writer, http.StatusRequestEntityTooLarge, "Attachment is too large")
+		case models.ErrAttachmentType:
+			writeError(writer, http.StatusUnsupportedMediaType, "Attachment type is not allowed")
+		default:
+			writeError(writer, http.StatusNotFound, "Can't find post")
+		}
+
+		return
+	}
+
+	writeJSON(writer, http.StatusCreated, attachments)
+}
+
+func (h AppHandler) AttachmentContent(writer http.ResponseWriter, request *http.Request) {
+	path := strings.TrimPrefix(request.URL.Path, "/api/attachment/")
+	thumbnail := strings.HasSuffix(path, "/thumbnail")
+
+	id, err := strconv.Atoi(strings.TrimSuffix(path, "/thumbnail"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find attachment")
+
+		return
+	}
+
+	attachment, err := h.appUseCase.CheckAttachmentById(id)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find attachment")
+
+		return
+	}
+
+	if data, err := h.appUseCase.CheckPostById(attachment.Post, nil); err == nil {
+		if post, ok := data["post"].(models.Post); ok && !h.forumReadable(writer, request, post.Forum) {
+			return
+		}
+	}
+
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			writeError(writer, http.StatusNotFound, "Attachment has no thumbnail")
+
+			return
+		}
+
+		key, contentType = attachment.ThumbnailKey, "image/png"
+	}
+
+	content, err := h.appUseCase.OpenAttachment(key)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find attachment")
+
+		return
+	}
+
+	defer content.Close()
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	if !thumbnail {
+		writer.Header().Set("Content-Length", fmt.Sprint(attachment.Size))
+		writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	io.Copy(writer, content)
+}
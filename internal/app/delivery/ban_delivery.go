@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// writeBanError answers with the ban details when the error is a BanError and
+// reports whether it did.
+func writeBanError(writer http.ResponseWriter, err error) bool {
+	banErr, ok := err.(*models.BanError)
+	if !ok {
+		return false
+	}
+
+	writeJSON(writer, http.StatusForbidden, models.BanResponse{
+		Message: "User is banned",
+		Reason:  banErr.Ban.Reason,
+		Forum:   banErr.Ban.Forum,
+		Expires: banErr.Ban.Expires,
+	})
+
+	return true
+}
+
+func (h AppHandler) ForumBans(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/bans")
+
+	h.bans(writer, request, slug)
+}
+
+func (h AppHandler) GlobalBans(writer http.ResponseWriter, request *http.Request) {
+	h.bans(writer, request, "")
+}
+
+func (h AppHandler) bans(writer http.ResponseWriter, request *http.Request, forum string) {
+	if request.Method == http.MethodPost {
+		var ban models.Ban
+		err := json.NewDecoder(request.Body).Decode(&ban)
+		if err != nil || ban.Nickname == "" {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		ban.Forum = forum
+		ban.CreatedBy = viewerNickname(request)
+
+		result, err := h.appUseCase.CreateBan(ban)
+		if err != nil {
+			writeModerationError(writer, err)
+
+			return
+		}
+
+		h.audit(request, "ban.create", "user", result.Nickname, nil, result)
+
+		writeJSON(writer, http.StatusCreated, result)
+
+		return
+	}
+
+	bans, err := h.appUseCase.CheckBans(forum, viewerNickname(request), parseQueryParameters(request, 100))
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	if bans == nil {
+		bans = []models.Ban{}
+	}
+
+	writeJSON(writer, http.StatusOK, bans)
+}
+
+func (h AppHandler) LiftBan(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(request.URL.Path, "/api/ban/"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find ban")
+
+		return
+	}
+
+	ban, err := h.appUseCase.LiftBan(id, viewerNickname(request))
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "ban.lift", "user", ban.Nickname, ban, nil)
+
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,223 @@
+package delivery
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writeBlockError(writer http.ResponseWriter, err error) bool {
+	if err != models.ErrUserBlocked {
+		return false
+	}
+
+	writeError(writer, http.StatusForbidden, err.Error())
+
+	return true
+}
+
+func writeUserListError(writer http.ResponseWriter, err error) {
+	if err == models.ErrForbidden {
+		writeError(writer, http.StatusForbidden, "Forbidden")
+
+		return
+	}
+
+	if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23503" {
+		writeError(writer, http.StatusNotFound, "Can't find user")
+
+		return
+	}
+
+	writeError(writer, http.StatusBadRequest, "Bad request")
+}
+
+// muteMode tells how content of muted authors is shown: collapsed by default
+// or omitted on request.
+func muteMode(request *http.Request) string {
+	mode := request.URL.Query().Get("muted")
+	if !models.IsMuteMode(mode) {
+		return models.MuteModeCollapse
+	}
+
+	return mode
+}
+
+// hiddenAuthors returns the authors muted or blocked by the viewer. Listings
+// are still served when the lists can't be loaded.
+func (h AppHandler) hiddenAuthors(request *http.Request) map[string]bool {
+	hidden, err := h.appUseCase.CheckHiddenAuthors(viewerNickname(request))
+	if err != nil {
+		log.Printf("mutes of %s: %s", viewerNickname(request), err.Error())
+	}
+
+	return hidden
+}
+
+// mutePosts collapses or omits the posts of authors hidden from the viewer.
+func (h AppHandler) mutePosts(request *http.Request, posts []models.Post) []models.Post {
+	hidden := h.hiddenAuthors(request)
+	if len(hidden) == 0 {
+		return posts
+	}
+
+	omit := muteMode(request) == models.MuteModeOmit
+	result := posts[:0]
+	for _, post := range posts {
+		if hidden[strings.ToLower(post.Author)] {
+			if omit {
+				continue
+			}
+
+			post.Message = ""
+			post.Attachments = nil
+			post.Collapsed = true
+		}
+
+		result = append(result, post)
+	}
+
+	return result
+}
+
+// muteThreads collapses or omits the threads of authors hidden from the viewer.
+func (h AppHandler) muteThreads(request *http.Request, threads []models.Thread) []models.Thread {
+	hidden := h.hiddenAuthors(request)
+	if len(hidden) == 0 {
+		return threads
+	}
+
+	omit := muteMode(request) == models.MuteModeOmit
+	result := threads[:0]
+	for _, thread := range threads {
+		if hidden[strings.ToLower(thread.Author)] {
+			if omit {
+				continue
+			}
+
+			thread.Message = ""
+			thread.Collapsed = true
+		}
+
+		result = append(result, thread)
+	}
+
+	return result
+}
+
+func (h AppHandler) UserBlocks(writer http.ResponseWriter, request *http.Request) {
+	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/blocks")
+
+	if request.Method == http.MethodPost {
+		var blocked models.User
+		err := json.NewDecoder(request.Body).Decode(&blocked)
+		if err != nil || blocked.Nickname == "" {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		block, err := h.appUseCase.BlockUser(nickname, blocked.Nickname, viewerNickname(request))
+		if err != nil {
+			writeUserListError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, block)
+
+		return
+	}
+
+	blocks, err := h.appUseCase.CheckUserBlocks(nickname, viewerNickname(request))
+	if err != nil {
+		writeUserListError(writer, err)
+
+		return
+	}
+
+	if blocks == nil {
+		blocks = []models.UserBlock{}
+	}
+
+	writeJSON(writer, http.StatusOK, blocks)
+}
+
+func (h AppHandler) UnblockUser(writer http.ResponseWriter, request *http.Request) {
+	nickname, blocked, found := strings.Cut(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/block/")
+	if !found {
+		writeError(writer, http.StatusNotFound, "Can't find block")
+
+		return
+	}
+
+	err := h.appUseCase.UnblockUser(nickname, blocked, viewerNickname(request))
+	if err != nil {
+		writeUserListError(writer, err)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h AppHandler) UserMutes(writer http.ResponseWriter, request *http.Request) {
+	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/mutes")
+
+	if request.Method == http.MethodPost {
+		var muted models.User
+		err := json.NewDecoder(request.Body).Decode(&muted)
+		if err != nil || muted.Nickname == "" {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		mute, err := h.appUseCase.MuteUser(nickname, muted.Nickname, viewerNickname(request))
+		if err != nil {
+			writeUserListError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, mute)
+
+		return
+	}
+
+	mutes, err := h.appUseCase.CheckUserMutes(nickname, viewerNickname(request))
+	if err != nil {
+		writeUserListError(writer, err)
+
+		return
+	}
+
+	if mutes == nil {
+		mutes = []models.UserMute{}
+	}
+
+	writeJSON(writer, http.StatusOK, mutes)
+}
+
+func (h AppHandler) UnmuteUser(writer http.ResponseWriter, request *http.Request) {
+	nickname, muted, found := strings.Cut(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/mute/")
+	if !found {
+		writeError(writer, http.StatusNotFound, "Can't find mute")
+
+		return
+	}
+
+	err := h.appUseCase.UnmuteUser(nickname, muted, viewerNickname(request))
+	if err != nil {
+		writeUserListError(writer, err)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
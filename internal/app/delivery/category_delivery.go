@@ -0,0 +1,142 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writeCategoryError(writer http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Forbidden")
+	case models.ErrBadCategory, models.ErrBadPlacement:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find category or forum")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23503" {
+			writeError(writer, http.StatusNotFound, "Can't find category or forum")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) Categories(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPost {
+		var category models.Category
+		err := json.NewDecoder(request.Body).Decode(&category)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		result, err := h.appUseCase.CreateCategory(category, viewerNickname(request))
+		if err != nil {
+			writeCategoryError(writer, err)
+
+			return
+		}
+
+		h.audit(request, "category.create", "category", strconv.Itoa(result.Id), nil, result)
+
+		writeJSON(writer, http.StatusCreated, result)
+
+		return
+	}
+
+	categories, err := h.appUseCase.CheckCategoryTree()
+	if err != nil {
+		writeCategoryError(writer, err)
+
+		return
+	}
+
+	if categories == nil {
+		categories = []models.Category{}
+	}
+
+	writeJSON(writer, http.StatusOK, categories)
+}
+
+func (h AppHandler) CategoryDetails(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/category/"), "/details"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find category")
+
+		return
+	}
+
+	if request.Method == http.MethodGet {
+		category, err := h.appUseCase.CheckCategory(id)
+		if err != nil {
+			writeCategoryError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, category)
+
+		return
+	}
+
+	var category models.Category
+	err = json.NewDecoder(request.Body).Decode(&category)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	category.Id = id
+
+	before, err := h.appUseCase.CheckCategory(id)
+	if err != nil {
+		writeCategoryError(writer, err)
+
+		return
+	}
+
+	result, err := h.appUseCase.EditCategory(category, viewerNickname(request))
+	if err != nil {
+		writeCategoryError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "category.edit", "category", strconv.Itoa(id), before, result)
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) ForumPlacement(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/placement")
+
+	var placement models.ForumPlacement
+	err := json.NewDecoder(request.Body).Decode(&placement)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	result, err := h.appUseCase.PlaceForum(slug, placement, viewerNickname(request))
+	if err != nil {
+		writeCategoryError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "forum.placement", "forum", result.Slug, nil, placement)
+
+	writeJSON(writer, http.StatusOK, result)
+}
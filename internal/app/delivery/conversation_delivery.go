@@ -0,0 +1,193 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writeConversationError(writer http.ResponseWriter, err error) {
+	if writeBanError(writer, err) || writeBlockError(writer, err) {
+		return
+	}
+
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Forbidden")
+	case models.ErrBadConversation:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case models.ErrMessageNotInConversation:
+		writeError(writer, http.StatusConflict, err.Error())
+	case models.ErrNotParticipant, pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find conversation")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23503" {
+			writeError(writer, http.StatusNotFound, "Can't find user")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) Conversations(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPost {
+		var conversation models.Conversation
+		err := json.NewDecoder(request.Body).Decode(&conversation)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		conversation.CreatedBy = viewerNickname(request)
+
+		result, err := h.appUseCase.CreateConversation(conversation)
+		if err != nil {
+			writeConversationError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, result)
+
+		return
+	}
+
+	conversations, err := h.appUseCase.CheckConversations(viewerNickname(request), parseQueryParameters(request, 100))
+	if err != nil {
+		writeConversationError(writer, err)
+
+		return
+	}
+
+	if conversations == nil {
+		conversations = []models.Conversation{}
+	}
+
+	writeJSON(writer, http.StatusOK, conversations)
+}
+
+func (h AppHandler) ConversationDetails(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/conversation/"), "/details"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find conversation")
+
+		return
+	}
+
+	conversation, err := h.appUseCase.CheckConversation(id, viewerNickname(request))
+	if err != nil {
+		writeConversationError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, conversation)
+}
+
+func (h AppHandler) ConversationMessages(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/conversation/"), "/messages"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find conversation")
+
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		var message models.ConversationMessage
+		err := json.NewDecoder(request.Body).Decode(&message)
+		if err != nil || message.Message == "" {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		message.Conversation = id
+		message.Author = viewerNickname(request)
+
+		result, err := h.appUseCase.SendMessage(message)
+		if err != nil {
+			writeConversationError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, result)
+
+		return
+	}
+
+	messages, err := h.appUseCase.CheckConversationMessages(id, viewerNickname(request), parseQueryParameters(request, 100))
+	if err != nil {
+		writeConversationError(writer, err)
+
+		return
+	}
+
+	if messages == nil {
+		messages = []models.ConversationMessage{}
+	}
+
+	writeJSON(writer, http.StatusOK, messages)
+}
+
+func (h AppHandler) ReadConversation(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/conversation/"), "/read"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find conversation")
+
+		return
+	}
+
+	var marker struct {
+		Message int `json:"message"`
+	}
+	err = json.NewDecoder(request.Body).Decode(&marker)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	unread, err := h.appUseCase.MarkConversationRead(id, viewerNickname(request), marker.Message)
+	if err != nil {
+		writeConversationError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, map[string]int{"conversation": id, "unread": unread})
+}
+
+func (h AppHandler) MessageDetails(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/message/"), "/details"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find message")
+
+		return
+	}
+
+	var message models.ConversationMessage
+	err = json.NewDecoder(request.Body).Decode(&message)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	result, err := h.appUseCase.EditConversationMessage(id, message.Message, viewerNickname(request))
+	if err != nil {
+		writeConversationError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
@@ -0,0 +1,143 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+// writeFilterError answers with the rejecting rule when the error is a
+// FilterError and reports whether it did.
+func writeFilterError(writer http.ResponseWriter, err error) bool {
+	filterErr, ok := err.(*models.FilterError)
+	if !ok {
+		return false
+	}
+
+	writeJSON(writer, http.StatusUnprocessableEntity, map[string]interface{}{
+		"message": "Message rejected by content filter",
+		"rule":    filterErr.Rule.Id,
+		"kind":    filterErr.Rule.Kind,
+	})
+
+	return true
+}
+
+func writeAdminError(writer http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Only administrators can do this")
+	case models.ErrBadFilter:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find something")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23503" {
+			writeError(writer, http.StatusNotFound, "Can't find forum or user")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) FilterRules(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPost {
+		var rule models.FilterRule
+		err := json.NewDecoder(request.Body).Decode(&rule)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		rule.CreatedBy = viewerNickname(request)
+
+		result, err := h.appUseCase.CreateFilterRule(rule)
+		if err != nil {
+			writeAdminError(writer, err)
+
+			return
+		}
+
+		h.audit(request, "filter.create", "filter", strconv.Itoa(result.Id), nil, result)
+
+		writeJSON(writer, http.StatusCreated, result)
+
+		return
+	}
+
+	rules, err := h.appUseCase.CheckFilterRules(request.URL.Query().Get("forum"), viewerNickname(request))
+	if err != nil {
+		writeAdminError(writer, err)
+
+		return
+	}
+
+	if rules == nil {
+		rules = []models.FilterRule{}
+	}
+
+	writeJSON(writer, http.StatusOK, rules)
+}
+
+func (h AppHandler) DeleteFilterRule(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(request.URL.Path, "/api/admin/filter/"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find filter")
+
+		return
+	}
+
+	err = h.appUseCase.RemoveFilterRule(id, viewerNickname(request))
+	if err != nil {
+		writeAdminError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "filter.delete", "filter", strconv.Itoa(id), nil, nil)
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h AppHandler) FilterHits(writer http.ResponseWriter, request *http.Request) {
+	hits, err := h.appUseCase.CheckFilterHits(viewerNickname(request), parseQueryParameters(request, 100))
+	if err != nil {
+		writeAdminError(writer, err)
+
+		return
+	}
+
+	if hits == nil {
+		hits = []models.FilterHit{}
+	}
+
+	writeJSON(writer, http.StatusOK, hits)
+}
+
+// TestFilters shows what the filters would do to a message, recording nothing.
+func (h AppHandler) TestFilters(writer http.ResponseWriter, request *http.Request) {
+	var check models.FilterCheck
+	err := json.NewDecoder(request.Body).Decode(&check)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	result, err := h.appUseCase.TestFilters(check, viewerNickname(request))
+	if err != nil {
+		writeAdminError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
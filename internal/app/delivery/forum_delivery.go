@@ -0,0 +1,123 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writeForumError(writer http.ResponseWriter, err error) {
+	if writeBanError(writer, err) || writeAccessError(writer, err) {
+		return
+	}
+
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Forbidden")
+	case models.ErrBadDeleteMode:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case models.ErrVersionMismatch:
+		writePreconditionFailed(writer)
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find forum")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23503" {
+			writeError(writer, http.StatusNotFound, "Can't find user")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) Forums(writer http.ResponseWriter, request *http.Request) {
+	parameters := parseQueryParameters(request, 100)
+	if !models.IsForumSort(parameters.Sort) {
+		writeError(writer, http.StatusBadRequest, "Unknown sort")
+
+		return
+	}
+
+	forums, err := h.appUseCase.CheckForums(parameters)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad query parameters")
+
+		return
+	}
+
+	if forums == nil {
+		forums = []models.Forum{}
+	}
+
+	writeJSON(writer, http.StatusOK, forums)
+}
+
+// editForum serves POST /api/forum/{slug}/details.
+func (h AppHandler) editForum(writer http.ResponseWriter, request *http.Request, slug string) {
+	var forum models.Forum
+	err := json.NewDecoder(request.Body).Decode(&forum)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	before, err := h.appUseCase.CheckForumBySlug(slug)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find forum")
+
+		return
+	}
+
+	forum.Slug = before.Slug
+
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		writePreconditionFailed(writer)
+
+		return
+	}
+	forum.Version = version
+
+	result, err := h.appUseCase.EditForum(forum, viewerNickname(request))
+	if err != nil {
+		writeForumError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "forum.edit", "forum", result.Slug, before, result)
+
+	writer.Header().Set("ETag", etag(result.Version))
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) DeleteForum(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/details")
+	mode := request.URL.Query().Get("mode")
+
+	forum, err := h.appUseCase.DeleteForum(slug, mode, viewerNickname(request))
+	if err != nil {
+		writeForumError(writer, err)
+
+		return
+	}
+
+	if mode == models.ForumDeleteArchive {
+		h.audit(request, "forum.archive", "forum", forum.Slug, nil, forum)
+
+		writeJSON(writer, http.StatusOK, forum)
+
+		return
+	}
+
+	h.audit(request, "forum.delete", "forum", forum.Slug, forum, nil)
+
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,222 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// writeAccessError answers 403 when the error denies access to a forum and
+// reports whether it did.
+func writeAccessError(writer http.ResponseWriter, err error) bool {
+	switch err {
+	case models.ErrForumPrivate:
+		writeError(writer, http.StatusForbidden, "Forum is private")
+	case models.ErrNotMember:
+		writeError(writer, http.StatusForbidden, "Only forum members can post here")
+	case models.ErrForumArchived:
+		writeError(writer, http.StatusForbidden, "Forum is archived")
+	default:
+		return false
+	}
+
+	return true
+}
+
+func writeMembershipError(writer http.ResponseWriter, err error) {
+	if writeAccessError(writer, err) {
+		return
+	}
+
+	switch err {
+	case models.ErrBadVisibility, models.ErrBadInvitation:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case models.ErrJoinRequestDecided:
+		writeError(writer, http.StatusConflict, err.Error())
+	default:
+		writeModerationError(writer, err)
+	}
+}
+
+// forumReadable answers 403 and returns false when the forum is private and
+// the caller is not its member. Missing forums are left to the caller.
+func (h AppHandler) forumReadable(writer http.ResponseWriter, request *http.Request, forum string) bool {
+	err := h.appUseCase.CheckForumAccess(forum, viewerNickname(request))
+
+	return !writeAccessError(writer, err)
+}
+
+func (h AppHandler) ForumVisibility(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/visibility")
+
+	var forum models.Forum
+	err := json.NewDecoder(request.Body).Decode(&forum)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	result, err := h.appUseCase.SetForumVisibility(slug, forum.Visibility, viewerNickname(request))
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "forum.visibility", "forum", result.Slug, nil, result.Visibility)
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) JoinForum(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/join")
+
+	var joinRequest models.JoinRequest
+	err := json.NewDecoder(request.Body).Decode(&joinRequest)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	joinRequest.Forum = slug
+	if joinRequest.Nickname == "" {
+		joinRequest.Nickname = viewerNickname(request)
+	}
+
+	result, err := h.appUseCase.JoinForum(joinRequest)
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusCreated, result)
+}
+
+func (h AppHandler) ForumJoinRequests(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/requests")
+	parameters := parseQueryParameters(request, 100)
+
+	requests, err := h.appUseCase.CheckJoinRequests(slug, viewerNickname(request), request.URL.Query().Get("status"), parameters)
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	if requests == nil {
+		requests = []models.JoinRequest{}
+	}
+
+	writeJSON(writer, http.StatusOK, requests)
+}
+
+func (h AppHandler) DecideJoinRequest(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/join-request/"), "/decide"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find join request")
+
+		return
+	}
+
+	var decision models.JoinDecision
+	err = json.NewDecoder(request.Body).Decode(&decision)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+	decision.Actor = viewerNickname(request)
+
+	result, err := h.appUseCase.DecideJoinRequest(id, decision)
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "member.decide", "join_request", strconv.Itoa(id), nil, result)
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) CreateInvitation(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/invitations")
+
+	var invitation models.Invitation
+	err := json.NewDecoder(request.Body).Decode(&invitation)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	invitation.Forum = slug
+	invitation.CreatedBy = viewerNickname(request)
+
+	result, err := h.appUseCase.CreateInvitation(invitation)
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusCreated, result)
+}
+
+func (h AppHandler) AcceptInvitation(writer http.ResponseWriter, request *http.Request) {
+	token := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/invitation/"), "/accept")
+
+	member, err := h.appUseCase.AcceptInvitation(token, viewerNickname(request))
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, member)
+}
+
+func (h AppHandler) ForumMembers(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/members")
+	parameters := parseQueryParameters(request, 100)
+
+	members, err := h.appUseCase.CheckForumMembers(slug, viewerNickname(request), parameters)
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	if members == nil {
+		members = []models.ForumMember{}
+	}
+
+	writeJSON(writer, http.StatusOK, members)
+}
+
+func (h AppHandler) RemoveForumMember(writer http.ResponseWriter, request *http.Request) {
+	path := strings.TrimPrefix(request.URL.Path, "/api/forum/")
+	slug, nickname, found := strings.Cut(path, "/member/")
+	if !found {
+		writeError(writer, http.StatusNotFound, "Can't find member")
+
+		return
+	}
+
+	err := h.appUseCase.RemoveForumMember(slug, nickname, viewerNickname(request))
+	if err != nil {
+		writeMembershipError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "member.remove", "forum", slug, nickname, nil)
+
+	writer.WriteHeader(http.StatusNoContent)
+}
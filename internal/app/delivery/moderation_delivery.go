@@ -0,0 +1,157 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writeModerationError(writer http.ResponseWriter, err error) {
+	if writeBanError(writer, err) {
+		return
+	}
+
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Only forum moderators can do this")
+	case models.ErrBadReport, models.ErrBadAction:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case models.ErrReportResolved:
+		writeError(writer, http.StatusConflict, err.Error())
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find something")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23503" {
+			writeError(writer, http.StatusNotFound, "Can't find user")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) CreateReport(writer http.ResponseWriter, request *http.Request) {
+	var report models.Report
+	err := json.NewDecoder(request.Body).Decode(&report)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	if report.Reporter == "" {
+		report.Reporter = viewerNickname(request)
+	}
+
+	result, err := h.appUseCase.CreateReport(report)
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusCreated, result)
+}
+
+func (h AppHandler) ResolveReport(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/report/"), "/resolve"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find report")
+
+		return
+	}
+
+	var action models.ModerationAction
+	err = json.NewDecoder(request.Body).Decode(&action)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+	action.Moderator = viewerNickname(request)
+
+	report, err := h.appUseCase.ResolveReport(id, action)
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "report.resolve", "report", strconv.Itoa(id), nil, report)
+
+	writeJSON(writer, http.StatusOK, report)
+}
+
+func (h AppHandler) ForumReports(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/reports")
+	parameters := parseQueryParameters(request, 100)
+
+	reports, err := h.appUseCase.CheckForumReports(slug, viewerNickname(request), request.URL.Query().Get("status"), parameters)
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	if reports == nil {
+		reports = []models.Report{}
+	}
+
+	writeJSON(writer, http.StatusOK, reports)
+}
+
+func (h AppHandler) ForumModerationLog(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/moderation/log")
+	parameters := parseQueryParameters(request, 100)
+
+	entries, err := h.appUseCase.CheckModerationLog(slug, viewerNickname(request), parameters)
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	if entries == nil {
+		entries = []models.ModerationLogEntry{}
+	}
+
+	writeJSON(writer, http.StatusOK, entries)
+}
+
+func (h AppHandler) ForumModerators(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/moderators")
+
+	if request.Method == http.MethodPost {
+		var moderator models.User
+		err := json.NewDecoder(request.Body).Decode(&moderator)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		err = h.appUseCase.AddForumModerator(slug, moderator.Nickname, viewerNickname(request))
+		if err != nil {
+			writeModerationError(writer, err)
+
+			return
+		}
+
+		h.audit(request, "moderator.add", "forum", slug, nil, moderator.Nickname)
+	}
+
+	moderators, err := h.appUseCase.CheckForumModerators(slug)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find forum")
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, moderators)
+}
@@ -0,0 +1,133 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writePollError(writer http.ResponseWriter, err error) {
+	if writeBanError(writer, err) || writeAccessError(writer, err) {
+		return
+	}
+
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Forbidden")
+	case models.ErrBadPoll, models.ErrBadPollVote:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case models.ErrPollClosed:
+		writeError(writer, http.StatusConflict, err.Error())
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find thread or poll")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" {
+			writeError(writer, http.StatusConflict, "Thread already has a poll")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+// threadId resolves the slug or id of a thread from the request path.
+func (h AppHandler) threadId(slugOrId string) (int, error) {
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		return h.appUseCase.CheckThreadIdBySlug(slugOrId)
+	}
+
+	return id, nil
+}
+
+// threadPoll returns the poll of the thread for the viewer, if there is one.
+func (h AppHandler) threadPoll(request *http.Request, thread int) *models.Poll {
+	poll, err := h.appUseCase.CheckPoll(thread, viewerNickname(request))
+	if err != nil {
+		return nil
+	}
+
+	return &poll
+}
+
+func (h AppHandler) ThreadPoll(writer http.ResponseWriter, request *http.Request) {
+	id, err := h.threadId(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/thread/"), "/poll"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find thread")
+
+		return
+	}
+
+	if request.Method == http.MethodPost {
+		var poll models.Poll
+		err := json.NewDecoder(request.Body).Decode(&poll)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "Bad request body")
+
+			return
+		}
+
+		result, err := h.appUseCase.CreatePoll(id, poll, viewerNickname(request))
+		if err != nil {
+			writePollError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, result)
+
+		return
+	}
+
+	thread, err := h.appUseCase.CheckThreadById(id)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find thread")
+
+		return
+	}
+
+	if !h.forumReadable(writer, request, thread.Forum) {
+		return
+	}
+
+	poll, err := h.appUseCase.CheckPoll(id, viewerNickname(request))
+	if err != nil {
+		writePollError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, poll)
+}
+
+func (h AppHandler) VotePoll(writer http.ResponseWriter, request *http.Request) {
+	id, err := h.threadId(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/thread/"), "/poll/vote"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find thread")
+
+		return
+	}
+
+	var vote models.PollVote
+	err = json.NewDecoder(request.Body).Decode(&vote)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	poll, err := h.appUseCase.VotePoll(id, viewerNickname(request), vote)
+	if err != nil {
+		writePollError(writer, err)
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, poll)
+}
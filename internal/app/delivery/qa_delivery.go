@@ -0,0 +1,92 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func writeQAError(writer http.ResponseWriter, err error) {
+	if writeBanError(writer, err) || writeAccessError(writer, err) {
+		return
+	}
+
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Forbidden")
+	case models.ErrNotQAForum:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case models.ErrPostNotInThread:
+		writeError(writer, http.StatusConflict, "Post is from different thread")
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find thread or post")
+	default:
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) ForumQA(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/qa")
+
+	var forum models.Forum
+	err := json.NewDecoder(request.Body).Decode(&forum)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	result, err := h.appUseCase.SetForumQA(slug, forum.QA, viewerNickname(request))
+	if err != nil {
+		writeModerationError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "forum.qa", "forum", result.Slug, nil, map[string]bool{"qa": result.QA})
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) AcceptAnswer(writer http.ResponseWriter, request *http.Request) {
+	id, err := h.threadId(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/thread/"), "/answer"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find thread")
+
+		return
+	}
+
+	var answer models.AcceptedAnswer
+	err = json.NewDecoder(request.Body).Decode(&answer)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	thread, err := h.appUseCase.AcceptAnswer(id, answer, viewerNickname(request))
+	if err != nil {
+		writeQAError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "thread.answer", "thread", strconv.Itoa(thread.Id), nil, answer)
+
+	h.renderThread(request, &thread)
+
+	writeJSON(writer, http.StatusOK, threadView(thread))
+}
+
+// wantsAnswerFirst reports whether the client asked for the accepted answer
+// at the top of the first page of posts and out of the later ones.
+func wantsAnswerFirst(request *http.Request) bool {
+	first, err := strconv.ParseBool(request.URL.Query().Get("answerFirst"))
+
+	return err == nil && first
+}
@@ -0,0 +1,229 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/app"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx"
+)
+
+func writeRenameError(writer http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrForbidden:
+		writeError(writer, http.StatusForbidden, "Forbidden")
+	case models.ErrBadName:
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case pgx.ErrNoRows:
+		writeError(writer, http.StatusNotFound, "Can't find forum, thread or user")
+	default:
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" {
+			writeError(writer, http.StatusConflict, "Name is already taken")
+
+			return
+		}
+
+		writeError(writer, http.StatusBadRequest, "Bad request")
+	}
+}
+
+func (h AppHandler) RenameForum(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/rename")
+
+	var rename models.Rename
+	err := json.NewDecoder(request.Body).Decode(&rename)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	forum, err := h.appUseCase.RenameForum(slug, rename, viewerNickname(request))
+	if err != nil {
+		writeRenameError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "forum.rename", "forum", forum.Slug, slug, forum.Slug)
+
+	writeJSON(writer, http.StatusOK, forum)
+}
+
+func (h AppHandler) RenameThread(writer http.ResponseWriter, request *http.Request) {
+	id, err := h.threadId(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/thread/"), "/rename"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find thread")
+
+		return
+	}
+
+	var rename models.Rename
+	err = json.NewDecoder(request.Body).Decode(&rename)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	before, _ := h.appUseCase.CheckThreadById(id)
+
+	thread, err := h.appUseCase.RenameThread(id, rename, viewerNickname(request))
+	if err != nil {
+		writeRenameError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "thread.rename", "thread", strconv.Itoa(thread.Id), before.Slug, thread.Slug)
+
+	h.renderThread(request, &thread)
+
+	writeJSON(writer, http.StatusOK, thread)
+}
+
+func (h AppHandler) RenameUser(writer http.ResponseWriter, request *http.Request) {
+	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/rename")
+
+	var rename models.Rename
+	err := json.NewDecoder(request.Body).Decode(&rename)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	user, err := h.appUseCase.RenameUser(nickname, rename, viewerNickname(request))
+	if err != nil {
+		writeRenameError(writer, err)
+
+		return
+	}
+
+	h.audit(request, "user.rename", "user", user.Nickname, nickname, user.Nickname)
+
+	writeJSON(writer, http.StatusOK, user)
+}
+
+// renamedVars maps the route variables naming a forum, thread or user to the
+// kind of the name.
+var renamedVars = map[string]string{
+	"slug":       models.RenameKindForum,
+	"slug_or_id": models.RenameKindThread,
+	"nickname":   models.RenameKindUser,
+	"blocked":    models.RenameKindUser,
+	"muted":      models.RenameKindUser,
+}
+
+// RenameRedirectMiddleware answers 308 with the current location when the
+// route names a forum, thread or user by a name it had before a rename. The
+// history is only looked up once the handler can't find the name, so that
+// requests naming things by their current names don't pay for it.
+func RenameRedirectMiddleware(appUseCase app.UseCase) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			route := mux.CurrentRoute(request)
+			if route == nil {
+				next.ServeHTTP(writer, request)
+
+				return
+			}
+
+			held := &notFoundWriter{ResponseWriter: writer}
+			next.ServeHTTP(held, request)
+			if !held.notFound {
+				return
+			}
+
+			location, ok := renamedLocation(appUseCase, route, request)
+			if !ok {
+				held.flush()
+
+				return
+			}
+
+			writer.Header().Set("Location", location.String())
+			writeError(writer, http.StatusPermanentRedirect, "Moved to "+location.Path)
+		})
+	}
+}
+
+// renamedLocation is the path of the route with the old names in it replaced
+// by the current ones. ok is false when no name was renamed.
+func renamedLocation(appUseCase app.UseCase, route *mux.Route, request *http.Request) (*url.URL, bool) {
+	moved := false
+	var pairs []string
+	for name, value := range mux.Vars(request) {
+		kind, ok := renamedVars[name]
+		if _, err := strconv.Atoi(value); kind == models.RenameKindThread && err == nil {
+			// Thread ids never change.
+			ok = false
+		}
+
+		if ok {
+			if current, err := appUseCase.ResolveRename(kind, value); err == nil {
+				value, moved = current, true
+			}
+		}
+
+		pairs = append(pairs, name, value)
+	}
+
+	if !moved {
+		return nil, false
+	}
+
+	location, err := route.URLPath(pairs...)
+	if err != nil {
+		return nil, false
+	}
+	location.RawQuery = request.URL.RawQuery
+
+	return location, true
+}
+
+// notFoundWriter holds back a 404 answer, which may yet turn into a redirect.
+// Other answers pass straight through.
+type notFoundWriter struct {
+	http.ResponseWriter
+	started  bool
+	notFound bool
+	body     bytes.Buffer
+}
+
+func (w *notFoundWriter) WriteHeader(status int) {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	if status == http.StatusNotFound {
+		w.notFound = true
+
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *notFoundWriter) Write(b []byte) (int, error) {
+	w.started = true
+	if w.notFound {
+		return w.body.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// flush sends the 404 held back.
+func (w *notFoundWriter) flush() {
+	w.ResponseWriter.WriteHeader(http.StatusNotFound)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
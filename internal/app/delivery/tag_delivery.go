@@ -0,0 +1,61 @@
+package delivery
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (h AppHandler) ForumTags(writer http.ResponseWriter, request *http.Request) {
+	slug := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/forum/"), "/tags")
+	if !h.forumReadable(writer, request, slug) {
+		return
+	}
+
+	tags, err := h.appUseCase.CheckForumTags(slug, parseQueryParameters(request, 100))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find forum")
+
+		return
+	}
+
+	if tags == nil {
+		tags = []models.TagUsage{}
+	}
+
+	writeJSON(writer, http.StatusOK, tags)
+}
+
+func (h AppHandler) TagThreads(writer http.ResponseWriter, request *http.Request) {
+	parameters := parseQueryParameters(request, 100)
+	parameters.Tag = strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/tags/"), "/threads")
+
+	if !models.IsThreadSort(parameters.Sort) {
+		writeError(writer, http.StatusBadRequest, "Unknown sort")
+
+		return
+	}
+
+	threads, err := h.appUseCase.CheckThreadsByTag(parameters)
+	if err == models.ErrBadTags {
+		writeError(writer, http.StatusBadRequest, err.Error())
+
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad query parameters")
+
+		return
+	}
+
+	threads = h.muteThreads(request, threads)
+	h.renderThreads(request, threads)
+
+	result := make([]interface{}, 0, len(threads))
+	for _, thread := range threads {
+		result = append(result, threadView(thread))
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
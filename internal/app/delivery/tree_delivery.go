@@ -0,0 +1,92 @@
+package delivery
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (h AppHandler) PostChildren(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/post/"), "/children"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find post")
+
+		return
+	}
+
+	var parameters models.PostTreeParameters
+	parameters.Depth, _ = strconv.Atoi(request.URL.Query().Get("depth"))
+	parameters.Since, _ = strconv.Atoi(request.URL.Query().Get("since"))
+
+	limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 100
+	}
+	parameters.Limit = limit
+
+	desc, err := strconv.ParseBool(request.URL.Query().Get("desc"))
+	if err != nil {
+		desc = false
+	}
+	parameters.Desc = desc
+
+	parameters.Viewer = viewerNickname(request)
+
+	parameters.Sort = request.URL.Query().Get("sort")
+	if parameters.Sort == "" {
+		parameters.Sort = "tree"
+	}
+	if parameters.Sort != "tree" && parameters.Sort != "flat" {
+		writeError(writer, http.StatusBadRequest, "Unknown sort")
+
+		return
+	}
+
+	posts, err := h.appUseCase.CheckPostChildren(id, parameters)
+	if writeAccessError(writer, err) {
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find post")
+
+		return
+	}
+
+	posts = h.mutePosts(request, posts)
+	if posts == nil {
+		posts = []models.Post{}
+	}
+
+	h.renderPosts(request, posts)
+
+	writeJSON(writer, http.StatusOK, posts)
+}
+
+func (h AppHandler) PostAncestors(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/post/"), "/ancestors"))
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find post")
+
+		return
+	}
+
+	posts, err := h.appUseCase.CheckPostAncestors(id, viewerNickname(request))
+	if writeAccessError(writer, err) {
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find post")
+
+		return
+	}
+
+	if posts == nil {
+		posts = []models.Post{}
+	}
+
+	h.renderPosts(request, posts)
+
+	writeJSON(writer, http.StatusOK, posts)
+}
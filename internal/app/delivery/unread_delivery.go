@@ -0,0 +1,105 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func (h AppHandler) ReadThread(writer http.ResponseWriter, request *http.Request) {
+	slugOrId := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/thread/"), "/read")
+
+	var marker models.ReadMarker
+	err := json.NewDecoder(request.Body).Decode(&marker)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "Bad request body")
+
+		return
+	}
+
+	// Markers are always the caller's own, whatever the body says.
+	marker.Nickname = viewerNickname(request)
+	if marker.Nickname == "" {
+		writeError(writer, http.StatusForbidden, "Only signed in users can mark threads read")
+
+		return
+	}
+
+	var thread models.Thread
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		thread, err = h.appUseCase.CheckThreadBySlug(slugOrId)
+	} else {
+		thread, err = h.appUseCase.CheckThreadById(id)
+	}
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find thread")
+
+		return
+	}
+
+	if !h.forumReadable(writer, request, thread.Forum) {
+		return
+	}
+	marker.Thread = thread.Id
+
+	result, err := h.appUseCase.MarkThreadRead(marker)
+	if err != nil {
+		if err == models.ErrPostNotInThread {
+			writeError(writer, http.StatusConflict, "Post is from different thread")
+
+			return
+		}
+
+		if err == pgx.ErrNoRows {
+			writeError(writer, http.StatusNotFound, "Can't find post")
+
+			return
+		}
+
+		writeError(writer, http.StatusNotFound, "Can't find user")
+
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+func (h AppHandler) UserUnread(writer http.ResponseWriter, request *http.Request) {
+	nickname := strings.TrimSuffix(strings.TrimPrefix(request.URL.Path, "/api/user/"), "/unread")
+	if !strings.EqualFold(viewerNickname(request), nickname) {
+		writeError(writer, http.StatusForbidden, "Only the user can see their unread threads")
+
+		return
+	}
+
+	parameters := parseQueryParameters(request, 100)
+
+	threads, total, err := h.appUseCase.CheckUnreadThreads(nickname, parameters)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, "Can't find user")
+
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(threads))
+	for _, unread := range threads {
+		h.renderThread(request, &unread.Thread)
+
+		items = append(items, map[string]interface{}{
+			"thread":       threadView(unread.Thread),
+			"lastReadPost": unread.LastReadPost,
+			"unread":       unread.Unread,
+		})
+	}
+
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"total":   total,
+		"threads": items,
+	})
+}
@@ -0,0 +1,107 @@
+package delivery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// etag is the entity tag of a representation made of resources with the
+// given versions, the resource of the endpoint first.
+func etag(versions ...int) string {
+	parts := make([]string, 0, len(versions))
+	for _, version := range versions {
+		parts = append(parts, strconv.Itoa(version))
+	}
+
+	return `"` + strings.Join(parts, "-") + `"`
+}
+
+// bodyETag is the entity tag of a body made of resources with the given
+// versions. A digest of the body follows the versions to tell apart what they
+// don't cover: rendered HTML, the poll of a thread closing or the choices of
+// the viewer in it.
+func bodyETag(body []byte, versions ...int) string {
+	digest := sha256.Sum256(body)
+
+	return strings.TrimSuffix(etag(versions...), `"`) + "-" + hex.EncodeToString(digest[:8]) + `"`
+}
+
+// notModified sets the ETag and answers 304 when If-None-Match shows the
+// client already has the representation.
+func notModified(writer http.ResponseWriter, request *http.Request, tag string) bool {
+	writer.Header().Set("ETag", tag)
+
+	match := request.Header.Get("If-None-Match")
+	if match == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(match, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			writer.WriteHeader(http.StatusNotModified)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion returns the version named by If-Match, zero when there is no
+// precondition. Only the version of the edited resource, which comes first in
+// the tag, is compared. ok is false for weak or malformed tags, which never
+// match.
+func ifMatchVersion(request *http.Request) (version int, ok bool) {
+	match := strings.TrimSpace(request.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		return 0, true
+	}
+
+	if len(match) < 2 || !strings.HasPrefix(match, `"`) || !strings.HasSuffix(match, `"`) {
+		return 0, false
+	}
+
+	first, _, _ := strings.Cut(strings.Trim(match, `"`), "-")
+	version, err := strconv.Atoi(first)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+func writePreconditionFailed(writer http.ResponseWriter) {
+	writeError(writer, http.StatusPreconditionFailed, "Resource was changed, reload it and retry")
+}
+
+// postVersions are the versions of the post and the related resources shown
+// with it.
+func postVersions(data map[string]interface{}) []int {
+	var versions []int
+	if post, ok := data["post"].(models.Post); ok {
+		versions = append(versions, post.Version)
+	}
+
+	if author, ok := data["author"].(models.User); ok {
+		versions = append(versions, author.Version)
+	}
+
+	switch thread := data["thread"].(type) {
+	case models.Thread:
+		versions = append(versions, thread.Version)
+	case models.ThreadWithoutSlug:
+		versions = append(versions, thread.Version)
+	}
+
+	if forum, ok := data["forum"].(models.Forum); ok {
+		versions = append(versions, forum.Version)
+	}
+
+	return versions
+}
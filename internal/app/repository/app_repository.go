@@ -3,6 +3,7 @@ package repository
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,10 +12,13 @@ import (
 
 	"github.com/go-openapi/strfmt"
 	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
 )
 
 type postgresAppRepository struct {
 	Conn *pgx.ConnPool
+	// tx is the unit of work the repository runs in, see InTransaction.
+	tx *pgx.Tx
 }
 
 func NewPostgresAppRepository(conn *pgx.ConnPool) repo.Repository {
@@ -23,17 +27,132 @@ func NewPostgresAppRepository(conn *pgx.ConnPool) repo.Repository {
 	}
 }
 
+const threadColumns = `id, author, created, forum, message, slug, title, votes,
+	posts, last_post_at, COALESCE(last_post_author, ''), locked, shadow, COALESCE(answer, 0), slug_generated, version`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanThread scans the threadColumns of a row followed by any extra columns
+// the query selects after them.
+func scanThread(row scanner, extra ...interface{}) (models.Thread, error) {
+	var thread models.Thread
+	var created time.Time
+	var lastPostAt pgtype.Timestamptz
+
+	dest := []interface{}{
+		&thread.Id,
+		&thread.Author,
+		&created,
+		&thread.Forum,
+		&thread.Message,
+		&thread.Slug,
+		&thread.Title,
+		&thread.Votes,
+		&thread.Posts,
+		&lastPostAt,
+		&thread.LastPostAuthor,
+		&thread.Locked,
+		&thread.Shadow,
+		&thread.Answer,
+		&thread.SlugGenerated,
+		&thread.Version,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	thread.Created = strfmt.DateTime(created.UTC()).String()
+	if lastPostAt.Status == pgtype.Present {
+		thread.LastPostAt = strfmt.DateTime(lastPostAt.Time.UTC()).String()
+	}
+
+	return thread, nil
+}
+
+func scanThreads(rows *pgx.Rows) ([]models.Thread, error) {
+	defer rows.Close()
+
+	var threads []models.Thread
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		threads = append(threads, thread)
+	}
+
+	return threads, rows.Err()
+}
+
+// Hidden posts keep their place in the tree but lose the message.
+const postColumns = `id, author, created, forum, CASE WHEN hidden THEN '' ELSE message END,
+	isEdited, parent, thread, path, children, hidden, shadow, version`
+
+// scanPost scans the postColumns of a row followed by any extra columns the
+// query selects after them.
+func scanPost(row scanner, extra ...interface{}) (models.Post, error) {
+	var post models.Post
+	var created time.Time
+
+	dest := []interface{}{
+		&post.Id,
+		&post.Author,
+		&created,
+		&post.Forum,
+		&post.Message,
+		&post.IsEdited,
+		&post.Parent,
+		&post.Thread,
+		&post.Path,
+		&post.Children,
+		&post.Hidden,
+		&post.Shadow,
+		&post.Version,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	post.Created = strfmt.DateTime(created.UTC()).String()
+	if len(post.Path.Elements) > 0 {
+		post.Depth = len(post.Path.Elements) - 1
+	}
+
+	return post, nil
+}
+
+func scanPosts(rows *pgx.Rows) ([]models.Post, error) {
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
 func (p *postgresAppRepository) InsertUser(user models.User) error {
-	_, err := p.Conn.Exec(`INSERT INTO users(nickname, fullname, about, email) VALUES ($1, $2, $3, $4)`, user.Nickname, user.FullName, user.About, user.Email)
+	_, err := p.db().Exec(`INSERT INTO users(nickname, fullname, about, email) VALUES ($1, $2, $3, $4)`, user.Nickname, user.FullName, user.About, user.Email)
 
 	return err
 }
 
 func (p *postgresAppRepository) SelectUserByNickname(nickname string) (models.User, error) {
-	row := p.Conn.QueryRow(`SELECT nickname, fullname, about, email FROM users WHERE nickname=$1 LIMIT 1;`, nickname)
+	row := p.db().QueryRow(`SELECT nickname, fullname, about, email, version FROM users WHERE nickname=$1 LIMIT 1;`, nickname)
 
 	var user models.User
-	err := row.Scan(&user.Nickname, &user.FullName, &user.About, &user.Email)
+	err := row.Scan(&user.Nickname, &user.FullName, &user.About, &user.Email, &user.Version)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -42,7 +161,7 @@ func (p *postgresAppRepository) SelectUserByNickname(nickname string) (models.Us
 }
 
 func (p *postgresAppRepository) SelectUserByEmail(email string) (models.User, error) {
-	row := p.Conn.QueryRow(`SELECT email, nickname, fullname, about FROM users WHERE email=$1 LIMIT 1;`, email)
+	row := p.db().QueryRow(`SELECT email, nickname, fullname, about FROM users WHERE email=$1 LIMIT 1;`, email)
 
 	var user models.User
 	err := row.Scan(&user.Email, &user.Nickname, &user.FullName, &user.About)
@@ -54,7 +173,7 @@ func (p *postgresAppRepository) SelectUserByEmail(email string) (models.User, er
 }
 
 func (p *postgresAppRepository) SelectUsersByNickAndEmail(nickname, email string) ([]models.User, error) {
-	rows, err := p.Conn.Query(`SELECT * FROM users WHERE email=$1 OR nickname=$2 LIMIT 2;`, email, nickname)
+	rows, err := p.db().Query(`SELECT nickname, fullname, about, email FROM users WHERE email=$1 OR nickname=$2 LIMIT 2;`, email, nickname)
 	if err != nil {
 		return nil, err
 	}
@@ -75,113 +194,226 @@ func (p *postgresAppRepository) SelectUsersByNickAndEmail(nickname, email string
 	return users, nil
 }
 
+// UpdateUser changes the profile. A non-zero version must be the current one,
+// otherwise no row is updated.
 func (p *postgresAppRepository) UpdateUser(user models.User) (models.User, error) {
 	var newUser models.User
-	err := p.Conn.QueryRow(
+	err := p.db().QueryRow(
 		`UPDATE users SET email=COALESCE(NULLIF($1, ''), email), 
 							  about=COALESCE(NULLIF($2, ''), about), 
-							  fullname=COALESCE(NULLIF($3, ''), fullname) WHERE nickname=$4 RETURNING *`,
+							  fullname=COALESCE(NULLIF($3, ''), fullname) WHERE nickname=$4 AND ($5 = 0 OR version=$5)
+							  RETURNING nickname, fullname, about, email, version`,
 		user.Email,
 		user.About,
 		user.FullName,
 		user.Nickname,
-	).Scan(&newUser.Nickname, &newUser.FullName, &newUser.About, &newUser.Email)
+		user.Version,
+	).Scan(&newUser.Nickname, &newUser.FullName, &newUser.About, &newUser.Email, &newUser.Version)
 
 	return newUser, err
 }
 
-func (p *postgresAppRepository) InsertForum(forum models.Forum) (models.Forum, error) {
-	var newForum models.Forum
-	err := p.Conn.QueryRow(
-		`INSERT INTO forum(slug, title, "user") VALUES ($1, $2, $3) RETURNING *`,
-		forum.Slug,
-		forum.Title,
-		forum.User,
-	).Scan(&newForum.Slug, &newForum.Title, &newForum.User, &newForum.Posts, &newForum.Threads)
+func (p *postgresAppRepository) SelectThreadsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Thread, error) {
+	query, args, err := authorActivityQuery(`SELECT `+threadColumns+` FROM thread WHERE author=$1`, "thread", nickname, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if parameters.Desc {
+		query += ` ORDER BY created DESC, id DESC`
+	} else {
+		query += ` ORDER BY created ASC, id ASC`
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` LIMIT NULLIF($%d, 0)`, len(args))
 
-	return newForum, err
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanThreads(rows)
 }
 
-func (p *postgresAppRepository) SelectForumBySlug(slug string) (models.Forum, error) {
+func (p *postgresAppRepository) SelectPostsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Post, error) {
+	query, args, err := authorActivityQuery(`SELECT `+postColumns+` FROM post WHERE author=$1`, "post", nickname, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if parameters.Desc {
+		query += ` ORDER BY created DESC, id DESC`
+	} else {
+		query += ` ORDER BY created ASC, id ASC`
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` LIMIT NULLIF($%d, 0)`, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPosts(rows)
+}
+
+// authorActivityQuery appends the forum, date range and since filters shared by
+// the user activity listings to the base query selecting by author from the
+// table. Since is the id of the last row of the previous page: rows of one
+// batch share their creation time, so the page goes on strictly after the
+// creation time and id of that row.
+func authorActivityQuery(base, table, nickname string, parameters models.QueryParameters) (string, []interface{}, error) {
+	query := base
+	args := []interface{}{nickname, parameters.Viewer}
+	query += ` AND ` + fmt.Sprintf(shadowFilter, 2) + ` AND ` + fmt.Sprintf(forumAccessFilter, 2)
+
+	if parameters.Forum != "" {
+		args = append(args, parameters.Forum)
+		query += fmt.Sprintf(` AND forum=$%d`, len(args))
+	}
+	if parameters.From != "" {
+		args = append(args, parameters.From)
+		query += fmt.Sprintf(` AND created >= $%d`, len(args))
+	}
+	if parameters.To != "" {
+		args = append(args, parameters.To)
+		query += fmt.Sprintf(` AND created <= $%d`, len(args))
+	}
+	if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
+		if err != nil {
+			return "", nil, err
+		}
+
+		order := ">"
+		if parameters.Desc {
+			order = "<"
+		}
+
+		args = append(args, since)
+		query += fmt.Sprintf(` AND (created, id) %s (SELECT created, id FROM %s WHERE id=$%d)`, order, table, len(args))
+	}
+
+	return query, args, nil
+}
+
+const forumColumns = `slug, title, "user", posts, threads, visibility, archived,
+	COALESCE(parent, ''), COALESCE(category, 0), position, total_posts, total_threads, qa, version`
+
+func scanForum(row scanner) (models.Forum, error) {
 	var forum models.Forum
-	err := p.Conn.QueryRow(
-		`SELECT * FROM forum WHERE slug=$1 LIMIT 1;`,
-		slug).Scan(
+	err := row.Scan(
 		&forum.Slug,
 		&forum.Title,
 		&forum.User,
 		&forum.Posts,
 		&forum.Threads,
+		&forum.Visibility,
+		&forum.Archived,
+		&forum.Parent,
+		&forum.Category,
+		&forum.Position,
+		&forum.TotalPosts,
+		&forum.TotalThreads,
+		&forum.QA,
+		&forum.Version,
 	)
 
 	return forum, err
 }
 
-func (p *postgresAppRepository) InsertThread(thread models.Thread) (models.Thread, error) {
-	query := `INSERT INTO thread(slug, author, created, message, title, forum) 
-			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING *`
+// InsertForum creates the forum along with the membership of its owner.
+func (p *postgresAppRepository) InsertForum(forum models.Forum) (models.Forum, error) {
+	if forum.Visibility == "" {
+		forum.Visibility = models.ForumPublic
+	}
 
-	var row *pgx.Row
-	if thread.Created != "" {
-		row = p.Conn.QueryRow(
-			query,
-			thread.Slug,
-			thread.Author,
-			thread.Created,
-			thread.Message,
-			thread.Title,
-			thread.Forum,
-		)
-	} else {
-		row = p.Conn.QueryRow(
-			query,
-			thread.Slug,
-			thread.Author,
-			time.Time{},
-			thread.Message,
-			thread.Title,
-			thread.Forum,
+	row := p.db().QueryRow(
+		`WITH new_forum AS (
+			INSERT INTO forum(slug, title, "user", visibility, qa) VALUES ($1, $2, $3, $4, $6) RETURNING *
+		), owner AS (
+			INSERT INTO forum_member (forum, nickname, role) SELECT slug, "user", $5 FROM new_forum
 		)
-	}
+		SELECT `+forumColumns+` FROM new_forum`,
+		forum.Slug,
+		forum.Title,
+		forum.User,
+		forum.Visibility,
+		models.MemberRoleOwner,
+		forum.QA,
+	)
 
-	var thr models.Thread
-	var created time.Time
-	err := row.Scan(&thr.Id, &thr.Author, &created, &thr.Forum, &thr.Message, &thr.Slug, &thr.Title, &thr.Votes)
+	return scanForum(row)
+}
 
-	thr.Created = strfmt.DateTime(created.UTC()).String()
+func (p *postgresAppRepository) SelectForumBySlug(slug string) (models.Forum, error) {
+	row := p.db().QueryRow(`SELECT `+forumColumns+` FROM forum WHERE slug=$1 LIMIT 1;`, slug)
 
-	return thr, err
+	return scanForum(row)
 }
 
-func (p *postgresAppRepository) SelectThreadBySlug(slug string) (models.Thread, error) {
-	row := p.Conn.QueryRow(`SELECT * FROM thread WHERE slug=$1 LIMIT 1;`, slug)
+// InsertThread runs in a savepoint, so a taken generated slug can be retried
+// in the same unit of work.
+func (p *postgresAppRepository) InsertThread(thread models.Thread) (models.Thread, error) {
+	query := `INSERT INTO thread(slug, author, created, message, title, forum, shadow, slug_generated) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING ` + threadColumns
+
+	var result models.Thread
+	err := p.savepoint(func() error {
+		var row *pgx.Row
+		if thread.Created != "" {
+			row = p.db().QueryRow(
+				query,
+				thread.Slug,
+				thread.Author,
+				thread.Created,
+				thread.Message,
+				thread.Title,
+				thread.Forum,
+				thread.Shadow,
+				thread.SlugGenerated,
+			)
+		} else {
+			row = p.db().QueryRow(
+				query,
+				thread.Slug,
+				thread.Author,
+				time.Time{},
+				thread.Message,
+				thread.Title,
+				thread.Forum,
+				thread.Shadow,
+				thread.SlugGenerated,
+			)
+		}
 
-	var thread models.Thread
-	var created time.Time
-	err := row.Scan(&thread.Id, &thread.Author, &created, &thread.Forum, &thread.Message, &thread.Slug, &thread.Title, &thread.Votes)
+		var err error
+		result, err = scanThread(row)
+		return err
+	})
 
-	thread.Created = strfmt.DateTime(created.UTC()).String()
-
-	return thread, err
+	return result, err
 }
 
-func (p *postgresAppRepository) SelectThreadById(id int) (models.Thread, error) {
-	row := p.Conn.QueryRow(`SELECT * FROM thread WHERE id=$1 LIMIT 1;`, id)
+func (p *postgresAppRepository) SelectThreadBySlug(slug string) (models.Thread, error) {
+	row := p.db().QueryRow(`SELECT `+threadColumns+` FROM thread WHERE slug=$1 LIMIT 1;`, slug)
 
-	var thread models.Thread
-	var created time.Time
-	err := row.Scan(&thread.Id, &thread.Author, &created, &thread.Forum, &thread.Message, &thread.Slug, &thread.Title, &thread.Votes)
+	return scanThread(row)
+}
 
-	thread.Created = strfmt.DateTime(created.UTC()).String()
+func (p *postgresAppRepository) SelectThreadById(id int) (models.Thread, error) {
+	row := p.db().QueryRow(`SELECT `+threadColumns+` FROM thread WHERE id=$1 LIMIT 1;`, id)
 
-	return thread, err
+	return scanThread(row)
 }
 
 func (p *postgresAppRepository) selectForumSlugById(id int) (string, error) {
 	query := `SELECT forum FROM thread WHERE id=$1`
 
 	var slug string
-	err := p.Conn.QueryRow(query, id).Scan(&slug)
+	err := p.db().QueryRow(query, id).Scan(&slug)
 	return slug, err
 }
 
@@ -197,51 +429,42 @@ func (p *postgresAppRepository) InsertPosts(posts []models.Post, thread int) ([]
 		return nil, err
 	}
 
-	insert := `INSERT INTO post(author, created, forum, message, parent, thread) VALUES `
+	insert := `INSERT INTO post(author, created, forum, message, parent, thread, shadow) VALUES `
 	var values []interface{}
 	timeCreated := time.Now()
 	for i, post := range posts {
 		value := fmt.Sprintf(
-			"($%d, $%d, $%d, $%d, $%d, $%d),",
-			i*6+1, i*6+2, i*6+3, i*6+4, i*6+5, i*6+6,
+			"($%d, $%d, $%d, $%d, $%d, $%d, $%d),",
+			i*7+1, i*7+2, i*7+3, i*7+4, i*7+5, i*7+6, i*7+7,
 		)
 
 		insert += value
 
-		values = append(values, post.Author, timeCreated, forum, post.Message, post.Parent, thread)
+		values = append(values, post.Author, timeCreated, forum, post.Message, post.Parent, thread, post.Shadow)
 	}
 
 	insert = strings.TrimSuffix(insert, ",")
-	insert += ` RETURNING *`
+	insert += ` RETURNING ` + postColumns
 
-	rows, err := p.Conn.Query(insert, values...)
+	tx, err := p.begin()
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	defer tx.Rollback()
+
+	rows, err := tx.Query(insert, values...)
+	if err != nil {
+		return nil, err
+	}
 
-	// var resultPosts []models.Post
 	for rows.Next() {
-		var currentPost models.Post
-		var created time.Time
-
-		err := rows.Scan(
-			&currentPost.Id,
-			&currentPost.Author,
-			&created,
-			&currentPost.Forum,
-			&currentPost.Message,
-			&currentPost.IsEdited,
-			&currentPost.Parent,
-			&currentPost.Thread,
-			&currentPost.Path,
-		)
+		currentPost, err := scanPost(rows)
 		if err != nil {
+			rows.Close()
 			return nil, err
 		}
 
-		currentPost.Created = strfmt.DateTime(created.UTC()).String()
 		if !currentPost.Parent.Valid {
 			currentPost.Parent.Int64 = 0
 			currentPost.Parent.Valid = true
@@ -249,45 +472,152 @@ func (p *postgresAppRepository) InsertPosts(posts []models.Post, thread int) ([]
 		resultPosts = append(resultPosts, currentPost)
 	}
 
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Shadowed posts are invisible to other users and do not count.
+	visible := 0
+	lastAuthor := ""
+	for _, post := range resultPosts {
+		if !post.Shadow {
+			visible++
+			lastAuthor = post.Author
+		}
+	}
+
+	// The whole batch shares one creation time, so the counters are bumped once
+	// per batch instead of once per post.
+	if visible > 0 {
+		_, err = tx.Exec(
+			`UPDATE thread SET posts = posts + $1,
+							   last_post_at = GREATEST(last_post_at, $2),
+							   last_post_author = $3
+							   WHERE id = $4`,
+			visible,
+			timeCreated,
+			lastAuthor,
+			thread,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return resultPosts, nil
 }
 
-func (p *postgresAppRepository) UpdateThread(thread models.Thread) (models.Thread, error) {
-	query := `UPDATE thread SET title=COALESCE(NULLIF($1, ''), title), message=COALESCE(NULLIF($2, ''), message) WHERE %s RETURNING *`
+// ReconcileThreadCounters repairs the counters of threads which drifted from
+// their posts, only checking the threads with posts created since the given
+// time unless it is zero. The drifted threads are locked before the counters
+// are recomputed in a later statement, whose snapshot sees every post
+// committed by the time the locks were granted. Posts added after that bump
+// the repaired counter once the locks are released.
+func (p *postgresAppRepository) ReconcileThreadCounters(since time.Time) (int, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return 0, err
+	}
 
-	var row *pgx.Row
-	if thread.Slug == "" {
-		query = fmt.Sprintf(query, `id=$3`)
-		row = p.Conn.QueryRow(query, thread.Title, thread.Message, thread.Id)
-	} else {
-		query = fmt.Sprintf(query, `slug=$3`)
-		row = p.Conn.QueryRow(query, thread.Title, thread.Message, thread.Slug)
+	defer tx.Rollback()
+
+	query := `SELECT t.id FROM thread t
+		WHERE (t.posts, t.last_post_at, t.last_post_author) IS DISTINCT FROM
+			  (SELECT COUNT(p.id), MAX(p.created),
+					  (SELECT author FROM post WHERE post.thread = t.id AND NOT post.shadow ORDER BY id DESC LIMIT 1)
+			   FROM post p WHERE p.thread = t.id AND NOT p.shadow)`
+	var args []interface{}
+	if !since.IsZero() {
+		args = append(args, since)
+		query += ` AND t.id IN (SELECT thread FROM post WHERE created >= $1)`
 	}
 
-	var newThread models.Thread
-	var created time.Time
-	err := row.Scan(
-		&newThread.Id,
-		&newThread.Author,
-		&created,
-		&newThread.Forum,
-		&newThread.Message,
-		&newThread.Slug,
-		&newThread.Title,
-		&newThread.Votes,
+	rows, err := tx.Query(query+` ORDER BY t.id FOR UPDATE OF t`, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []interface{}
+	var placeholders []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		ids = append(ids, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(ids)))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tag, err := tx.Exec(
+		`UPDATE thread SET posts = (SELECT COUNT(*) FROM post WHERE post.thread = thread.id AND NOT post.shadow),
+						   last_post_at = (SELECT MAX(created) FROM post WHERE post.thread = thread.id AND NOT post.shadow),
+						   last_post_author = (SELECT author FROM post WHERE post.thread = thread.id AND NOT post.shadow ORDER BY id DESC LIMIT 1)
+		WHERE id IN (`+strings.Join(placeholders, ", ")+`)`,
+		ids...,
 	)
+	if err != nil {
+		return 0, err
+	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// RefreshThreadHot rescores the threads created within the window at the
+// current time, as their hot ranking decays without any write to them. Older
+// threads keep the score of their last write or refresh, by then close to
+// zero.
+func (p *postgresAppRepository) RefreshThreadHot(window time.Duration) (int, error) {
+	tag, err := p.db().Exec(
+		`UPDATE thread SET hot = thread_hot(votes, posts, created, NOW())
+		WHERE created > NOW() - $1 * INTERVAL '1 second'`,
+		window.Seconds(),
+	)
 	if err != nil {
-		return models.Thread{}, err
+		return 0, err
 	}
 
-	newThread.Created = strfmt.DateTime(created.UTC()).String()
+	return int(tag.RowsAffected()), nil
+}
+
+// UpdateThread changes the title and the message. A non-zero version must be
+// the current one, otherwise no row is updated.
+func (p *postgresAppRepository) UpdateThread(thread models.Thread) (models.Thread, error) {
+	query := `UPDATE thread SET title=COALESCE(NULLIF($1, ''), title), message=COALESCE(NULLIF($2, ''), message)
+		WHERE %s AND ($4 = 0 OR version=$4) RETURNING ` + threadColumns
+
+	var row *pgx.Row
+	if thread.Slug == "" {
+		query = fmt.Sprintf(query, `id=$3`)
+		row = p.db().QueryRow(query, thread.Title, thread.Message, thread.Id, thread.Version)
+	} else {
+		query = fmt.Sprintf(query, `slug=$3`)
+		row = p.db().QueryRow(query, thread.Title, thread.Message, thread.Slug, thread.Version)
+	}
 
-	return newThread, nil
+	return scanThread(row)
 }
 
 func (p *postgresAppRepository) InsertVote(vote models.Vote) (models.Vote, error) {
-	_, err := p.Conn.Exec(
+	_, err := p.db().Exec(
 		`INSERT INTO votes(nickname, voice, thread_id) VALUES ($1, $2, $3)`,
 		vote.Nickname,
 		vote.Voice,
@@ -298,7 +628,7 @@ func (p *postgresAppRepository) InsertVote(vote models.Vote) (models.Vote, error
 }
 
 func (p *postgresAppRepository) UpdateVote(vote models.Vote) (models.Vote, error) {
-	_, err := p.Conn.Exec(
+	_, err := p.db().Exec(
 		`UPDATE votes SET voice=$1 WHERE thread_id=$2 AND nickname=$3`,
 		vote.Voice,
 		vote.IdThread,
@@ -309,7 +639,7 @@ func (p *postgresAppRepository) UpdateVote(vote models.Vote) (models.Vote, error
 }
 
 func (p *postgresAppRepository) GetServiceStatus() (map[string]int, error) {
-	info, err := p.Conn.Query(
+	info, err := p.db().Query(
 		`SELECT * FROM (SELECT COUNT(*) FROM forum) as forumCount,
 		(SELECT COUNT(*) FROM post) as postCount,
 		(SELECT COUNT(*) FROM thread) as threadCount, 
@@ -341,7 +671,10 @@ func (p *postgresAppRepository) GetServiceStatus() (map[string]int, error) {
 }
 
 func (p *postgresAppRepository) ClearDatabase() error {
-	_, err := p.Conn.Exec(`TRUNCATE users, thread, forum, post, votes, users_forum;`)
+	_, err := p.db().Exec(`TRUNCATE users, thread, forum, category, post, votes, users_forum, thread_read, attachment,
+		report, moderation_log, forum_moderator, ban, filter_rule, filter_hit,
+		forum_member, join_request, invitation, conversation, conversation_member, conversation_message,
+		user_block, user_mute, thread_tag, poll, poll_option, poll_vote, rename_history;`)
 
 	return err
 }
@@ -382,7 +715,7 @@ func (p *postgresAppRepository) SelectUsersByForum(slugForum string, parameters
 		)
 	}
 	var data []models.User
-	row, err := p.Conn.Query(query, slugForum, parameters.Limit)
+	row, err := p.db().Query(query, slugForum, parameters.Limit)
 
 	if err != nil {
 		return data, nil
@@ -407,31 +740,37 @@ func (p *postgresAppRepository) SelectUsersByForum(slugForum string, parameters
 }
 
 func (p *postgresAppRepository) SelectThreadsByForum(slugForum string, parameters models.QueryParameters) ([]models.Thread, error) {
+	if key, ok := threadSortKeys[parameters.Sort]; ok || parameters.Tag != "" || parameters.Solved != "" {
+		return p.selectThreadsSorted(slugForum, key, parameters)
+	}
+
 	var rows *pgx.Rows
 	var err error
 	if parameters.Since != "" {
+		filter := fmt.Sprintf(shadowFilter, 4)
 		if parameters.Desc {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM thread WHERE forum=$1 AND created <= $2 
+			rows, err = p.db().Query(
+				`SELECT `+threadColumns+` FROM thread WHERE forum=$1 AND created <= $2 AND `+filter+`
 				ORDER BY created DESC LIMIT NULLIF($3, 0)`,
-				slugForum, parameters.Since, parameters.Limit)
+				slugForum, parameters.Since, parameters.Limit, parameters.Viewer)
 		} else {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM thread WHERE forum=$1 AND created >= $2 
+			rows, err = p.db().Query(
+				`SELECT `+threadColumns+` FROM thread WHERE forum=$1 AND created >= $2 AND `+filter+`
 				ORDER BY created ASC LIMIT NULLIF($3, 0)`,
-				slugForum, parameters.Since, parameters.Limit)
+				slugForum, parameters.Since, parameters.Limit, parameters.Viewer)
 		}
 	} else {
+		filter := fmt.Sprintf(shadowFilter, 3)
 		if parameters.Desc {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM thread WHERE forum=$1
+			rows, err = p.db().Query(
+				`SELECT `+threadColumns+` FROM thread WHERE forum=$1 AND `+filter+`
 				ORDER BY created DESC LIMIT NULLIF($2, 0)`,
-				slugForum, parameters.Limit)
+				slugForum, parameters.Limit, parameters.Viewer)
 		} else {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM thread WHERE forum=$1
+			rows, err = p.db().Query(
+				`SELECT `+threadColumns+` FROM thread WHERE forum=$1 AND `+filter+`
 				ORDER BY created ASC LIMIT NULLIF($2, 0)`,
-				slugForum, parameters.Limit)
+				slugForum, parameters.Limit, parameters.Viewer)
 		}
 	}
 
@@ -439,89 +778,108 @@ func (p *postgresAppRepository) SelectThreadsByForum(slugForum string, parameter
 		return nil, err
 	}
 
-	defer rows.Close()
+	return scanThreads(rows)
+}
 
-	var threads []models.Thread
-	for rows.Next() {
-		var thread models.Thread
-		var created time.Time
-
-		err := rows.Scan(
-			&thread.Id,
-			&thread.Author,
-			&created,
-			&thread.Forum,
-			&thread.Message,
-			&thread.Slug,
-			&thread.Title,
-			&thread.Votes,
-		)
+// threadSortKeys maps the sort modes other than the default "created" one to
+// the ordering expressions backed by the thread indexes.
+var threadSortKeys = map[string]string{
+	models.ThreadSortVotes:    `votes`,
+	models.ThreadSortActivity: `COALESCE(last_post_at, created)`,
+	models.ThreadSortPosts:    `posts`,
+	models.ThreadSortHot:      `hot`,
+}
+
+// selectThreadsSorted pages threads ordered by key with the thread id as a tie
+// breaker, so since is the id of the last thread of the previous page. The
+// empty key orders by creation time and since is then a timestamp, as in the
+// default listing. An empty forum selects threads across all forums.
+func (p *postgresAppRepository) selectThreadsSorted(forum, key string, parameters models.QueryParameters) ([]models.Thread, error) {
+	args := []interface{}{parameters.Viewer}
+	// The access filter holds for a single forum too, the callers passing one
+	// don't all check the forum is readable first.
+	query := `SELECT ` + threadColumns + ` FROM thread WHERE ` + fmt.Sprintf(shadowFilter, 1) +
+		` AND ` + fmt.Sprintf(forumAccessFilter, 1)
+
+	if forum != "" {
+		args = append(args, forum)
+		query += fmt.Sprintf(` AND forum=$%d`, len(args))
+	}
+
+	if parameters.Tag != "" {
+		args = append(args, parameters.Tag)
+		query += fmt.Sprintf(` AND id IN (SELECT thread FROM thread_tag WHERE tag=$%d)`, len(args))
+	}
+
+	switch parameters.Solved {
+	case "true":
+		query += ` AND answer IS NOT NULL`
+	case "false":
+		query += ` AND answer IS NULL`
+	}
+
+	order, direction := ">", "ASC"
+	if parameters.Desc {
+		order, direction = "<", "DESC"
+	}
+
+	if key == "" && parameters.Since != "" {
+		args = append(args, parameters.Since)
+		query += fmt.Sprintf(` AND created %s= $%d`, order, len(args))
+	} else if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
 		if err != nil {
 			return nil, err
 		}
 
-		thread.Created = strfmt.DateTime(created.UTC()).String()
-
-		threads = append(threads, thread)
+		args = append(args, since)
+		query += fmt.Sprintf(` AND (%s, id) %s (SELECT %s, id FROM thread WHERE id=$%d)`, key, order, key, len(args))
 	}
 
-	return threads, err
-}
+	if key == "" {
+		key = `created`
+	}
 
-func (p *postgresAppRepository) SelectPostById(id int) (models.Post, error) {
-	var post models.Post
-	var created time.Time
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT NULLIF($%d, 0)`, key, direction, direction, len(args))
 
-	err := p.Conn.QueryRow(
-		`SELECT * FROM post WHERE id=$1 LIMIT 1;`,
-		id).Scan(
-		&post.Id,
-		&post.Author,
-		&created,
-		&post.Forum,
-		&post.Message,
-		&post.IsEdited,
-		&post.Parent,
-		&post.Thread,
-		&post.Path,
-	)
+	rows, err := p.db().Query(query, args...)
 	if err != nil {
-		return models.Post{}, err
+		return nil, err
 	}
 
-	post.Created = strfmt.DateTime(created.UTC()).String()
+	return scanThreads(rows)
+}
 
-	return post, nil
+func (p *postgresAppRepository) SelectTrendingThreads(parameters models.QueryParameters) ([]models.Thread, error) {
+	parameters.Desc = true
+
+	return p.selectThreadsSorted(parameters.Forum, threadSortKeys[models.ThreadSortHot], parameters)
 }
 
-func (p *postgresAppRepository) UpdatePost(id int, message string) (models.Post, error) {
-	var post models.Post
-	var created time.Time
-	err := p.Conn.QueryRow(
+func (p *postgresAppRepository) SelectPostById(id int) (models.Post, error) {
+	row := p.db().QueryRow(`SELECT `+postColumns+` FROM post WHERE id=$1 LIMIT 1;`, id)
+
+	return scanPost(row)
+}
+
+// UpdatePost changes the message. A non-zero version must be the current one,
+// otherwise no row is updated.
+func (p *postgresAppRepository) UpdatePost(id int, message string, version int) (models.Post, error) {
+	row := p.db().QueryRow(
 		`UPDATE post SET message=COALESCE(NULLIF($1, ''), message),
 							 isEdited = CASE WHEN $1 = '' OR message = $1 THEN isEdited ELSE true END
-							 WHERE id=$2 RETURNING *`,
+							 WHERE id=$2 AND ($3 = 0 OR version=$3) RETURNING `+postColumns,
 		message,
 		id,
-	).Scan(
-		&post.Id,
-		&post.Author,
-		&created,
-		&post.Forum,
-		&post.Message,
-		&post.IsEdited,
-		&post.Parent,
-		&post.Thread,
-		&post.Path,
+		version,
 	)
 
-	post.Created = strfmt.DateTime(created.UTC()).String()
-
-	return post, err
+	return scanPost(row)
 }
 
 func (p *postgresAppRepository) selectThreadIdBySlug(slug string) (int, error) {
-	row := p.Conn.QueryRow(`SELECT id FROM thread WHERE slug=$1 LIMIT 1;`, slug)
+	row := p.db().QueryRow(`SELECT id FROM thread WHERE slug=$1 LIMIT 1;`, slug)
 
 	var id int
 	err := row.Scan(&id)
@@ -529,7 +887,7 @@ func (p *postgresAppRepository) selectThreadIdBySlug(slug string) (int, error) {
 	return id, err
 }
 
-func (p *postgresAppRepository) SelectPostsByThread(thread models.Thread, limit, since int, sort string, desc bool) ([]models.Post, error) {
+func (p *postgresAppRepository) SelectPostsByThread(thread models.Thread, limit, since int, sort string, desc bool, viewer string) ([]models.Post, error) {
 	var threadId int
 	if thread.Id == 0 {
 		thr, err := p.SelectThreadIdBySlug(thread.Slug)
@@ -544,15 +902,15 @@ func (p *postgresAppRepository) SelectPostsByThread(thread models.Thread, limit,
 
 	switch sort {
 	case "flat":
-		posts, err := p.selectPostsByThreadFlat(threadId, limit, since, desc)
+		posts, err := p.selectPostsByThreadFlat(threadId, limit, since, desc, viewer)
 
 		return posts, err
 	case "tree":
-		posts, err := p.selectPostsByThreadTree(threadId, limit, since, desc)
+		posts, err := p.selectPostsByThreadTree(threadId, limit, since, desc, viewer)
 
 		return posts, err
 	case "parent_tree":
-		posts, err := p.selectPostsByThreadParentTree(threadId, limit, since, desc)
+		posts, err := p.selectPostsByThreadParentTree(threadId, limit, since, desc, viewer)
 
 		return posts, err
 	default:
@@ -560,88 +918,74 @@ func (p *postgresAppRepository) SelectPostsByThread(thread models.Thread, limit,
 	}
 }
 
-func (p *postgresAppRepository) selectPostsByThreadFlat(id, limit, since int, desc bool) ([]models.Post, error) {
+// shadowFilter hides content of shadow-banned authors from everyone but the
+// authors themselves. The placeholder is the viewer nickname.
+const shadowFilter = `(NOT shadow OR author = $%d)`
+
+// forumAccessFilter hides content of private forums from everyone but their
+// members in listings. The placeholder is the viewer nickname.
+const forumAccessFilter = `(forum NOT IN (SELECT slug FROM forum WHERE visibility = 'private')
+	OR forum IN (SELECT forum FROM forum_member WHERE nickname = $%d))`
+
+func (p *postgresAppRepository) selectPostsByThreadFlat(id, limit, since int, desc bool, viewer string) ([]models.Post, error) {
 	var rows *pgx.Rows
 	var err error
 	if since == 0 {
+		filter := fmt.Sprintf(shadowFilter, 3)
 		if desc {
-			rows, err = p.Conn.Query(`SELECT * FROM post WHERE thread=$1 ORDER BY id DESC LIMIT NULLIF($2, 0)`, id, limit)
+			rows, err = p.db().Query(`SELECT `+postColumns+` FROM post WHERE thread=$1 AND `+filter+` ORDER BY id DESC LIMIT NULLIF($2, 0)`, id, limit, viewer)
 		} else {
-			rows, err = p.Conn.Query(`SELECT * FROM post WHERE thread=$1 ORDER BY id ASC LIMIT NULLIF($2, 0)`, id, limit)
+			rows, err = p.db().Query(`SELECT `+postColumns+` FROM post WHERE thread=$1 AND `+filter+` ORDER BY id ASC LIMIT NULLIF($2, 0)`, id, limit, viewer)
 		}
 	} else {
+		filter := fmt.Sprintf(shadowFilter, 4)
 		if desc {
-			rows, err = p.Conn.Query(`SELECT * FROM post WHERE thread=$1 AND id < $2 ORDER BY id DESC LIMIT NULLIF($3, 0)`, id, since, limit)
+			rows, err = p.db().Query(`SELECT `+postColumns+` FROM post WHERE thread=$1 AND id < $2 AND `+filter+` ORDER BY id DESC LIMIT NULLIF($3, 0)`, id, since, limit, viewer)
 		} else {
-			rows, err = p.Conn.Query(`SELECT * FROM post WHERE thread=$1 AND id > $2 ORDER BY id ASC LIMIT NULLIF($3, 0)`, id, since, limit)
+			rows, err = p.db().Query(`SELECT `+postColumns+` FROM post WHERE thread=$1 AND id > $2 AND `+filter+` ORDER BY id ASC LIMIT NULLIF($3, 0)`, id, since, limit, viewer)
 		}
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var created time.Time
-
-		err = rows.Scan(
-			&post.Id,
-			&post.Author,
-			&created,
-			&post.Forum,
-			&post.Message,
-			&post.IsEdited,
-			&post.Parent,
-			&post.Thread,
-			&post.Path,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		post.Created = strfmt.DateTime(created.UTC()).String()
-
-		posts = append(posts, post)
-	}
-
-	return posts, err
+	return scanPosts(rows)
 }
 
-func (p *postgresAppRepository) selectPostsByThreadTree(id, limit, since int, desc bool) ([]models.Post, error) {
+func (p *postgresAppRepository) selectPostsByThreadTree(id, limit, since int, desc bool, viewer string) ([]models.Post, error) {
 	var rows *pgx.Rows
 	var err error
 
 	if since == 0 {
+		filter := fmt.Sprintf(shadowFilter, 3)
 		if desc {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE thread=$1 ORDER BY path DESC, id  DESC LIMIT $2;`,
-				id, limit,
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE thread=$1 AND `+filter+` ORDER BY path DESC, id  DESC LIMIT $2;`,
+				id, limit, viewer,
 			)
 		} else {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE thread=$1 ORDER BY path ASC, id  ASC LIMIT $2;`,
-				id, limit,
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE thread=$1 AND `+filter+` ORDER BY path ASC, id  ASC LIMIT $2;`,
+				id, limit, viewer,
 			)
 		}
 	} else {
+		filter := fmt.Sprintf(shadowFilter, 4)
 		if desc {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE thread=$1 AND PATH < (SELECT path FROM post WHERE id = $2)
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE thread=$1 AND PATH < (SELECT path FROM post WHERE id = $2) AND `+filter+`
 				ORDER BY path DESC, id  DESC LIMIT $3;`,
-				id, since, limit,
+				id, since, limit, viewer,
 			)
 		} else {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE thread=$1 AND PATH > (SELECT path FROM post WHERE id = $2)
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE thread=$1 AND PATH > (SELECT path FROM post WHERE id = $2) AND `+filter+`
 				ORDER BY path ASC, id  ASC LIMIT $3;`,
-				id, since, limit,
+				id, since, limit, viewer,
 			)
 		}
 	}
@@ -649,69 +993,46 @@ func (p *postgresAppRepository) selectPostsByThreadTree(id, limit, since int, de
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var created time.Time
-
-		err = rows.Scan(
-			&post.Id,
-			&post.Author,
-			&created,
-			&post.Forum,
-			&post.Message,
-			&post.IsEdited,
-			&post.Parent,
-			&post.Thread,
-			&post.Path,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		post.Created = strfmt.DateTime(created.UTC()).String()
-
-		posts = append(posts, post)
-	}
-
-	return posts, nil
+	return scanPosts(rows)
 }
 
-func (p *postgresAppRepository) selectPostsByThreadParentTree(id, limit, since int, desc bool) ([]models.Post, error) {
+func (p *postgresAppRepository) selectPostsByThreadParentTree(id, limit, since int, desc bool, viewer string) ([]models.Post, error) {
 	var rows *pgx.Rows
 	var err error
 
 	if since == 0 {
+		filter := fmt.Sprintf(shadowFilter, 3)
 		if desc {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL ORDER BY id DESC LIMIT $2)
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL AND `+filter+` ORDER BY id DESC LIMIT $2)
+				AND `+filter+`
 				ORDER BY path[1] DESC, path, id;`,
-				id, limit,
+				id, limit, viewer,
 			)
 		} else {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL ORDER BY id LIMIT $2)
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL AND `+filter+` ORDER BY id LIMIT $2)
+				AND `+filter+`
 				ORDER BY path, id;`,
-				id, limit,
+				id, limit, viewer,
 			)
 		}
 	} else {
+		filter := fmt.Sprintf(shadowFilter, 4)
 		if desc {
-			rows, err = p.Conn.Query(
-				`SELECT * FROM post
-				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL AND PATH[1] <
-				(SELECT path[1] FROM post WHERE id = $2) ORDER BY id DESC LIMIT $3) ORDER BY path[1] DESC, path, id;`,
-				id, since, limit,
+			rows, err = p.db().Query(
+				`SELECT `+postColumns+` FROM post
+				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL AND `+filter+` AND PATH[1] <
+				(SELECT path[1] FROM post WHERE id = $2) ORDER BY id DESC LIMIT $3) AND `+filter+` ORDER BY path[1] DESC, path, id;`,
+				id, since, limit, viewer,
 			)
 		} else {
-			rows, err = p.Conn.Query(`SELECT * FROM post
-				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL AND PATH[1] >
-				(SELECT path[1] FROM post WHERE id = $2) ORDER BY id ASC LIMIT $3) ORDER BY path, id;`,
-				id, since, limit,
+			rows, err = p.db().Query(`SELECT `+postColumns+` FROM post
+				WHERE path[1] IN (SELECT id FROM post WHERE thread = $1 AND parent IS NULL AND `+filter+` AND PATH[1] >
+				(SELECT path[1] FROM post WHERE id = $2) ORDER BY id ASC LIMIT $3) AND `+filter+` ORDER BY path, id;`,
+				id, since, limit, viewer,
 			)
 		}
 	}
@@ -720,52 +1041,33 @@ func (p *postgresAppRepository) selectPostsByThreadParentTree(id, limit, since i
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var created time.Time
-
-		err = rows.Scan(
-			&post.Id,
-			&post.Author,
-			&created,
-			&post.Forum,
-			&post.Message,
-			&post.IsEdited,
-			&post.Parent,
-			&post.Thread,
-			&post.Path,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		post.Created = strfmt.DateTime(created.UTC()).String()
-
-		posts = append(posts, post)
-	}
-
-	return posts, nil
+	return scanPosts(rows)
 }
 
 func (p *postgresAppRepository) SelectThreadByForum(forum string) (models.Thread, error) {
-	row := p.Conn.QueryRow(`SELECT * FROM thread WHERE forum=$1 LIMIT 1;`, forum)
-
-	var thread models.Thread
-	var created time.Time
-	err := row.Scan(&thread.Id, &thread.Author, &created, &thread.Forum, &thread.Message, &thread.Slug, &thread.Title, &thread.Votes)
+	row := p.db().QueryRow(`SELECT `+threadColumns+` FROM thread WHERE forum=$1 LIMIT 1;`, forum)
 
-	thread.Created = strfmt.DateTime(created.UTC()).String()
-
-	return thread, err
+	return scanThread(row)
 }
 
 func (p *postgresAppRepository) SelectThreadIdBySlug(slug string) (int, error) {
 	query := `SELECT id FROM thread WHERE slug=$1 LIMIT 1`
 
 	var id int
-	err := p.Conn.QueryRow(query, slug).Scan(&id)
+	err := p.db().QueryRow(query, slug).Scan(&id)
 	return id, err
 }
+
+// SelectSlugSuffix returns the largest numeric suffix taken by threads whose
+// slug is the base or the base with a suffix, counting the bare base as 1 and
+// 0 when the base is free.
+func (p *postgresAppRepository) SelectSlugSuffix(base string) (int, error) {
+	var suffix int
+	err := p.db().QueryRow(
+		`SELECT COALESCE(MAX(CASE WHEN slug=$1 THEN 1 ELSE substring(slug FROM '-([0-9]{1,9})$')::INT END), 0)
+		FROM thread WHERE slug=$1 OR slug ~ ('^' || $1 || '-[0-9]{1,9}$')`,
+		base,
+	).Scan(&suffix)
+
+	return suffix, err
+}
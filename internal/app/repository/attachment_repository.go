@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx"
+)
+
+const attachmentColumns = `id, COALESCE(post, 0), name, content_type, size, created, storage_key, COALESCE(thumbnail_key, '')`
+
+func scanAttachment(row scanner) (models.Attachment, error) {
+	var attachment models.Attachment
+	var created time.Time
+
+	err := row.Scan(
+		&attachment.Id,
+		&attachment.Post,
+		&attachment.Name,
+		&attachment.ContentType,
+		&attachment.Size,
+		&created,
+		&attachment.StorageKey,
+		&attachment.ThumbnailKey,
+	)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	attachment.Created = strfmt.DateTime(created.UTC()).String()
+	attachment.Url = fmt.Sprintf("/api/attachment/%d", attachment.Id)
+	if attachment.ThumbnailKey != "" {
+		attachment.ThumbnailUrl = fmt.Sprintf("/api/attachment/%d/thumbnail", attachment.Id)
+	}
+
+	return attachment, nil
+}
+
+func scanAttachments(rows *pgx.Rows) ([]models.Attachment, error) {
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (p *postgresAppRepository) InsertAttachment(attachment models.Attachment) (models.Attachment, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO attachment (post, name, content_type, size, storage_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING `+attachmentColumns,
+		attachment.Post,
+		attachment.Name,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.StorageKey,
+		attachment.ThumbnailKey,
+	)
+
+	return scanAttachment(row)
+}
+
+func (p *postgresAppRepository) SelectAttachmentById(id int) (models.Attachment, error) {
+	row := p.db().QueryRow(`SELECT `+attachmentColumns+` FROM attachment WHERE id=$1`, id)
+
+	return scanAttachment(row)
+}
+
+func (p *postgresAppRepository) SelectAttachmentsByPosts(posts []int) (map[int][]models.Attachment, error) {
+	result := make(map[int][]models.Attachment)
+	if len(posts) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, 0, len(posts))
+	placeholders := make([]string, 0, len(posts))
+	for _, id := range posts {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := p.db().Query(
+		`SELECT `+attachmentColumns+` FROM attachment
+		WHERE post IN (`+strings.Join(placeholders, ", ")+`) ORDER BY id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		result[attachment.Post] = append(result[attachment.Post], attachment)
+	}
+
+	return result, nil
+}
+
+// SelectOrphanedAttachments selects attachments whose post was deleted.
+func (p *postgresAppRepository) SelectOrphanedAttachments() ([]models.Attachment, error) {
+	rows, err := p.db().Query(`SELECT ` + attachmentColumns + ` FROM attachment WHERE post IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+func (p *postgresAppRepository) SelectAllAttachments() ([]models.Attachment, error) {
+	rows, err := p.db().Query(`SELECT ` + attachmentColumns + ` FROM attachment`)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+func (p *postgresAppRepository) DeleteAttachment(id int) error {
+	_, err := p.db().Exec(`DELETE FROM attachment WHERE id=$1`, id)
+
+	return err
+}
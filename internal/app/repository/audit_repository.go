@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+)
+
+func (p *postgresAppRepository) InsertAuditEntry(entry models.AuditEntry) error {
+	_, err := p.db().Exec(
+		`INSERT INTO audit_log (actor, action, target_type, target_id, before, after, request_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::JSONB, NULLIF($6, '')::JSONB, $7)`,
+		entry.Actor,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetId,
+		string(entry.Before),
+		string(entry.After),
+		entry.RequestId,
+	)
+
+	return err
+}
+
+func (p *postgresAppRepository) SelectAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	query := `SELECT id, actor, action, target_type, target_id, COALESCE(before::TEXT, ''), COALESCE(after::TEXT, ''),
+		request_id, created FROM audit_log WHERE TRUE`
+	var args []interface{}
+
+	conditions := []struct {
+		value  string
+		clause string
+	}{
+		{filter.Actor, `actor = $%d`},
+		{filter.Action, `action = $%d`},
+		{filter.TargetType, `target_type = $%d`},
+		{filter.TargetId, `target_id = $%d`},
+		{filter.From, `created >= $%d`},
+		{filter.To, `created < $%d`},
+	}
+	for _, condition := range conditions {
+		if condition.value == "" {
+			continue
+		}
+
+		args = append(args, condition.value)
+		query += ` AND ` + fmt.Sprintf(condition.clause, len(args))
+	}
+
+	if filter.Since != 0 {
+		args = append(args, filter.Since)
+		query += fmt.Sprintf(` AND id < $%d`, len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT NULLIF($%d, 0)`, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after string
+		var created time.Time
+
+		err := rows.Scan(
+			&entry.Id,
+			&entry.Actor,
+			&entry.Action,
+			&entry.TargetType,
+			&entry.TargetId,
+			&before,
+			&after,
+			&entry.RequestId,
+			&created,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if before != "" {
+			entry.Before = []byte(before)
+		}
+		if after != "" {
+			entry.After = []byte(after)
+		}
+		entry.Created = strfmt.DateTime(created.UTC()).String()
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
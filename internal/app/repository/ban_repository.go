@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const banColumns = `id, nickname, COALESCE(forum, ''), reason, expires, shadow, created_by, created`
+
+// activeBan matches bans which have not expired yet.
+const activeBan = `(expires IS NULL OR expires > NOW())`
+
+func scanBan(row scanner) (models.Ban, error) {
+	var ban models.Ban
+	var created time.Time
+	var expires pgtype.Timestamptz
+
+	err := row.Scan(
+		&ban.Id,
+		&ban.Nickname,
+		&ban.Forum,
+		&ban.Reason,
+		&expires,
+		&ban.Shadow,
+		&ban.CreatedBy,
+		&created,
+	)
+	if err != nil {
+		return models.Ban{}, err
+	}
+
+	ban.Created = strfmt.DateTime(created.UTC()).String()
+	if expires.Status == pgtype.Present {
+		ban.Expires = strfmt.DateTime(expires.Time.UTC()).String()
+	}
+
+	return ban, nil
+}
+
+func scanBans(rows *pgx.Rows) ([]models.Ban, error) {
+	defer rows.Close()
+
+	var bans []models.Ban
+	for rows.Next() {
+		ban, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		bans = append(bans, ban)
+	}
+
+	return bans, rows.Err()
+}
+
+func (p *postgresAppRepository) InsertBan(ban models.Ban) (models.Ban, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO ban (nickname, forum, reason, expires, shadow, created_by)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, '')::TIMESTAMP WITH TIME ZONE, $5, $6)
+		RETURNING `+banColumns,
+		ban.Nickname,
+		ban.Forum,
+		ban.Reason,
+		ban.Expires,
+		ban.Shadow,
+		ban.CreatedBy,
+	)
+
+	return scanBan(row)
+}
+
+func (p *postgresAppRepository) SelectBanById(id int) (models.Ban, error) {
+	row := p.db().QueryRow(`SELECT `+banColumns+` FROM ban WHERE id=$1`, id)
+
+	return scanBan(row)
+}
+
+// SelectBans lists the active bans of the forum, or the global ones when the
+// forum is empty.
+func (p *postgresAppRepository) SelectBans(forum string, parameters models.QueryParameters) ([]models.Ban, error) {
+	rows, err := p.db().Query(
+		`SELECT `+banColumns+` FROM ban
+		WHERE forum IS NOT DISTINCT FROM NULLIF($1, '') AND `+activeBan+`
+		ORDER BY id DESC LIMIT NULLIF($2, 0)`,
+		forum,
+		parameters.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanBans(rows)
+}
+
+// SelectActiveBans returns the active bans of the nicknames applying to the
+// forum: the forum bans and the global ones. Regular bans come before shadow
+// ones.
+func (p *postgresAppRepository) SelectActiveBans(forum string, nicknames []string) ([]models.Ban, error) {
+	if len(nicknames) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{forum}
+	placeholders := make([]string, 0, len(nicknames))
+	for _, nickname := range nicknames {
+		args = append(args, nickname)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := p.db().Query(
+		`SELECT `+banColumns+` FROM ban
+		WHERE nickname IN (`+strings.Join(placeholders, ", ")+`)
+		AND (forum IS NULL OR forum = $1) AND `+activeBan+`
+		ORDER BY shadow, id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanBans(rows)
+}
+
+func (p *postgresAppRepository) DeleteBan(id int) error {
+	_, err := p.db().Exec(`DELETE FROM ban WHERE id=$1`, id)
+
+	return err
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+)
+
+func (p *postgresAppRepository) InsertUserBlock(blocker, blocked string) (models.UserBlock, error) {
+	var block models.UserBlock
+	var created time.Time
+
+	err := p.db().QueryRow(
+		`INSERT INTO user_block (blocker, blocked) VALUES ($1, $2)
+		ON CONFLICT (blocker, blocked) DO UPDATE SET blocker = EXCLUDED.blocker
+		RETURNING blocker, blocked, created`,
+		blocker,
+		blocked,
+	).Scan(&block.Blocker, &block.Blocked, &created)
+	if err != nil {
+		return models.UserBlock{}, err
+	}
+
+	block.Created = strfmt.DateTime(created.UTC()).String()
+
+	return block, nil
+}
+
+func (p *postgresAppRepository) DeleteUserBlock(blocker, blocked string) error {
+	_, err := p.db().Exec(`DELETE FROM user_block WHERE blocker=$1 AND blocked=$2`, blocker, blocked)
+
+	return err
+}
+
+func (p *postgresAppRepository) SelectUserBlocks(blocker string) ([]models.UserBlock, error) {
+	rows, err := p.db().Query(
+		`SELECT blocker, blocked, created FROM user_block WHERE blocker=$1 ORDER BY created DESC`,
+		blocker,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var blocks []models.UserBlock
+	for rows.Next() {
+		var block models.UserBlock
+		var created time.Time
+
+		if err := rows.Scan(&block.Blocker, &block.Blocked, &created); err != nil {
+			return nil, err
+		}
+
+		block.Created = strfmt.DateTime(created.UTC()).String()
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks, rows.Err()
+}
+
+// SelectBlockers returns which of the users have blocked the nickname.
+func (p *postgresAppRepository) SelectBlockers(nickname string, users []string) ([]string, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{nickname}
+	placeholders := make([]string, 0, len(users))
+	for _, user := range users {
+		args = append(args, user)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := p.db().Query(
+		`SELECT blocker FROM user_block WHERE blocked = $1 AND blocker IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var blockers []string
+	for rows.Next() {
+		var blocker string
+		if err := rows.Scan(&blocker); err != nil {
+			return nil, err
+		}
+
+		blockers = append(blockers, blocker)
+	}
+
+	return blockers, rows.Err()
+}
+
+func (p *postgresAppRepository) InsertUserMute(muter, muted string) (models.UserMute, error) {
+	var mute models.UserMute
+	var created time.Time
+
+	err := p.db().QueryRow(
+		`INSERT INTO user_mute (muter, muted) VALUES ($1, $2)
+		ON CONFLICT (muter, muted) DO UPDATE SET muter = EXCLUDED.muter
+		RETURNING muter, muted, created`,
+		muter,
+		muted,
+	).Scan(&mute.Muter, &mute.Muted, &created)
+	if err != nil {
+		return models.UserMute{}, err
+	}
+
+	mute.Created = strfmt.DateTime(created.UTC()).String()
+
+	return mute, nil
+}
+
+func (p *postgresAppRepository) DeleteUserMute(muter, muted string) error {
+	_, err := p.db().Exec(`DELETE FROM user_mute WHERE muter=$1 AND muted=$2`, muter, muted)
+
+	return err
+}
+
+func (p *postgresAppRepository) SelectUserMutes(muter string) ([]models.UserMute, error) {
+	rows, err := p.db().Query(
+		`SELECT muter, muted, created FROM user_mute WHERE muter=$1 ORDER BY created DESC`,
+		muter,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var mutes []models.UserMute
+	for rows.Next() {
+		var mute models.UserMute
+		var created time.Time
+
+		if err := rows.Scan(&mute.Muter, &mute.Muted, &created); err != nil {
+			return nil, err
+		}
+
+		mute.Created = strfmt.DateTime(created.UTC()).String()
+
+		mutes = append(mutes, mute)
+	}
+
+	return mutes, rows.Err()
+}
+
+// SelectHiddenAuthors returns the users muted or blocked by the nickname.
+func (p *postgresAppRepository) SelectHiddenAuthors(nickname string) ([]string, error) {
+	rows, err := p.db().Query(
+		`SELECT muted FROM user_mute WHERE muter=$1
+		UNION SELECT blocked FROM user_block WHERE blocker=$1`,
+		nickname,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var authors []string
+	for rows.Next() {
+		var author string
+		if err := rows.Scan(&author); err != nil {
+			return nil, err
+		}
+
+		authors = append(authors, author)
+	}
+
+	return authors, rows.Err()
+}
+
+// SelectPostAuthors maps the ids of existing posts to their authors.
+func (p *postgresAppRepository) SelectPostAuthors(ids []int) (map[int]string, error) {
+	authors := make(map[int]string, len(ids))
+	if len(ids) == 0 {
+		return authors, nil
+	}
+
+	args := make([]interface{}, 0, len(ids))
+	placeholders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := p.db().Query(
+		`SELECT id, author FROM post WHERE id IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var author string
+		if err := rows.Scan(&id, &author); err != nil {
+			return nil, err
+		}
+
+		authors[id] = author
+	}
+
+	return authors, rows.Err()
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+const categoryColumns = `id, title, COALESCE(parent, 0), position, posts, threads`
+
+func scanCategory(row scanner) (models.Category, error) {
+	var category models.Category
+	err := row.Scan(
+		&category.Id,
+		&category.Title,
+		&category.Parent,
+		&category.Position,
+		&category.Posts,
+		&category.Threads,
+	)
+
+	return category, err
+}
+
+func (p *postgresAppRepository) InsertCategory(category models.Category) (models.Category, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO category (title, parent, position) VALUES ($1, NULLIF($2, 0), $3) RETURNING `+categoryColumns,
+		category.Title,
+		category.Parent,
+		category.Position,
+	)
+
+	return scanCategory(row)
+}
+
+func (p *postgresAppRepository) UpdateCategory(category models.Category) (models.Category, error) {
+	row := p.db().QueryRow(
+		`UPDATE category SET title=$1, parent=NULLIF($2, 0), position=$3 WHERE id=$4 RETURNING `+categoryColumns,
+		category.Title,
+		category.Parent,
+		category.Position,
+		category.Id,
+	)
+
+	return scanCategory(row)
+}
+
+func (p *postgresAppRepository) SelectCategoryById(id int) (models.Category, error) {
+	row := p.db().QueryRow(`SELECT `+categoryColumns+` FROM category WHERE id=$1`, id)
+
+	return scanCategory(row)
+}
+
+func (p *postgresAppRepository) SelectCategories() ([]models.Category, error) {
+	rows, err := p.db().Query(`SELECT ` + categoryColumns + ` FROM category ORDER BY position, id`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// SelectPlacedForums selects the forums put into a category or under a parent.
+func (p *postgresAppRepository) SelectPlacedForums() ([]models.Forum, error) {
+	rows, err := p.db().Query(
+		`SELECT ` + forumColumns + ` FROM forum WHERE category IS NOT NULL OR parent IS NOT NULL
+		ORDER BY position, slug`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var forums []models.Forum
+	for rows.Next() {
+		forum, err := scanForum(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		forums = append(forums, forum)
+	}
+
+	return forums, rows.Err()
+}
+
+func (p *postgresAppRepository) UpdateForumPlacement(slug string, placement models.ForumPlacement) (models.Forum, error) {
+	row := p.db().QueryRow(
+		`UPDATE forum SET category=NULLIF($1, 0), parent=NULLIF($2, ''), position=$3 WHERE slug=$4
+		RETURNING `+forumColumns,
+		placement.Category,
+		placement.Parent,
+		placement.Position,
+		slug,
+	)
+
+	return scanForum(row)
+}
+
+// IsCategoryDescendant reports whether the candidate is the category itself
+// or lies anywhere below it.
+func (p *postgresAppRepository) IsCategoryDescendant(id, candidate int) (bool, error) {
+	var descendant bool
+	err := p.db().QueryRow(
+		`WITH RECURSIVE below AS (
+			SELECT id FROM category WHERE id=$1
+			UNION SELECT c.id FROM category c JOIN below ON c.parent = below.id
+		)
+		SELECT EXISTS(SELECT 1 FROM below WHERE id=$2)`,
+		id,
+		candidate,
+	).Scan(&descendant)
+
+	return descendant, err
+}
+
+// IsForumDescendant reports whether the candidate is the forum itself or one
+// of its sub-forums at any depth.
+func (p *postgresAppRepository) IsForumDescendant(slug, candidate string) (bool, error) {
+	var descendant bool
+	err := p.db().QueryRow(
+		`WITH RECURSIVE below AS (
+			SELECT slug FROM forum WHERE slug=$1
+			UNION SELECT f.slug FROM forum f JOIN below ON f.parent = below.slug
+		)
+		SELECT EXISTS(SELECT 1 FROM below WHERE slug=$2)`,
+		slug,
+		candidate,
+	).Scan(&descendant)
+
+	return descendant, err
+}
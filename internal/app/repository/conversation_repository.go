@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+// conversationColumns expects the conversation aliased as c and the member
+// row of the viewer as m.
+const conversationColumns = `c.id, c.title, c.direct,
+	ARRAY(SELECT nickname::TEXT FROM conversation_member WHERE conversation = c.id ORDER BY nickname),
+	c.created_by, c.created, c.last_message_at, c.messages, GREATEST(c.messages - m.seen, 0)`
+
+func scanConversation(row scanner) (models.Conversation, error) {
+	var conversation models.Conversation
+	var members pgtype.TextArray
+	var created time.Time
+	var lastMessageAt pgtype.Timestamptz
+
+	err := row.Scan(
+		&conversation.Id,
+		&conversation.Title,
+		&conversation.Direct,
+		&members,
+		&conversation.CreatedBy,
+		&created,
+		&lastMessageAt,
+		&conversation.Messages,
+		&conversation.Unread,
+	)
+	if err != nil {
+		return models.Conversation{}, err
+	}
+
+	conversation.Members = make([]string, 0, len(members.Elements))
+	for _, member := range members.Elements {
+		conversation.Members = append(conversation.Members, member.String)
+	}
+
+	conversation.Created = strfmt.DateTime(created.UTC()).String()
+	if lastMessageAt.Status == pgtype.Present {
+		conversation.LastMessageAt = strfmt.DateTime(lastMessageAt.Time.UTC()).String()
+	}
+
+	return conversation, nil
+}
+
+// InsertConversation creates the conversation with its members in one
+// transaction.
+func (p *postgresAppRepository) InsertConversation(conversation models.Conversation) (models.Conversation, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.Conversation{}, err
+	}
+
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(
+		`INSERT INTO conversation (title, direct, created_by) VALUES ($1, $2, $3) RETURNING id`,
+		conversation.Title,
+		conversation.Direct,
+		conversation.CreatedBy,
+	).Scan(&id)
+	if err != nil {
+		return models.Conversation{}, err
+	}
+
+	insert := `INSERT INTO conversation_member (conversation, nickname) VALUES `
+	values := []interface{}{id}
+	for _, member := range conversation.Members {
+		values = append(values, member)
+		insert += fmt.Sprintf("($1, $%d),", len(values))
+	}
+
+	if _, err := tx.Exec(strings.TrimSuffix(insert, ","), values...); err != nil {
+		return models.Conversation{}, err
+	}
+
+	result, err := scanConversation(tx.QueryRow(
+		`SELECT `+conversationColumns+` FROM conversation c
+		JOIN conversation_member m ON m.conversation = c.id AND m.nickname = $2
+		WHERE c.id = $1`,
+		id,
+		conversation.CreatedBy,
+	))
+	if err != nil {
+		return models.Conversation{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Conversation{}, err
+	}
+
+	return result, nil
+}
+
+// SelectDirectConversation finds the direct conversation of the two users.
+func (p *postgresAppRepository) SelectDirectConversation(viewer, other string) (models.Conversation, error) {
+	row := p.db().QueryRow(
+		`SELECT `+conversationColumns+` FROM conversation c
+		JOIN conversation_member m ON m.conversation = c.id AND m.nickname = $1
+		WHERE c.direct AND EXISTS(SELECT 1 FROM conversation_member WHERE conversation = c.id AND nickname = $2)
+		LIMIT 1`,
+		viewer,
+		other,
+	)
+
+	return scanConversation(row)
+}
+
+// SelectConversationById selects the conversation as seen by its member. It
+// fails with pgx.ErrNoRows for other users.
+func (p *postgresAppRepository) SelectConversationById(id int, viewer string) (models.Conversation, error) {
+	row := p.db().QueryRow(
+		`SELECT `+conversationColumns+` FROM conversation c
+		JOIN conversation_member m ON m.conversation = c.id AND m.nickname = $2
+		WHERE c.id = $1`,
+		id,
+		viewer,
+	)
+
+	return scanConversation(row)
+}
+
+// SelectConversations lists the conversations of the user, the most recently
+// active first. Since is the id of the last conversation of the previous page.
+func (p *postgresAppRepository) SelectConversations(nickname string, parameters models.QueryParameters) ([]models.Conversation, error) {
+	query := `SELECT ` + conversationColumns + ` FROM conversation c
+		JOIN conversation_member m ON m.conversation = c.id AND m.nickname = $1`
+	args := []interface{}{nickname}
+
+	if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, since)
+		query += fmt.Sprintf(` WHERE (COALESCE(c.last_message_at, c.created), c.id) <
+			(SELECT COALESCE(last_message_at, created), id FROM conversation WHERE id = $%d)`, len(args))
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY COALESCE(c.last_message_at, c.created) DESC, c.id DESC LIMIT NULLIF($%d, 0)`, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		conversation, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, conversation)
+	}
+
+	return conversations, rows.Err()
+}
+
+const conversationMessageColumns = `id, conversation, author, message, created, isEdited`
+
+func scanConversationMessage(row scanner) (models.ConversationMessage, error) {
+	var message models.ConversationMessage
+	var created time.Time
+
+	err := row.Scan(
+		&message.Id,
+		&message.Conversation,
+		&message.Author,
+		&message.Message,
+		&created,
+		&message.IsEdited,
+	)
+	if err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	message.Created = strfmt.DateTime(created.UTC()).String()
+
+	return message, nil
+}
+
+// InsertConversationMessage stores the message, bumps the conversation
+// counters and marks the conversation read for the author, in one transaction.
+func (p *postgresAppRepository) InsertConversationMessage(message models.ConversationMessage) (models.ConversationMessage, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := scanConversationMessage(tx.QueryRow(
+		`INSERT INTO conversation_message (conversation, author, message) VALUES ($1, $2, $3)
+		RETURNING `+conversationMessageColumns,
+		message.Conversation,
+		message.Author,
+		message.Message,
+	))
+	if err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	_, err = tx.Exec(
+		`WITH counter AS (
+			UPDATE conversation SET messages = messages + 1, last_message_at = NOW()
+			WHERE id = $1 RETURNING messages
+		)
+		UPDATE conversation_member SET last_read = $3, seen = (SELECT messages FROM counter)
+		WHERE conversation = $1 AND nickname = $2`,
+		result.Conversation,
+		result.Author,
+		result.Id,
+	)
+	if err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	return result, nil
+}
+
+func (p *postgresAppRepository) SelectConversationMessageById(id int) (models.ConversationMessage, error) {
+	row := p.db().QueryRow(`SELECT `+conversationMessageColumns+` FROM conversation_message WHERE id=$1`, id)
+
+	return scanConversationMessage(row)
+}
+
+// SelectConversationMessages pages through the messages by id. Since is the
+// id of the last message of the previous page.
+func (p *postgresAppRepository) SelectConversationMessages(conversation int, parameters models.QueryParameters) ([]models.ConversationMessage, error) {
+	query := `SELECT ` + conversationMessageColumns + ` FROM conversation_message WHERE conversation=$1`
+	args := []interface{}{conversation}
+
+	order, direction := ">", "ASC"
+	if parameters.Desc {
+		order, direction = "<", "DESC"
+	}
+
+	if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, since)
+		query += fmt.Sprintf(` AND id %s $%d`, order, len(args))
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY id %s LIMIT NULLIF($%d, 0)`, direction, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var messages []models.ConversationMessage
+	for rows.Next() {
+		message, err := scanConversationMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func (p *postgresAppRepository) UpdateConversationMessage(id int, message string) (models.ConversationMessage, error) {
+	row := p.db().QueryRow(
+		`UPDATE conversation_message SET message=$1, isEdited = isEdited OR message <> $1
+		WHERE id=$2 RETURNING `+conversationMessageColumns,
+		message,
+		id,
+	)
+
+	return scanConversationMessage(row)
+}
+
+// MarkConversationRead moves the read marker of the member up to the message,
+// or to the last message when it is zero, and returns the unread count left.
+func (p *postgresAppRepository) MarkConversationRead(conversation int, nickname string, message int) (int, error) {
+	var unread int
+	err := p.db().QueryRow(
+		`UPDATE conversation_member m
+		SET last_read = marker.id,
+			seen = (SELECT COUNT(*) FROM conversation_message WHERE conversation = $1 AND id <= marker.id)
+		FROM (SELECT CASE WHEN $3 = 0
+					 THEN COALESCE((SELECT MAX(id) FROM conversation_message WHERE conversation = $1), 0)
+					 ELSE $3 END AS id) AS marker
+		WHERE m.conversation = $1 AND m.nickname = $2
+		RETURNING GREATEST((SELECT messages FROM conversation WHERE id = $1) - m.seen, 0)`,
+		conversation,
+		nickname,
+		message,
+	).Scan(&unread)
+	if err == pgx.ErrNoRows {
+		return 0, models.ErrNotParticipant
+	}
+
+	return unread, err
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx"
+)
+
+// Banned words are kept one per line.
+const filterRuleColumns = `id, COALESCE(forum, ''), kind, action, words, pattern, replacement,
+	max_links, new_user_posts, window_seconds, dry_run, created_by, created`
+
+func scanFilterRule(row scanner) (models.FilterRule, error) {
+	var rule models.FilterRule
+	var words string
+	var created time.Time
+
+	err := row.Scan(
+		&rule.Id,
+		&rule.Forum,
+		&rule.Kind,
+		&rule.Action,
+		&words,
+		&rule.Pattern,
+		&rule.Replacement,
+		&rule.MaxLinks,
+		&rule.NewUserPosts,
+		&rule.Window,
+		&rule.DryRun,
+		&rule.CreatedBy,
+		&created,
+	)
+	if err != nil {
+		return models.FilterRule{}, err
+	}
+
+	if words != "" {
+		rule.Words = strings.Split(words, "\n")
+	}
+	rule.Created = strfmt.DateTime(created.UTC()).String()
+
+	return rule, nil
+}
+
+func scanFilterRules(rows *pgx.Rows) ([]models.FilterRule, error) {
+	defer rows.Close()
+
+	var rules []models.FilterRule
+	for rows.Next() {
+		rule, err := scanFilterRule(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (p *postgresAppRepository) InsertFilterRule(rule models.FilterRule) (models.FilterRule, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO filter_rule (forum, kind, action, words, pattern, replacement,
+								  max_links, new_user_posts, window_seconds, dry_run, created_by)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+filterRuleColumns,
+		rule.Forum,
+		rule.Kind,
+		rule.Action,
+		strings.Join(rule.Words, "\n"),
+		rule.Pattern,
+		rule.Replacement,
+		rule.MaxLinks,
+		rule.NewUserPosts,
+		rule.Window,
+		rule.DryRun,
+		rule.CreatedBy,
+	)
+
+	return scanFilterRule(row)
+}
+
+// SelectFilterRules returns the rules applying to the forum, the global ones
+// first. An empty forum selects every rule.
+func (p *postgresAppRepository) SelectFilterRules(forum string) ([]models.FilterRule, error) {
+	rows, err := p.db().Query(
+		`SELECT `+filterRuleColumns+` FROM filter_rule
+		WHERE $1 = '' OR forum IS NULL OR forum = $1
+		ORDER BY forum NULLS FIRST, id`,
+		forum,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanFilterRules(rows)
+}
+
+func (p *postgresAppRepository) DeleteFilterRule(id int) error {
+	tag, err := p.db().Exec(`DELETE FROM filter_rule WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// InsertFilterHits records the hits on the pool, outside of the unit of work,
+// so that the hits of a rejected message outlive the rollback the rejection
+// causes.
+func (p *postgresAppRepository) InsertFilterHits(hits []models.FilterHit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	insert := `INSERT INTO filter_hit (rule, forum, author, action, dry_run, excerpt) VALUES `
+	var values []interface{}
+	for i, hit := range hits {
+		insert += fmt.Sprintf(
+			"($%d, $%d, $%d, $%d, $%d, $%d),",
+			i*6+1, i*6+2, i*6+3, i*6+4, i*6+5, i*6+6,
+		)
+
+		values = append(values, hit.Rule, hit.Forum, hit.Author, hit.Action, hit.DryRun, hit.Excerpt)
+	}
+
+	_, err := p.Conn.Exec(strings.TrimSuffix(insert, ","), values...)
+
+	return err
+}
+
+func (p *postgresAppRepository) SelectFilterHits(parameters models.QueryParameters) ([]models.FilterHit, error) {
+	rows, err := p.db().Query(
+		`SELECT id, rule, forum, author, action, dry_run, excerpt, created FROM filter_hit
+		WHERE $1 = '' OR forum = $1
+		ORDER BY id DESC LIMIT NULLIF($2, 0)`,
+		parameters.Forum,
+		parameters.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var hits []models.FilterHit
+	for rows.Next() {
+		var hit models.FilterHit
+		var created time.Time
+
+		err := rows.Scan(
+			&hit.Id,
+			&hit.Rule,
+			&hit.Forum,
+			&hit.Author,
+			&hit.Action,
+			&hit.DryRun,
+			&hit.Excerpt,
+			&created,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		hit.Created = strfmt.DateTime(created.UTC()).String()
+
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// CountPostsByAuthor counts the threads and posts of the user, which tells new
+// users apart.
+func (p *postgresAppRepository) CountPostsByAuthor(nickname string) (int, error) {
+	var count int
+	err := p.db().QueryRow(
+		`SELECT (SELECT COUNT(*) FROM post WHERE author=$1) + (SELECT COUNT(*) FROM thread WHERE author=$1)`,
+		nickname,
+	).Scan(&count)
+
+	return count, err
+}
+
+// HasRecentMessage reports whether the user posted the same message as a
+// thread or a post in the last window seconds.
+func (p *postgresAppRepository) HasRecentMessage(nickname, message string, window int) (bool, error) {
+	var found bool
+	err := p.db().QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM post WHERE author=$1 AND message=$2 AND created > NOW() - $3 * INTERVAL '1 second')
+			 OR EXISTS(SELECT 1 FROM thread WHERE author=$1 AND message=$2 AND created > NOW() - $3 * INTERVAL '1 second')`,
+		nickname,
+		message,
+		window,
+	).Scan(&found)
+
+	return found, err
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+// forumSortKeys maps the sort modes of the forum listing to their columns.
+var forumSortKeys = map[string]string{
+	models.ForumSortPosts:   `posts`,
+	models.ForumSortThreads: `threads`,
+	models.ForumSortTitle:   `title`,
+}
+
+// SelectForums pages all forums ordered by the sort key with the slug as a tie
+// breaker, so since is the slug of the last forum of the previous page.
+func (p *postgresAppRepository) SelectForums(parameters models.QueryParameters) ([]models.Forum, error) {
+	key, ok := forumSortKeys[parameters.Sort]
+	if !ok {
+		key = forumSortKeys[models.ForumSortPosts]
+	}
+
+	var args []interface{}
+	query := `SELECT ` + forumColumns + ` FROM forum WHERE TRUE`
+
+	order, direction := ">", "ASC"
+	if parameters.Desc {
+		order, direction = "<", "DESC"
+	}
+
+	if parameters.Since != "" {
+		args = append(args, parameters.Since)
+		query += fmt.Sprintf(` AND (%s, slug) %s (SELECT %s, slug FROM forum WHERE slug=$%d)`, key, order, key, len(args))
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY %s %s, slug %s LIMIT NULLIF($%d, 0)`, key, direction, direction, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var forums []models.Forum
+	for rows.Next() {
+		forum, err := scanForum(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		forums = append(forums, forum)
+	}
+
+	return forums, rows.Err()
+}
+
+// UpdateForum changes the title and the owner of the forum. The new owner
+// takes over the owner membership and the previous one stays a member. A
+// non-zero version must be the current one.
+func (p *postgresAppRepository) UpdateForum(forum models.Forum) (models.Forum, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	defer tx.Rollback()
+
+	var owner string
+	var version int
+	err = tx.QueryRow(`SELECT "user", version FROM forum WHERE slug=$1 FOR UPDATE`, forum.Slug).Scan(&owner, &version)
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	if forum.Version != 0 && forum.Version != version {
+		return models.Forum{}, models.ErrVersionMismatch
+	}
+
+	result, err := scanForum(tx.QueryRow(
+		`UPDATE forum SET title=COALESCE(NULLIF($1, ''), title), "user"=COALESCE(NULLIF($2, ''), "user")
+		WHERE slug=$3 RETURNING `+forumColumns,
+		forum.Title,
+		forum.User,
+		forum.Slug,
+	))
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	if result.User != owner {
+		_, err = tx.Exec(
+			`UPDATE forum_member SET role=$1 WHERE forum=$2 AND nickname=$3 AND role=$4`,
+			models.MemberRoleMember,
+			result.Slug,
+			owner,
+			models.MemberRoleOwner,
+		)
+		if err != nil {
+			return models.Forum{}, err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO forum_member (forum, nickname, role) VALUES ($1, $2, $3)
+			ON CONFLICT (forum, nickname) DO UPDATE SET role = EXCLUDED.role`,
+			result.Slug,
+			result.User,
+			models.MemberRoleOwner,
+		)
+		if err != nil {
+			return models.Forum{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Forum{}, err
+	}
+
+	return result, nil
+}
+
+func (p *postgresAppRepository) ArchiveForum(slug string) (models.Forum, error) {
+	row := p.db().QueryRow(`UPDATE forum SET archived=TRUE WHERE slug=$1 RETURNING `+forumColumns, slug)
+
+	return scanForum(row)
+}
+
+// forumDeletes remove everything that refers to the forum, dependants first.
+var forumDeletes = []string{
+	`DELETE FROM filter_hit WHERE forum=$1`,
+	`DELETE FROM filter_rule WHERE forum=$1`,
+	`DELETE FROM moderation_log WHERE forum=$1`,
+	`DELETE FROM report WHERE forum=$1`,
+	`DELETE FROM ban WHERE forum=$1`,
+	`DELETE FROM join_request WHERE forum=$1`,
+	`DELETE FROM invitation WHERE forum=$1`,
+	`DELETE FROM forum_member WHERE forum=$1`,
+	`DELETE FROM forum_moderator WHERE forum=$1`,
+	`DELETE FROM thread_read WHERE thread_id IN (SELECT id FROM thread WHERE forum=$1)`,
+	`DELETE FROM votes WHERE thread_id IN (SELECT id FROM thread WHERE forum=$1)`,
+	`DELETE FROM thread_tag WHERE forum=$1`,
+	`DELETE FROM poll_vote WHERE poll IN (SELECT p.id FROM poll p JOIN thread t ON t.id = p.thread WHERE t.forum=$1)`,
+	`DELETE FROM poll_option WHERE poll IN (SELECT p.id FROM poll p JOIN thread t ON t.id = p.thread WHERE t.forum=$1)`,
+	`DELETE FROM poll WHERE thread IN (SELECT id FROM thread WHERE forum=$1)`,
+	`DELETE FROM rename_history WHERE kind='thread' AND name IN (SELECT slug FROM thread WHERE forum=$1)`,
+	`DELETE FROM rename_history WHERE kind='forum' AND name=$1`,
+	`DELETE FROM post WHERE forum=$1`,
+	`DELETE FROM thread WHERE forum=$1`,
+	`DELETE FROM users_forum WHERE slug=$1`,
+}
+
+// DeleteForum removes the forum with its threads, posts, votes and users in
+// one transaction. Attachments of the posts are left orphaned for cleanup.
+func (p *postgresAppRepository) DeleteForum(slug string) error {
+	tx, err := p.begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, query := range forumDeletes {
+		if _, err := tx.Exec(query, slug); err != nil {
+			return err
+		}
+	}
+
+	tag, err := tx.Exec(`DELETE FROM forum WHERE slug=$1`, slug)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return tx.Commit()
+}
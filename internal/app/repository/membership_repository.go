@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func (p *postgresAppRepository) UpdateForumVisibility(forum, visibility string) (models.Forum, error) {
+	row := p.db().QueryRow(
+		`UPDATE forum SET visibility=$1 WHERE slug=$2 RETURNING `+forumColumns,
+		visibility,
+		forum,
+	)
+
+	return scanForum(row)
+}
+
+func (p *postgresAppRepository) IsForumMember(forum, nickname string) (bool, error) {
+	var member bool
+	err := p.db().QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM forum_member WHERE forum=$1 AND nickname=$2)`,
+		forum,
+		nickname,
+	).Scan(&member)
+
+	return member, err
+}
+
+func (p *postgresAppRepository) InsertForumMember(forum, nickname string) (models.ForumMember, error) {
+	return insertForumMember(p.db().QueryRow, forum, nickname)
+}
+
+// insertForumMember adds a member, or returns the existing membership with
+// its role untouched.
+func insertForumMember(queryRow func(sql string, args ...interface{}) *pgx.Row, forum, nickname string) (models.ForumMember, error) {
+	var member models.ForumMember
+	var joined time.Time
+
+	err := queryRow(
+		`INSERT INTO forum_member (forum, nickname, role) VALUES ($1, $2, $3)
+		ON CONFLICT (forum, nickname) DO UPDATE SET role = forum_member.role
+		RETURNING forum, nickname, role, joined`,
+		forum,
+		nickname,
+		models.MemberRoleMember,
+	).Scan(&member.Forum, &member.Nickname, &member.Role, &joined)
+	if err != nil {
+		return models.ForumMember{}, err
+	}
+
+	member.Joined = strfmt.DateTime(joined.UTC()).String()
+
+	return member, nil
+}
+
+func (p *postgresAppRepository) DeleteForumMember(forum, nickname string) error {
+	tag, err := p.db().Exec(
+		`WITH moderator AS (
+			DELETE FROM forum_moderator WHERE forum=$1 AND nickname=$2
+		)
+		DELETE FROM forum_member WHERE forum=$1 AND nickname=$2`,
+		forum,
+		nickname,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *postgresAppRepository) SelectForumMembers(forum string, parameters models.QueryParameters) ([]models.ForumMember, error) {
+	query := `SELECT forum, nickname, role, joined FROM forum_member WHERE forum=$1`
+	args := []interface{}{forum}
+
+	if parameters.Since != "" {
+		args = append(args, parameters.Since)
+		query += fmt.Sprintf(` AND nickname > $%d`, len(args))
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY nickname LIMIT NULLIF($%d, 0)`, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var members []models.ForumMember
+	for rows.Next() {
+		var member models.ForumMember
+		var joined time.Time
+
+		if err := rows.Scan(&member.Forum, &member.Nickname, &member.Role, &joined); err != nil {
+			return nil, err
+		}
+
+		member.Joined = strfmt.DateTime(joined.UTC()).String()
+
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+const joinRequestColumns = `id, forum, nickname, message, status, created, COALESCE(decided_by, ''), decided`
+
+func scanJoinRequest(row scanner) (models.JoinRequest, error) {
+	var request models.JoinRequest
+	var created time.Time
+	var decided pgtype.Timestamptz
+
+	err := row.Scan(
+		&request.Id,
+		&request.Forum,
+		&request.Nickname,
+		&request.Message,
+		&request.Status,
+		&created,
+		&request.DecidedBy,
+		&decided,
+	)
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	request.Created = strfmt.DateTime(created.UTC()).String()
+	if decided.Status == pgtype.Present {
+		request.Decided = strfmt.DateTime(decided.Time.UTC()).String()
+	}
+
+	return request, nil
+}
+
+// InsertJoinRequest files a request, or returns the pending one of the user.
+func (p *postgresAppRepository) InsertJoinRequest(request models.JoinRequest) (models.JoinRequest, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO join_request (forum, nickname, message) VALUES ($1, $2, $3)
+		ON CONFLICT (forum, nickname) WHERE status = 'pending' DO UPDATE SET message = EXCLUDED.message
+		RETURNING `+joinRequestColumns,
+		request.Forum,
+		request.Nickname,
+		request.Message,
+	)
+
+	return scanJoinRequest(row)
+}
+
+func (p *postgresAppRepository) SelectJoinRequestById(id int) (models.JoinRequest, error) {
+	row := p.db().QueryRow(`SELECT `+joinRequestColumns+` FROM join_request WHERE id=$1`, id)
+
+	return scanJoinRequest(row)
+}
+
+func (p *postgresAppRepository) SelectJoinRequests(forum, status string, parameters models.QueryParameters) ([]models.JoinRequest, error) {
+	query := `SELECT ` + joinRequestColumns + ` FROM join_request WHERE forum=$1 AND status=$2`
+	args := []interface{}{forum, status}
+
+	if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, since)
+		query += fmt.Sprintf(` AND id > $%d`, len(args))
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY id LIMIT NULLIF($%d, 0)`, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var requests []models.JoinRequest
+	for rows.Next() {
+		request, err := scanJoinRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+// DecideJoinRequest closes the pending request and adds the member when it is
+// approved, in one transaction.
+func (p *postgresAppRepository) DecideJoinRequest(request models.JoinRequest) (models.JoinRequest, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := scanJoinRequest(tx.QueryRow(
+		`UPDATE join_request SET status=$1, decided_by=$2, decided=NOW()
+		WHERE id=$3 AND status=$4 RETURNING `+joinRequestColumns,
+		request.Status,
+		request.DecidedBy,
+		request.Id,
+		models.JoinRequestPending,
+	))
+	if err == pgx.ErrNoRows {
+		return models.JoinRequest{}, models.ErrJoinRequestDecided
+	}
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	if result.Status == models.JoinRequestApproved {
+		if _, err := insertForumMember(tx.QueryRow, result.Forum, result.Nickname); err != nil {
+			return models.JoinRequest{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	return result, nil
+}
+
+const invitationColumns = `token, forum, COALESCE(nickname, ''), created_by, expires, max_uses, uses, created`
+
+func scanInvitation(row scanner) (models.Invitation, error) {
+	var invitation models.Invitation
+	var created time.Time
+	var expires pgtype.Timestamptz
+
+	err := row.Scan(
+		&invitation.Token,
+		&invitation.Forum,
+		&invitation.Nickname,
+		&invitation.CreatedBy,
+		&expires,
+		&invitation.MaxUses,
+		&invitation.Uses,
+		&created,
+	)
+	if err != nil {
+		return models.Invitation{}, err
+	}
+
+	invitation.Created = strfmt.DateTime(created.UTC()).String()
+	if expires.Status == pgtype.Present {
+		invitation.Expires = strfmt.DateTime(expires.Time.UTC()).String()
+	}
+
+	return invitation, nil
+}
+
+func (p *postgresAppRepository) InsertInvitation(invitation models.Invitation) (models.Invitation, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO invitation (token, forum, nickname, created_by, expires, max_uses)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, '')::TIMESTAMP WITH TIME ZONE, $6)
+		RETURNING `+invitationColumns,
+		invitation.Token,
+		invitation.Forum,
+		invitation.Nickname,
+		invitation.CreatedBy,
+		invitation.Expires,
+		invitation.MaxUses,
+	)
+
+	return scanInvitation(row)
+}
+
+// AcceptInvitation uses up the invitation and adds the member in one
+// transaction. Expired, used up and foreign invitations fail with
+// ErrBadInvitation.
+func (p *postgresAppRepository) AcceptInvitation(token, nickname string) (models.ForumMember, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.ForumMember{}, err
+	}
+
+	defer tx.Rollback()
+
+	invitation, err := scanInvitation(tx.QueryRow(
+		`UPDATE invitation SET uses = uses + 1
+		WHERE token=$1 AND (nickname IS NULL OR nickname=$2)
+		  AND (expires IS NULL OR expires > NOW()) AND (max_uses = 0 OR uses < max_uses)
+		RETURNING `+invitationColumns,
+		token,
+		nickname,
+	))
+	if err == pgx.ErrNoRows {
+		return models.ForumMember{}, models.ErrBadInvitation
+	}
+	if err != nil {
+		return models.ForumMember{}, err
+	}
+
+	member, err := insertForumMember(tx.QueryRow, invitation.Forum, nickname)
+	if err != nil {
+		return models.ForumMember{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ForumMember{}, err
+	}
+
+	return member, nil
+}
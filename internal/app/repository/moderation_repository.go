@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const reportColumns = `id, reporter, forum, thread, COALESCE(post, 0), reason, comment, status, created,
+	COALESCE(resolved_by, ''), resolved, COALESCE(action, '')`
+
+func scanReport(row scanner) (models.Report, error) {
+	var report models.Report
+	var created time.Time
+	var resolved pgtype.Timestamptz
+
+	err := row.Scan(
+		&report.Id,
+		&report.Reporter,
+		&report.Forum,
+		&report.Thread,
+		&report.Post,
+		&report.Reason,
+		&report.Comment,
+		&report.Status,
+		&created,
+		&report.ResolvedBy,
+		&resolved,
+		&report.Action,
+	)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	report.Created = strfmt.DateTime(created.UTC()).String()
+	if resolved.Status == pgtype.Present {
+		report.Resolved = strfmt.DateTime(resolved.Time.UTC()).String()
+	}
+
+	return report, nil
+}
+
+func (p *postgresAppRepository) InsertReport(report models.Report) (models.Report, error) {
+	row := p.db().QueryRow(
+		`INSERT INTO report (reporter, forum, thread, post, reason, comment)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6) RETURNING `+reportColumns,
+		report.Reporter,
+		report.Forum,
+		report.Thread,
+		report.Post,
+		report.Reason,
+		report.Comment,
+	)
+
+	return scanReport(row)
+}
+
+func (p *postgresAppRepository) SelectReportById(id int) (models.Report, error) {
+	row := p.db().QueryRow(`SELECT `+reportColumns+` FROM report WHERE id=$1`, id)
+
+	return scanReport(row)
+}
+
+// LockReport selects the report and locks it until the unit of work ends, so
+// that concurrent resolutions of it run one after another.
+func (p *postgresAppRepository) LockReport(id int) (models.Report, error) {
+	row := p.db().QueryRow(`SELECT `+reportColumns+` FROM report WHERE id=$1 FOR UPDATE`, id)
+
+	return scanReport(row)
+}
+
+func (p *postgresAppRepository) SelectReportsByForum(forum, status string, parameters models.QueryParameters) ([]models.Report, error) {
+	query := `SELECT ` + reportColumns + ` FROM report WHERE forum=$1 AND status=$2`
+	args := []interface{}{forum, status}
+
+	order, direction := ">", "ASC"
+	if parameters.Desc {
+		order, direction = "<", "DESC"
+	}
+
+	if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, since)
+		query += fmt.Sprintf(` AND id %s $%d`, order, len(args))
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` ORDER BY id %s LIMIT NULLIF($%d, 0)`, direction, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var reports []models.Report
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// ResolveReport closes the report and appends the entry to the moderation log
+// in one transaction.
+func (p *postgresAppRepository) ResolveReport(report models.Report, entry models.ModerationLogEntry) (models.Report, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := scanReport(tx.QueryRow(
+		`UPDATE report SET status=$1, resolved_by=$2, resolved=NOW(), action=$3
+		WHERE id=$4 AND status=$5 RETURNING `+reportColumns,
+		report.Status,
+		report.ResolvedBy,
+		report.Action,
+		report.Id,
+		models.ReportStatusOpen,
+	))
+	if err == pgx.ErrNoRows {
+		return models.Report{}, models.ErrReportResolved
+	}
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	if err := insertModerationLog(tx, entry); err != nil {
+		return models.Report{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Report{}, err
+	}
+
+	return result, nil
+}
+
+func insertModerationLog(tx querier, entry models.ModerationLogEntry) error {
+	_, err := tx.Exec(
+		`INSERT INTO moderation_log (report, forum, moderator, action, target, comment)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)`,
+		entry.Report,
+		entry.Forum,
+		entry.Moderator,
+		entry.Action,
+		entry.Target,
+		entry.Comment,
+	)
+
+	return err
+}
+
+func (p *postgresAppRepository) SelectModerationLog(forum string, parameters models.QueryParameters) ([]models.ModerationLogEntry, error) {
+	rows, err := p.db().Query(
+		`SELECT id, COALESCE(report, 0), forum, moderator, action, target, comment, created
+		FROM moderation_log WHERE forum=$1 ORDER BY id DESC LIMIT NULLIF($2, 0)`,
+		forum,
+		parameters.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []models.ModerationLogEntry
+	for rows.Next() {
+		var entry models.ModerationLogEntry
+		var created time.Time
+
+		err := rows.Scan(
+			&entry.Id,
+			&entry.Report,
+			&entry.Forum,
+			&entry.Moderator,
+			&entry.Action,
+			&entry.Target,
+			&entry.Comment,
+			&created,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Created = strfmt.DateTime(created.UTC()).String()
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (p *postgresAppRepository) IsForumModerator(forum, nickname string) (bool, error) {
+	var moderator bool
+	err := p.db().QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM forum WHERE slug=$1 AND "user"=$2)
+			 OR EXISTS(SELECT 1 FROM forum_moderator WHERE forum=$1 AND nickname=$2)`,
+		forum,
+		nickname,
+	).Scan(&moderator)
+
+	return moderator, err
+}
+
+// InsertForumModerator makes the user a moderator and a member of the forum.
+func (p *postgresAppRepository) InsertForumModerator(forum, nickname string) error {
+	_, err := p.db().Exec(
+		`WITH moderator AS (
+			INSERT INTO forum_moderator (forum, nickname) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		)
+		INSERT INTO forum_member (forum, nickname, role) VALUES ($1, $2, $3)
+		ON CONFLICT (forum, nickname) DO UPDATE SET role = EXCLUDED.role
+		WHERE forum_member.role = $4`,
+		forum,
+		nickname,
+		models.MemberRoleModerator,
+		models.MemberRoleMember,
+	)
+
+	return err
+}
+
+func (p *postgresAppRepository) SelectForumModerators(forum string) ([]string, error) {
+	rows, err := p.db().Query(
+		`SELECT "user" FROM forum WHERE slug=$1
+		UNION SELECT nickname FROM forum_moderator WHERE forum=$1`,
+		forum,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	moderators := []string{}
+	for rows.Next() {
+		var nickname string
+		if err := rows.Scan(&nickname); err != nil {
+			return nil, err
+		}
+
+		moderators = append(moderators, nickname)
+	}
+
+	return moderators, rows.Err()
+}
+
+func (p *postgresAppRepository) HidePost(id int) error {
+	_, err := p.db().Exec(`UPDATE post SET hidden=TRUE WHERE id=$1`, id)
+
+	return err
+}
+
+func (p *postgresAppRepository) LockThread(id int) error {
+	_, err := p.db().Exec(`UPDATE thread SET locked=TRUE WHERE id=$1`, id)
+
+	return err
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/jackc/pgx/pgtype"
+)
+
+const pollColumns = `id, thread, question, multiple, anonymous, closes, COALESCE(closes <= NOW(), FALSE),
+	created_by, created, voters`
+
+func scanPoll(row scanner) (models.Poll, error) {
+	var poll models.Poll
+	var closes pgtype.Timestamptz
+	var created time.Time
+
+	err := row.Scan(
+		&poll.Id,
+		&poll.Thread,
+		&poll.Question,
+		&poll.Multiple,
+		&poll.Anonymous,
+		&closes,
+		&poll.Closed,
+		&poll.CreatedBy,
+		&created,
+		&poll.Voters,
+	)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	poll.Created = strfmt.DateTime(created.UTC()).String()
+	if closes.Status == pgtype.Present {
+		poll.Closes = strfmt.DateTime(closes.Time.UTC()).String()
+	}
+
+	return poll, nil
+}
+
+// InsertPoll creates the poll with its options in one transaction.
+func (p *postgresAppRepository) InsertPoll(poll models.Poll) (models.Poll, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := scanPoll(tx.QueryRow(
+		`INSERT INTO poll (thread, question, multiple, anonymous, closes, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::TIMESTAMPTZ, $6) RETURNING `+pollColumns,
+		poll.Thread,
+		poll.Question,
+		poll.Multiple,
+		poll.Anonymous,
+		poll.Closes,
+		poll.CreatedBy,
+	))
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	for i, option := range poll.Options {
+		option.Votes = 0
+		err := tx.QueryRow(
+			`INSERT INTO poll_option (poll, position, title) VALUES ($1, $2, $3) RETURNING id`,
+			result.Id,
+			i,
+			option.Title,
+		).Scan(&option.Id)
+		if err != nil {
+			return models.Poll{}, err
+		}
+
+		result.Options = append(result.Options, option)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Poll{}, err
+	}
+
+	return result, nil
+}
+
+// SelectPollByThread selects the poll with its options and the choice of the
+// viewer. Voters are listed for polls that are not anonymous.
+func (p *postgresAppRepository) SelectPollByThread(thread int, viewer string) (models.Poll, error) {
+	poll, err := scanPoll(p.db().QueryRow(`SELECT `+pollColumns+` FROM poll WHERE thread=$1`, thread))
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	rows, err := p.db().Query(
+		`SELECT id, title, votes, EXISTS(SELECT 1 FROM poll_vote WHERE option = poll_option.id AND nickname = $2)
+		FROM poll_option WHERE poll=$1 ORDER BY position`,
+		poll.Id,
+		viewer,
+	)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	defer rows.Close()
+
+	positions := make(map[int]int)
+	for rows.Next() {
+		var option models.PollOption
+		var chosen bool
+		if err := rows.Scan(&option.Id, &option.Title, &option.Votes, &chosen); err != nil {
+			return models.Poll{}, err
+		}
+
+		if chosen {
+			poll.MyChoice = append(poll.MyChoice, option.Id)
+		}
+
+		positions[option.Id] = len(poll.Options)
+		poll.Options = append(poll.Options, option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.Poll{}, err
+	}
+
+	rows.Close()
+
+	if poll.Anonymous {
+		return poll, nil
+	}
+
+	voters, err := p.db().Query(
+		`SELECT option, nickname FROM poll_vote WHERE poll=$1 ORDER BY created, nickname`,
+		poll.Id,
+	)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	defer voters.Close()
+
+	for voters.Next() {
+		var option int
+		var nickname string
+		if err := voters.Scan(&option, &nickname); err != nil {
+			return models.Poll{}, err
+		}
+
+		i := positions[option]
+		poll.Options[i].Voters = append(poll.Options[i].Voters, nickname)
+	}
+
+	return poll, voters.Err()
+}
+
+// ReplacePollVote sets the options picked by the user, replacing the earlier
+// vote of the user on the poll.
+func (p *postgresAppRepository) ReplacePollVote(poll int, nickname string, options []int) error {
+	tx, err := p.begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var closed bool
+	err = tx.QueryRow(`SELECT COALESCE(closes <= NOW(), FALSE) FROM poll WHERE id=$1 FOR UPDATE`, poll).Scan(&closed)
+	if err != nil {
+		return err
+	}
+
+	if closed {
+		return models.ErrPollClosed
+	}
+
+	tag, err := tx.Exec(
+		`WITH removed AS (
+			DELETE FROM poll_vote WHERE poll=$1 AND nickname=$2 RETURNING option
+		)
+		UPDATE poll_option SET votes = votes - 1 WHERE id IN (SELECT option FROM removed)`,
+		poll,
+		nickname,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		if _, err := tx.Exec(`UPDATE poll SET voters = voters + 1 WHERE id=$1`, poll); err != nil {
+			return err
+		}
+	}
+
+	for _, option := range options {
+		tag, err := tx.Exec(`UPDATE poll_option SET votes = votes + 1 WHERE id=$1 AND poll=$2`, option, poll)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return models.ErrBadPollVote
+		}
+
+		_, err = tx.Exec(`INSERT INTO poll_vote (poll, option, nickname) VALUES ($1, $2, $3)`, poll, option, nickname)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The poll is shown with the thread, so a vote makes a new version of it.
+	_, err = tx.Exec(`UPDATE thread SET version = version + 1 WHERE id = (SELECT thread FROM poll WHERE id=$1)`, poll)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (p *postgresAppRepository) UpdateForumQA(forum string, qa bool) (models.Forum, error) {
+	row := p.db().QueryRow(`UPDATE forum SET qa=$1 WHERE slug=$2 RETURNING `+forumColumns, qa, forum)
+
+	return scanForum(row)
+}
+
+func (p *postgresAppRepository) UpdateThreadAnswer(thread, post int) (models.Thread, error) {
+	row := p.db().QueryRow(`UPDATE thread SET answer=NULLIF($1, 0) WHERE id=$2 RETURNING `+threadColumns, post, thread)
+
+	return scanThread(row)
+}
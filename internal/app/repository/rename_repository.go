@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+// Foreign keys on forum slugs and nicknames cascade renames by themselves,
+// these statements update the copies kept without a foreign key.
+var (
+	forumRenames = []string{
+		`UPDATE thread_tag SET forum=$2 WHERE forum=$1`,
+		`UPDATE moderation_log SET forum=$2 WHERE forum=$1`,
+		`UPDATE filter_hit SET forum=$2 WHERE forum=$1`,
+	}
+	userRenames = []string{
+		`UPDATE thread SET last_post_author=$2 WHERE last_post_author=$1`,
+		`UPDATE filter_hit SET author=$2 WHERE author=$1`,
+	}
+)
+
+// renameLive finds the entity that currently has the name, which then wins
+// over the history.
+var renameLive = map[string]string{
+	models.RenameKindForum:  `SELECT 1 FROM forum WHERE slug=$2`,
+	models.RenameKindThread: `SELECT 1 FROM thread WHERE slug=$2`,
+	models.RenameKindUser:   `SELECT 1 FROM users WHERE nickname=$2`,
+}
+
+// recordRename points the old name and all the names that led to it at the
+// new one. A name taken back is no longer an old name.
+func recordRename(tx querier, kind, old, name string) error {
+	if strings.EqualFold(old, name) {
+		return nil
+	}
+
+	_, err := tx.Exec(`UPDATE rename_history SET name=$3 WHERE kind=$1 AND name=$2`, kind, old, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM rename_history WHERE kind=$1 AND old=$2`, kind, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO rename_history (kind, old, name) VALUES ($1, $2, $3)
+		ON CONFLICT (kind, old) DO UPDATE SET name=EXCLUDED.name, renamed=NOW()`,
+		kind,
+		old,
+		name,
+	)
+
+	return err
+}
+
+func (p *postgresAppRepository) RenameForum(slug, name string) (models.Forum, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	defer tx.Rollback()
+
+	var old string
+	if err := tx.QueryRow(`SELECT slug FROM forum WHERE slug=$1 FOR UPDATE`, slug).Scan(&old); err != nil {
+		return models.Forum{}, err
+	}
+
+	result, err := scanForum(tx.QueryRow(`UPDATE forum SET slug=$2 WHERE slug=$1 RETURNING `+forumColumns, old, name))
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	for _, query := range forumRenames {
+		if _, err := tx.Exec(query, old, result.Slug); err != nil {
+			return models.Forum{}, err
+		}
+	}
+
+	if err := recordRename(tx, models.RenameKindForum, old, result.Slug); err != nil {
+		return models.Forum{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Forum{}, err
+	}
+
+	return result, nil
+}
+
+// RenameThread sets the slug given by the user, which replaces a generated one.
+func (p *postgresAppRepository) RenameThread(id int, slug string) (models.Thread, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	defer tx.Rollback()
+
+	var old string
+	if err := tx.QueryRow(`SELECT slug FROM thread WHERE id=$1 FOR UPDATE`, id).Scan(&old); err != nil {
+		return models.Thread{}, err
+	}
+
+	result, err := scanThread(tx.QueryRow(
+		`UPDATE thread SET slug=$2, slug_generated=FALSE WHERE id=$1 RETURNING `+threadColumns,
+		id,
+		slug,
+	))
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	if err := recordRename(tx, models.RenameKindThread, old, result.Slug); err != nil {
+		return models.Thread{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Thread{}, err
+	}
+
+	return result, nil
+}
+
+func (p *postgresAppRepository) RenameUser(nickname, name string) (models.User, error) {
+	tx, err := p.begin()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	defer tx.Rollback()
+
+	var old string
+	if err := tx.QueryRow(`SELECT nickname FROM users WHERE nickname=$1 FOR UPDATE`, nickname).Scan(&old); err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	err = tx.QueryRow(
+		`UPDATE users SET nickname=$2 WHERE nickname=$1 RETURNING nickname, fullname, about, email`,
+		old,
+		name,
+	).Scan(&user.Nickname, &user.FullName, &user.About, &user.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	for _, query := range userRenames {
+		if _, err := tx.Exec(query, old, user.Nickname); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if err := recordRename(tx, models.RenameKindUser, old, user.Nickname); err != nil {
+		return models.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// SelectRenamed returns the current name of what had the old name, unless
+// something has the old name now.
+func (p *postgresAppRepository) SelectRenamed(kind, old string) (string, error) {
+	live, ok := renameLive[kind]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+
+	var name string
+	err := p.db().QueryRow(
+		`SELECT name FROM rename_history WHERE kind=$1 AND old=$2 AND NOT EXISTS(`+live+`)`,
+		kind,
+		old,
+	).Scan(&name)
+
+	return name, err
+}
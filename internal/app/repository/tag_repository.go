@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// ReplaceThreadTags sets the tags of the thread in one transaction.
+func (p *postgresAppRepository) ReplaceThreadTags(thread int, forum string, tags []string) error {
+	tx, err := p.begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM thread_tag WHERE thread=$1`, thread); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err := tx.Exec(
+			`INSERT INTO thread_tag (thread, forum, tag) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			thread,
+			forum,
+			tag,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *postgresAppRepository) SelectThreadTags(threads []int) (map[int][]string, error) {
+	result := make(map[int][]string)
+	if len(threads) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, 0, len(threads))
+	placeholders := make([]string, 0, len(threads))
+	for _, id := range threads {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := p.db().Query(
+		`SELECT thread, tag FROM thread_tag WHERE thread IN (`+strings.Join(placeholders, ", ")+`) ORDER BY tag`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var thread int
+		var tag string
+		if err := rows.Scan(&thread, &tag); err != nil {
+			return nil, err
+		}
+
+		result[thread] = append(result[thread], tag)
+	}
+
+	return result, rows.Err()
+}
+
+// SelectForumTags lists the tags of the forum by the number of visible
+// threads using them.
+func (p *postgresAppRepository) SelectForumTags(forum string, parameters models.QueryParameters) ([]models.TagUsage, error) {
+	rows, err := p.db().Query(
+		`SELECT tt.tag, COUNT(*) FROM thread_tag tt JOIN thread t ON t.id = tt.thread
+		WHERE tt.forum=$1 AND NOT t.shadow
+		GROUP BY tt.tag ORDER BY COUNT(*) DESC, tt.tag LIMIT NULLIF($2, 0)`,
+		forum,
+		parameters.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tags []models.TagUsage
+	for rows.Next() {
+		var tag models.TagUsage
+		if err := rows.Scan(&tag.Tag, &tag.Threads); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (p *postgresAppRepository) SelectThreadsByTag(parameters models.QueryParameters) ([]models.Thread, error) {
+	return p.selectThreadsSorted("", threadSortKeys[parameters.Sort], parameters)
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	repo "github.com/yarikTri/dbms-term-proj/internal/app"
+
+	"github.com/jackc/pgx"
+)
+
+// querier is what the pool and a transaction have in common, so the queries
+// run the same way in and out of a unit of work.
+type querier interface {
+	QueryRow(sql string, args ...interface{}) *pgx.Row
+	Query(sql string, args ...interface{}) (*pgx.Rows, error)
+	Exec(sql string, arguments ...interface{}) (pgx.CommandTag, error)
+}
+
+// transaction is the transaction a method runs its statements in.
+type transaction interface {
+	querier
+	Commit() error
+	Rollback() error
+}
+
+// joinedTx is the unit of work as seen by the methods running in it. They
+// can't end it, that is left to InTransaction.
+type joinedTx struct {
+	*pgx.Tx
+}
+
+func (joinedTx) Commit() error {
+	return nil
+}
+
+func (joinedTx) Rollback() error {
+	return nil
+}
+
+// db returns the unit of work the repository runs in or else the pool.
+func (p *postgresAppRepository) db() querier {
+	if p.tx != nil {
+		return p.tx
+	}
+
+	return p.Conn
+}
+
+// begin starts the transaction of a method. In a unit of work the method
+// joins it instead, so its statements commit or roll back together with the
+// rest of the unit.
+func (p *postgresAppRepository) begin() (transaction, error) {
+	if p.tx != nil {
+		return joinedTx{p.tx}, nil
+	}
+
+	tx, err := p.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// savepoint runs fn so that its failure leaves the unit of work usable: a
+// failed statement aborts the whole transaction otherwise, and the caller
+// couldn't retry it. Out of a unit of work each statement stands alone.
+func (p *postgresAppRepository) savepoint(fn func() error) error {
+	if p.tx == nil {
+		return fn()
+	}
+
+	if _, err := p.tx.Exec(`SAVEPOINT attempt`); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := p.tx.Exec(`ROLLBACK TO SAVEPOINT attempt`); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+
+	_, err := p.tx.Exec(`RELEASE SAVEPOINT attempt`)
+	return err
+}
+
+// InTransaction runs fn with a repository whose methods all work in one
+// transaction. It is committed when fn succeeds and rolled back otherwise.
+// Nested calls join the outer unit of work.
+func (p *postgresAppRepository) InTransaction(fn func(repo.Repository) error) error {
+	if p.tx != nil {
+		return fn(p)
+	}
+
+	tx, err := p.Conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := fn(&postgresAppRepository{Conn: p.Conn, tx: tx}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// treePostColumns are the postColumns with the reply count taken from the
+// replies the viewer can see, the stored counter counts the replies of
+// shadow-banned authors as well. The placeholder is the viewer nickname.
+func treePostColumns(viewer int) string {
+	children := `(SELECT COUNT(*) FROM post reply WHERE reply.parent = post.id AND ` +
+		fmt.Sprintf(shadowFilter, viewer) + `)`
+
+	return strings.Replace(postColumns, "children", children, 1)
+}
+
+// SelectPostChildren selects the descendants of the post. A post is a
+// descendant when the post id stands in its path at the position of the post
+// depth, which keeps the lookup on the thread index.
+func (p *postgresAppRepository) SelectPostChildren(post models.Post, parameters models.PostTreeParameters) ([]models.Post, error) {
+	level := len(post.Path.Elements)
+
+	query := fmt.Sprintf(
+		`SELECT `+treePostColumns(3)+` FROM post WHERE thread=$1 AND path[%d]=$2 AND id <> $2`,
+		level,
+	)
+	args := []interface{}{post.Thread, post.Id, parameters.Viewer}
+	query += ` AND ` + fmt.Sprintf(shadowFilter, 3)
+
+	if parameters.Depth > 0 {
+		args = append(args, level+parameters.Depth)
+		query += fmt.Sprintf(` AND array_length(path, 1) <= $%d`, len(args))
+	}
+
+	order, direction := ">", "ASC"
+	if parameters.Desc {
+		order, direction = "<", "DESC"
+	}
+
+	if parameters.Since != 0 {
+		args = append(args, parameters.Since)
+		if parameters.Sort == "flat" {
+			query += fmt.Sprintf(` AND id %s $%d`, order, len(args))
+		} else {
+			query += fmt.Sprintf(` AND path %s (SELECT path FROM post WHERE id = $%d)`, order, len(args))
+		}
+	}
+
+	if parameters.Sort == "flat" {
+		query += fmt.Sprintf(` ORDER BY id %s`, direction)
+	} else {
+		query += fmt.Sprintf(` ORDER BY path %s, id %s`, direction, direction)
+	}
+
+	args = append(args, parameters.Limit)
+	query += fmt.Sprintf(` LIMIT NULLIF($%d, 0)`, len(args))
+
+	rows, err := p.db().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPosts(rows)
+}
+
+// SelectPostAncestors selects the chain from the root of the post branch down
+// to the post parent, leaving out what the viewer can't see.
+func (p *postgresAppRepository) SelectPostAncestors(post models.Post, viewer string) ([]models.Post, error) {
+	if len(post.Path.Elements) < 2 {
+		return []models.Post{}, nil
+	}
+
+	ancestors := post.Path.Elements[:len(post.Path.Elements)-1]
+
+	args := make([]interface{}, 0, len(ancestors)+1)
+	placeholders := make([]string, 0, len(ancestors))
+	for _, id := range ancestors {
+		args = append(args, id.Int)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	args = append(args, viewer)
+
+	rows, err := p.db().Query(
+		`SELECT `+treePostColumns(len(args))+` FROM post WHERE id IN (`+strings.Join(placeholders, ", ")+`)
+		AND `+fmt.Sprintf(shadowFilter, len(args))+`
+		ORDER BY array_length(path, 1)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPosts(rows)
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// UpsertReadMarker stores the last seen post of the thread for the user. A zero
+// post marks the whole thread as read. The number of posts up to the marker is
+// kept alongside it, so unread counts are a subtraction from thread.posts.
+func (p *postgresAppRepository) UpsertReadMarker(marker models.ReadMarker) (models.ReadMarker, error) {
+	var result models.ReadMarker
+	err := p.db().QueryRow(
+		`INSERT INTO thread_read (nickname, thread_id, post_id, seen)
+		SELECT $1, $2, marker.post_id, (SELECT COUNT(*) FROM post WHERE thread = $2 AND id <= marker.post_id AND NOT shadow)
+		FROM (SELECT CASE WHEN $3 = 0
+					 THEN COALESCE((SELECT MAX(id) FROM post WHERE thread = $2), 0)
+					 ELSE $3 END AS post_id) AS marker
+		ON CONFLICT (nickname, thread_id) DO UPDATE
+		SET post_id = EXCLUDED.post_id, seen = EXCLUDED.seen, updated = NOW()
+		RETURNING nickname, thread_id, post_id,
+				  GREATEST((SELECT posts FROM thread WHERE id = $2) - seen, 0)`,
+		marker.Nickname,
+		marker.Thread,
+		marker.Post,
+	).Scan(&result.Nickname, &result.Thread, &result.Post, &result.Unread)
+
+	return result, err
+}
+
+func (p *postgresAppRepository) SelectUnreadCounts(nickname string, threads []int) (map[int]int, error) {
+	counts := make(map[int]int, len(threads))
+	if len(threads) == 0 {
+		return counts, nil
+	}
+
+	args := []interface{}{nickname}
+	placeholders := make([]string, 0, len(threads))
+	for _, id := range threads {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := p.db().Query(
+		`SELECT t.id, GREATEST(t.posts - COALESCE(r.seen, 0), 0)
+		FROM thread t LEFT JOIN thread_read r ON r.thread_id = t.id AND r.nickname = $1
+		WHERE t.id IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, unread int
+		if err := rows.Scan(&id, &unread); err != nil {
+			return nil, err
+		}
+
+		counts[id] = unread
+	}
+
+	return counts, rows.Err()
+}
+
+// unreadFilter keeps the threads read by the user with posts after the
+// marker, leaving out the threads the user can't see or has hidden by muting
+// or blocking their authors. The placeholder is the user nickname.
+func unreadFilter(user int) string {
+	return fmt.Sprintf(`thread_read.nickname = $%[1]d AND posts > thread_read.seen
+		AND thread.author NOT IN (SELECT muted FROM user_mute WHERE muter = $%[1]d
+								  UNION SELECT blocked FROM user_block WHERE blocker = $%[1]d)`, user) +
+		` AND ` + fmt.Sprintf(forumAccessFilter, user)
+}
+
+// SelectUnreadThreads pages the unread threads of the user by latest post,
+// since is the id of the last thread of the previous page.
+func (p *postgresAppRepository) SelectUnreadThreads(nickname string, parameters models.QueryParameters) ([]models.UnreadThread, error) {
+	args := []interface{}{nickname, parameters.Limit}
+	query := `SELECT ` + threadColumns + `, thread_read.post_id, posts - thread_read.seen
+		FROM thread_read JOIN thread ON thread.id = thread_read.thread_id
+		WHERE ` + unreadFilter(1)
+
+	if parameters.Since != "" {
+		since, err := strconv.Atoi(parameters.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, since)
+		query += ` AND (last_post_at, id) < (SELECT last_post_at, id FROM thread WHERE id = $3)`
+	}
+
+	rows, err := p.db().Query(query+` ORDER BY last_post_at DESC, id DESC LIMIT NULLIF($2, 0)`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var threads []models.UnreadThread
+	for rows.Next() {
+		var unread models.UnreadThread
+		unread.Thread, err = scanThread(rows, &unread.LastReadPost, &unread.Unread)
+		if err != nil {
+			return nil, err
+		}
+
+		threads = append(threads, unread)
+	}
+
+	return threads, rows.Err()
+}
+
+// SelectUnreadTotal sums the unread posts over every thread the listing of
+// the user would show, whatever the page.
+func (p *postgresAppRepository) SelectUnreadTotal(nickname string) (int, error) {
+	var total int
+	err := p.db().QueryRow(
+		`SELECT COALESCE(SUM(posts - thread_read.seen), 0)
+		FROM thread_read JOIN thread ON thread.id = thread_read.thread_id
+		WHERE `+unreadFilter(1),
+		nickname,
+	).Scan(&total)
+
+	return total, err
+}
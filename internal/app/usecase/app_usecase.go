@@ -1,22 +1,37 @@
 package usecase
 
 import (
+	"strings"
+	"time"
+
 	"github.com/yarikTri/dbms-term-proj/internal/app"
 	"github.com/yarikTri/dbms-term-proj/internal/models"
+	"github.com/yarikTri/dbms-term-proj/internal/slug"
+	"github.com/yarikTri/dbms-term-proj/internal/storage"
 
-	"github.com/google/uuid"
+	"github.com/jackc/pgx"
 )
 
 type appUseCase struct {
 	appRepository app.Repository
+	storage       storage.Storage
 }
 
-func NewAppUseCase(ar app.Repository) app.UseCase {
+func NewAppUseCase(ar app.Repository, st storage.Storage) app.UseCase {
 	return &appUseCase{
 		appRepository: ar,
+		storage:       st,
 	}
 }
 
+// inTransaction runs fn with a use case whose repository calls all take part
+// in one unit of work.
+func (a appUseCase) inTransaction(fn func(appUseCase) error) error {
+	return a.appRepository.InTransaction(func(repository app.Repository) error {
+		return fn(appUseCase{appRepository: repository, storage: a.storage})
+	})
+}
+
 func (a appUseCase) CreateUser(user models.User) (models.User, error) {
 	err := a.appRepository.InsertUser(user)
 
@@ -45,12 +60,51 @@ func (a appUseCase) HasUser(user models.User) ([]models.User, error) {
 }
 
 func (a appUseCase) EditUser(newUser models.User) (models.User, error) {
+	if _, err := a.checkBans("", []string{newUser.Nickname}); err != nil {
+		return models.User{}, err
+	}
+
 	u, err := a.appRepository.UpdateUser(newUser)
+	if err == pgx.ErrNoRows && newUser.Version != 0 {
+		if _, err := a.appRepository.SelectUserByNickname(newUser.Nickname); err == nil {
+			return models.User{}, models.ErrVersionMismatch
+		}
+	}
 
 	return u, err
 }
 
+func (a appUseCase) CheckThreadsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Thread, error) {
+	threads, err := a.appRepository.SelectThreadsByAuthor(nickname, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.fillTags(threads)
+
+	return threads, err
+}
+
+func (a appUseCase) CheckPostsByAuthor(nickname string, parameters models.QueryParameters) ([]models.Post, error) {
+	posts, err := a.appRepository.SelectPostsByAuthor(nickname, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.fillAttachments(posts)
+
+	return posts, err
+}
+
 func (a appUseCase) CreateForum(forum models.Forum) (models.Forum, error) {
+	if _, err := a.checkBans("", []string{forum.User}); err != nil {
+		return models.Forum{}, err
+	}
+
+	if forum.Visibility != "" && !models.IsForumVisibility(forum.Visibility) {
+		return models.Forum{}, models.ErrBadVisibility
+	}
+
 	f, err := a.appRepository.InsertForum(forum)
 	if err != nil {
 	}
@@ -67,62 +121,353 @@ func (a appUseCase) CheckForumBySlug(slug string) (models.Forum, error) {
 }
 
 func (a appUseCase) CreateForumThread(thread models.Thread) (models.Thread, error) {
+	shadowed, err := a.checkBans(thread.Forum, []string{thread.Author})
+	if err != nil {
+		return models.Thread{}, err
+	}
+	thread.Shadow = shadowed[strings.ToLower(thread.Author)]
+
+	if err := a.checkPostingAccess(thread.Forum, []string{thread.Author}); err != nil {
+		return models.Thread{}, err
+	}
+
+	if err := a.checkBlockers(thread.Author, mentions(thread.Message)); err != nil {
+		return models.Thread{}, err
+	}
+
+	messages, err := a.filterMessages(thread.Forum, []string{thread.Author}, []string{thread.Message})
+	if err != nil {
+		return models.Thread{}, err
+	}
+	thread.Message = messages[0]
+
+	if thread.Title, err = a.filterTitle(thread.Forum, thread.Author, thread.Title); err != nil {
+		return models.Thread{}, err
+	}
+
+	// The slug is made from the title as stored.
 	if thread.Slug == "" {
-		u, err := uuid.NewRandom()
-		if err != nil {
-			panic("AAAAAAAAAAAAAAAAA")
+		thread.Slug = slug.Make(thread.Title)
+		thread.SlugGenerated = true
+	}
+
+	tags, err := normalizeTags(thread.Tags)
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	var poll models.Poll
+	if thread.Poll != nil {
+		if poll, err = validatePoll(*thread.Poll); err != nil {
+			return models.Thread{}, err
 		}
-		thread.Slug = u.String()
 	}
-	thr, err := a.appRepository.InsertThread(thread)
 
-	return thr, err
+	thr, err := a.insertThread(thread)
+	if err != nil {
+		return thr, err
+	}
+
+	if len(tags) > 0 {
+		if err := a.appRepository.ReplaceThreadTags(thr.Id, thr.Forum, tags); err != nil {
+			return models.Thread{}, err
+		}
+		thr.Tags = tags
+	}
+
+	if thread.Poll != nil {
+		poll.Thread = thr.Id
+		poll.CreatedBy = thr.Author
+
+		if poll, err = a.appRepository.InsertPoll(poll); err != nil {
+			return models.Thread{}, err
+		}
+		thr.Poll = &poll
+	}
+
+	return thr, nil
+}
+
+// slugAttempts bounds the retries when concurrent threads race for the same
+// generated slug.
+const slugAttempts = 3
+
+// insertThread inserts the thread, suffixing a generated slug with the next
+// free number when the slug is already taken.
+func (a appUseCase) insertThread(thread models.Thread) (models.Thread, error) {
+	if !thread.SlugGenerated {
+		return a.appRepository.InsertThread(thread)
+	}
+
+	base := thread.Slug
+	for attempt := 1; ; attempt++ {
+		suffix, err := a.appRepository.SelectSlugSuffix(base)
+		if err != nil {
+			return models.Thread{}, err
+		}
+
+		thread.Slug = slug.WithSuffix(base, suffix+1)
+
+		thr, err := a.appRepository.InsertThread(thread)
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Code == "23505" && attempt < slugAttempts {
+			continue
+		}
+
+		return thr, err
+	}
 }
 
 func (a appUseCase) CheckThreadBySlug(slug string) (models.Thread, error) {
 	thread, err := a.appRepository.SelectThreadBySlug(slug)
+	if err != nil {
+		return thread, err
+	}
 
-	return thread, err
+	return a.fillThreadTags(thread)
 }
 
 func (a appUseCase) CheckThreadById(id int) (models.Thread, error) {
 	thread, err := a.appRepository.SelectThreadById(id)
+	if err != nil {
+		return thread, err
+	}
 
-	return thread, err
+	return a.fillThreadTags(thread)
 }
 
 func (a appUseCase) CreatePosts(posts []models.Post, id int) ([]models.Post, error) {
+	thread, err := a.appRepository.SelectThreadById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if thread.Locked {
+		return nil, models.ErrThreadLocked
+	}
+
+	authors := make([]string, 0, len(posts))
+	messages := make([]string, 0, len(posts))
+	for _, post := range posts {
+		authors = append(authors, post.Author)
+		messages = append(messages, post.Message)
+	}
+
+	shadowed, err := a.checkBans(thread.Forum, authors)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkPostingAccess(thread.Forum, authors); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkReplyBlocks(posts); err != nil {
+		return nil, err
+	}
+
+	messages, err = a.filterMessages(thread.Forum, authors, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		posts[i].Shadow = shadowed[strings.ToLower(posts[i].Author)]
+		posts[i].Message = messages[i]
+	}
+
 	result, err := a.appRepository.InsertPosts(posts, id)
 
 	return result, err
 }
 
-func (a appUseCase) EditThread(thread models.Thread) (models.Thread, error) {
-	newThread, err := a.appRepository.UpdateThread(thread)
+// CreateThreadWithPosts creates the thread and its first posts in one unit of
+// work, so a rejected post leaves no empty thread behind.
+func (a appUseCase) CreateThreadWithPosts(thread models.Thread, posts []models.Post) (models.Thread, []models.Post, error) {
+	var result []models.Post
+	err := a.inTransaction(func(tx appUseCase) error {
+		created, err := tx.CreateForumThread(thread)
+		if err != nil {
+			return err
+		}
+
+		if len(posts) == 0 {
+			thread = created
+			return nil
+		}
+
+		if result, err = tx.CreatePosts(posts, created.Id); err != nil {
+			return err
+		}
+
+		// Reload the counters the posts bumped.
+		if thread, err = tx.appRepository.SelectThreadById(created.Id); err != nil {
+			return err
+		}
+		thread.Tags, thread.Poll = created.Tags, created.Poll
+
+		return nil
+	})
+	if err != nil {
+		return models.Thread{}, nil, err
+	}
+
+	return thread, result, nil
+}
+
+// EditThread changes the thread on behalf of the caller, who must not be
+// banned in its forum.
+func (a appUseCase) EditThread(thread models.Thread, caller string) (models.Thread, error) {
+	var current models.Thread
+	var err error
+	if thread.Slug == "" {
+		current, err = a.appRepository.SelectThreadById(thread.Id)
+	} else {
+		current, err = a.appRepository.SelectThreadBySlug(thread.Slug)
+	}
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	if _, err := a.checkBans(current.Forum, []string{caller}); err != nil {
+		return models.Thread{}, err
+	}
+
+	if thread.Message != "" {
+		if thread.Message, err = a.filterEdit(current.Forum, current.Author, thread.Message); err != nil {
+			return models.Thread{}, err
+		}
+	}
+
+	if thread.Title != "" {
+		if thread.Title, err = a.filterTitle(current.Forum, current.Author, thread.Title); err != nil {
+			return models.Thread{}, err
+		}
+	}
+
+	var tags []string
+	if thread.Tags != nil {
+		if tags, err = normalizeTags(thread.Tags); err != nil {
+			return models.Thread{}, err
+		}
+	}
+
+	// The tags are replaced in the unit of work of the update, so a failed
+	// replace doesn't leave the thread changed and its version bumped.
+	var newThread models.Thread
+	err = a.inTransaction(func(tx appUseCase) error {
+		newThread, err = tx.appRepository.UpdateThread(thread)
+		if err == pgx.ErrNoRows && thread.Version != 0 {
+			return models.ErrVersionMismatch
+		}
+		if err != nil {
+			return err
+		}
+
+		if thread.Tags != nil {
+			return tx.appRepository.ReplaceThreadTags(newThread.Id, newThread.Forum, tags)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.Thread{}, err
+	}
 
-	return newThread, err
+	return a.fillThreadTags(newThread)
 }
 
 func (a appUseCase) AddVote(vote models.Vote) (models.Vote, error) {
+	shadowed, err := a.checkVoteBans(vote)
+	if err != nil || shadowed {
+		return vote, err
+	}
+
 	newVote, err := a.appRepository.InsertVote(vote)
 
 	return newVote, err
 }
 
 func (a appUseCase) UpdateVote(vote models.Vote) (models.Vote, error) {
+	shadowed, err := a.checkVoteBans(vote)
+	if err != nil || shadowed {
+		return vote, err
+	}
+
 	newVote, err := a.appRepository.UpdateVote(vote)
 
 	return newVote, err
 }
 
+// checkVoteBans reports whether the vote of a shadow-banned user must be
+// silently dropped. Voting in private forums takes membership and archived
+// forums take no votes.
+func (a appUseCase) checkVoteBans(vote models.Vote) (bool, error) {
+	thread, err := a.appRepository.SelectThreadById(vote.IdThread)
+	if err != nil {
+		return false, err
+	}
+
+	if err := a.CheckForumAccess(thread.Forum, vote.Nickname); err != nil {
+		return false, err
+	}
+
+	if err := a.checkForumWritable(thread.Forum); err != nil {
+		return false, err
+	}
+
+	shadowed, err := a.checkBans(thread.Forum, []string{vote.Nickname})
+	if err != nil {
+		return false, err
+	}
+
+	return shadowed[strings.ToLower(vote.Nickname)], nil
+}
+
 func (a appUseCase) GetServiceStatus() (map[string]int, error) {
 	return a.appRepository.GetServiceStatus()
 }
 
-func (a appUseCase) ClearDatabase() error {
+// ClearDatabase wipes every table and attachment on behalf of an
+// administrator.
+func (a appUseCase) ClearDatabase(caller string) error {
+	if err := requireAdmin(caller); err != nil {
+		return err
+	}
+
+	attachments, err := a.appRepository.SelectAllAttachments()
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		if err := a.removeAttachmentFiles(attachment); err != nil {
+			return err
+		}
+	}
+
 	return a.appRepository.ClearDatabase()
 }
 
+// ReconcileThreadCounters repairs the threads with posts created since the
+// given time, all of them when it is zero.
+func (a appUseCase) ReconcileThreadCounters(since time.Time) (int, error) {
+	return a.appRepository.ReconcileThreadCounters(since)
+}
+
+// ReconcileThreadCountersAs runs the reconciliation of every thread on behalf
+// of an administrator.
+func (a appUseCase) ReconcileThreadCountersAs(caller string) (int, error) {
+	if err := requireAdmin(caller); err != nil {
+		return 0, err
+	}
+
+	return a.appRepository.ReconcileThreadCounters(time.Time{})
+}
+
+func (a appUseCase) RefreshThreadHot(window time.Duration) (int, error) {
+	return a.appRepository.RefreshThreadHot(window)
+}
+
 func (a appUseCase) CheckUsersByForum(slugForum string, parameters models.QueryParameters) ([]models.User, error) {
 	users, err := a.appRepository.SelectUsersByForum(slugForum, parameters)
 
@@ -130,7 +475,35 @@ func (a appUseCase) CheckUsersByForum(slugForum string, parameters models.QueryP
 }
 
 func (a appUseCase) CheckThreadsByForum(slugForum string, parameters models.QueryParameters) ([]models.Thread, error) {
+	if parameters.Tag != "" {
+		tag, err := normalizeTag(parameters.Tag)
+		if err != nil {
+			return nil, err
+		}
+		parameters.Tag = tag
+	}
+
 	threads, err := a.appRepository.SelectThreadsByForum(slugForum, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.fillTags(threads); err != nil {
+		return nil, err
+	}
+
+	err = a.fillUnread(parameters.Viewer, threads)
+
+	return threads, err
+}
+
+func (a appUseCase) CheckTrendingThreads(parameters models.QueryParameters) ([]models.Thread, error) {
+	threads, err := a.appRepository.SelectTrendingThreads(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.fillTags(threads)
 
 	return threads, err
 }
@@ -141,6 +514,12 @@ func (a appUseCase) CheckPostById(id int, related []string) (map[string]interfac
 		return nil, err
 	}
 
+	posts := []models.Post{post}
+	if err := a.fillAttachments(posts); err != nil {
+		return nil, err
+	}
+	post = posts[0]
+
 	data := map[string]interface{}{
 		"post": post,
 	}
@@ -169,7 +548,7 @@ func (a appUseCase) CheckPostById(id int, related []string) (map[string]interfac
 				return nil, err
 			}
 
-			if models.IsUUID(thread.Slug) {
+			if thread.SlugGenerated {
 				result := models.ThreadToWithout(thread)
 
 				data["thread"] = result
@@ -184,14 +563,45 @@ func (a appUseCase) CheckPostById(id int, related []string) (map[string]interfac
 	return data, nil
 }
 
-func (a appUseCase) EditPost(id int, message string) (models.Post, error) {
-	post, err := a.appRepository.UpdatePost(id, message)
+// EditPost changes the message on behalf of the caller, who must not be
+// banned in the forum of the post.
+func (a appUseCase) EditPost(id int, message string, version int, caller string) (models.Post, error) {
+	current, err := a.appRepository.SelectPostById(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if _, err := a.checkBans(current.Forum, []string{caller}); err != nil {
+		return models.Post{}, err
+	}
 
-	return post, err
+	if message != "" {
+		if message, err = a.filterEdit(current.Forum, current.Author, message); err != nil {
+			return models.Post{}, err
+		}
+	}
+
+	post, err := a.appRepository.UpdatePost(id, message, version)
+	if err == pgx.ErrNoRows && version != 0 {
+		return models.Post{}, models.ErrVersionMismatch
+	}
+	if err != nil {
+		return post, err
+	}
+
+	posts := []models.Post{post}
+	err = a.fillAttachments(posts)
+
+	return posts[0], err
 }
 
-func (a appUseCase) CheckPostsByThread(thread models.Thread, limit, since int, sort string, desc bool) ([]models.Post, error) {
-	posts, err := a.appRepository.SelectPostsByThread(thread, limit, since, sort, desc)
+func (a appUseCase) CheckPostsByThread(thread models.Thread, limit, since int, sort string, desc bool, viewer string) ([]models.Post, error) {
+	posts, err := a.appRepository.SelectPostsByThread(thread, limit, since, sort, desc, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.fillAttachments(posts)
 
 	return posts, err
 }
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+	"github.com/yarikTri/dbms-term-proj/internal/thumbnail"
+
+	"github.com/google/uuid"
+)
+
+// AddAttachments attaches the files to the post on behalf of its author or a
+// moderator of the forum. Every file is checked before any is stored, and
+// either all of them are attached or none.
+func (a appUseCase) AddAttachments(post int, uploads []models.Upload, caller string) ([]models.Attachment, error) {
+	contentTypes := make([]string, len(uploads))
+	for i, upload := range uploads {
+		contentType, err := attachmentType(upload.Data)
+		if err != nil {
+			return nil, err
+		}
+		contentTypes[i] = contentType
+	}
+
+	target, err := a.appRepository.SelectPostById(post)
+	if err != nil {
+		return nil, err
+	}
+
+	if caller == "" || !strings.EqualFold(target.Author, caller) {
+		if err := a.requireModerator(target.Forum, caller); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := a.checkBans(target.Forum, []string{caller}); err != nil {
+		return nil, err
+	}
+
+	var stored, result []models.Attachment
+	err = a.inTransaction(func(tx appUseCase) error {
+		for i, upload := range uploads {
+			attachment, err := tx.storeAttachment(post, upload, contentTypes[i])
+			if err != nil {
+				return err
+			}
+			stored = append(stored, attachment)
+
+			attachment, err = tx.appRepository.InsertAttachment(attachment)
+			if err != nil {
+				return err
+			}
+			result = append(result, attachment)
+		}
+
+		return nil
+	})
+	if err != nil {
+		for _, attachment := range stored {
+			a.removeAttachmentFiles(attachment)
+		}
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// attachmentType returns the type of the file sniffed from its content, the
+// client supplied one is ignored, and fails for files which can't be
+// attached.
+func attachmentType(data []byte) (string, error) {
+	if int64(len(data)) > configs.StorageConfig.MaxSize {
+		return "", models.ErrAttachmentTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+
+	for _, t := range configs.StorageConfig.AllowedTypes {
+		if t == mediaType {
+			return contentType, nil
+		}
+	}
+
+	return "", models.ErrAttachmentType
+}
+
+// storeAttachment saves the file and, for images, its thumbnail. An image
+// without a thumbnail is still stored.
+func (a appUseCase) storeAttachment(post int, upload models.Upload, contentType string) (models.Attachment, error) {
+	key := uuid.NewString()
+	attachment := models.Attachment{
+		Post:        post,
+		Name:        upload.Name,
+		ContentType: contentType,
+		Size:        int64(len(upload.Data)),
+		StorageKey:  "attachments/" + key,
+	}
+
+	if err := a.storage.Save(attachment.StorageKey, bytes.NewReader(upload.Data)); err != nil {
+		return models.Attachment{}, err
+	}
+
+	if strings.HasPrefix(contentType, "image/") {
+		thumb, err := thumbnail.Make(upload.Data, configs.StorageConfig.ThumbnailSize, configs.StorageConfig.ThumbnailMaxPixels)
+		if err == nil {
+			attachment.ThumbnailKey = "thumbnails/" + key + ".png"
+			if err := a.storage.Save(attachment.ThumbnailKey, bytes.NewReader(thumb)); err != nil {
+				attachment.ThumbnailKey = ""
+			}
+		}
+	}
+
+	return attachment, nil
+}
+
+func (a appUseCase) CheckAttachmentById(id int) (models.Attachment, error) {
+	return a.appRepository.SelectAttachmentById(id)
+}
+
+func (a appUseCase) OpenAttachment(key string) (io.ReadCloser, error) {
+	return a.storage.Open(key)
+}
+
+// CleanupAttachments removes the files and rows of attachments left without a
+// post and returns how many were removed.
+func (a appUseCase) CleanupAttachments() (int, error) {
+	attachments, err := a.appRepository.SelectOrphanedAttachments()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, attachment := range attachments {
+		if err := a.removeAttachmentFiles(attachment); err != nil {
+			return removed, err
+		}
+
+		if err := a.appRepository.DeleteAttachment(attachment.Id); err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (a appUseCase) removeAttachmentFiles(attachment models.Attachment) error {
+	if attachment.ThumbnailKey != "" {
+		if err := a.storage.Delete(attachment.ThumbnailKey); err != nil {
+			return err
+		}
+	}
+
+	return a.storage.Delete(attachment.StorageKey)
+}
+
+// fillAttachments sets the attachments of posts with one query for the page.
+func (a appUseCase) fillAttachments(posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.Id)
+	}
+
+	attachments, err := a.appRepository.SelectAttachmentsByPosts(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Attachments = attachments[posts[i].Id]
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package usecase
+
+import "github.com/yarikTri/dbms-term-proj/internal/models"
+
+func (a appUseCase) RecordAudit(entry models.AuditEntry) error {
+	return a.appRepository.InsertAuditEntry(entry)
+}
+
+func (a appUseCase) CheckAuditLog(filter models.AuditFilter, caller string) ([]models.AuditEntry, error) {
+	if err := requireAdmin(caller); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectAuditEntries(filter)
+}
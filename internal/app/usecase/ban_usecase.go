@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// CreateBan bans a user in a forum on behalf of its moderator, or globally on
+// behalf of an administrator when the forum is empty.
+func (a appUseCase) CreateBan(ban models.Ban) (models.Ban, error) {
+	if err := a.requireBanManager(ban.Forum, ban.CreatedBy); err != nil {
+		return models.Ban{}, err
+	}
+
+	return a.appRepository.InsertBan(ban)
+}
+
+func (a appUseCase) CheckBans(forum, caller string, parameters models.QueryParameters) ([]models.Ban, error) {
+	if err := a.requireBanManager(forum, caller); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectBans(forum, parameters)
+}
+
+// LiftBan deletes the ban and returns it.
+func (a appUseCase) LiftBan(id int, caller string) (models.Ban, error) {
+	ban, err := a.appRepository.SelectBanById(id)
+	if err != nil {
+		return models.Ban{}, err
+	}
+
+	if err := a.requireBanManager(ban.Forum, caller); err != nil {
+		return models.Ban{}, err
+	}
+
+	return ban, a.appRepository.DeleteBan(id)
+}
+
+func (a appUseCase) requireBanManager(forum, nickname string) error {
+	if forum == "" {
+		return requireAdmin(nickname)
+	}
+
+	return a.requireModerator(forum, nickname)
+}
+
+func requireAdmin(nickname string) error {
+	for _, admin := range configs.AdminConfig.Nicknames {
+		if nickname != "" && strings.EqualFold(admin, nickname) {
+			return nil
+		}
+	}
+
+	return models.ErrForbidden
+}
+
+// checkBans fails with a BanError when any of the authors is banned in the
+// forum or globally. Otherwise it returns the lowercased nicknames of the
+// shadow-banned authors, whose new content is visible to themselves only.
+func (a appUseCase) checkBans(forum string, authors []string) (map[string]bool, error) {
+	bans, err := a.appRepository.SelectActiveBans(forum, authors)
+	if err != nil {
+		return nil, err
+	}
+
+	shadowed := make(map[string]bool)
+	for _, ban := range bans {
+		if !ban.Shadow {
+			return nil, &models.BanError{Ban: ban}
+		}
+
+		shadowed[strings.ToLower(ban.Nickname)] = true
+	}
+
+	return shadowed, nil
+}
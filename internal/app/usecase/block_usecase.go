@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// mentionPattern matches @nickname not preceded by a word character, so that
+// e-mail addresses are not taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.]+)`)
+
+func (a appUseCase) BlockUser(blocker, blocked, caller string) (models.UserBlock, error) {
+	if !strings.EqualFold(blocker, caller) || strings.EqualFold(blocker, blocked) {
+		return models.UserBlock{}, models.ErrForbidden
+	}
+
+	return a.appRepository.InsertUserBlock(blocker, blocked)
+}
+
+func (a appUseCase) UnblockUser(blocker, blocked, caller string) error {
+	if !strings.EqualFold(blocker, caller) {
+		return models.ErrForbidden
+	}
+
+	return a.appRepository.DeleteUserBlock(blocker, blocked)
+}
+
+func (a appUseCase) CheckUserBlocks(blocker, caller string) ([]models.UserBlock, error) {
+	if !strings.EqualFold(blocker, caller) {
+		return nil, models.ErrForbidden
+	}
+
+	return a.appRepository.SelectUserBlocks(blocker)
+}
+
+// checkBlockers fails with ErrUserBlocked when any of the users has blocked
+// the nickname.
+func (a appUseCase) checkBlockers(nickname string, users []string) error {
+	blockers, err := a.appRepository.SelectBlockers(nickname, users)
+	if err != nil {
+		return err
+	}
+
+	if len(blockers) > 0 {
+		return models.ErrUserBlocked
+	}
+
+	return nil
+}
+
+func (a appUseCase) MuteUser(muter, muted, caller string) (models.UserMute, error) {
+	if !strings.EqualFold(muter, caller) || strings.EqualFold(muter, muted) {
+		return models.UserMute{}, models.ErrForbidden
+	}
+
+	return a.appRepository.InsertUserMute(muter, muted)
+}
+
+func (a appUseCase) UnmuteUser(muter, muted, caller string) error {
+	if !strings.EqualFold(muter, caller) {
+		return models.ErrForbidden
+	}
+
+	return a.appRepository.DeleteUserMute(muter, muted)
+}
+
+func (a appUseCase) CheckUserMutes(muter, caller string) ([]models.UserMute, error) {
+	if !strings.EqualFold(muter, caller) {
+		return nil, models.ErrForbidden
+	}
+
+	return a.appRepository.SelectUserMutes(muter)
+}
+
+// CheckHiddenAuthors returns the lowercased nicknames whose content the viewer
+// does not want to see.
+func (a appUseCase) CheckHiddenAuthors(viewer string) (map[string]bool, error) {
+	if viewer == "" {
+		return nil, nil
+	}
+
+	authors, err := a.appRepository.SelectHiddenAuthors(viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := make(map[string]bool, len(authors))
+	for _, author := range authors {
+		hidden[strings.ToLower(author)] = true
+	}
+
+	return hidden, nil
+}
+
+// checkReplyBlocks fails with ErrUserBlocked when a post replies to or
+// mentions a user who has blocked its author.
+func (a appUseCase) checkReplyBlocks(posts []models.Post) error {
+	parents := make([]int, 0, len(posts))
+	for _, post := range posts {
+		if post.Parent.Valid {
+			parents = append(parents, int(post.Parent.Int64))
+		}
+	}
+
+	parentAuthors, err := a.appRepository.SelectPostAuthors(parents)
+	if err != nil {
+		return err
+	}
+
+	recipients := make(map[string][]string)
+	for _, post := range posts {
+		author := strings.ToLower(post.Author)
+		if post.Parent.Valid {
+			if parent, ok := parentAuthors[int(post.Parent.Int64)]; ok {
+				recipients[author] = append(recipients[author], parent)
+			}
+		}
+
+		recipients[author] = append(recipients[author], mentions(post.Message)...)
+	}
+
+	for author, users := range recipients {
+		if err := a.checkBlockers(author, users); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mentions returns the nicknames mentioned in the message.
+func mentions(message string) []string {
+	var nicknames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(message, -1) {
+		nickname := strings.TrimRight(match[1], ".")
+		if nickname != "" {
+			nicknames = append(nicknames, nickname)
+		}
+	}
+
+	return nicknames
+}
@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (a appUseCase) CreateCategory(category models.Category, caller string) (models.Category, error) {
+	if err := requireAdmin(caller); err != nil {
+		return models.Category{}, err
+	}
+
+	if strings.TrimSpace(category.Title) == "" {
+		return models.Category{}, models.ErrBadCategory
+	}
+
+	return a.appRepository.InsertCategory(category)
+}
+
+func (a appUseCase) CheckCategory(id int) (models.Category, error) {
+	return a.appRepository.SelectCategoryById(id)
+}
+
+// EditCategory replaces the title, parent and position of the category.
+func (a appUseCase) EditCategory(category models.Category, caller string) (models.Category, error) {
+	if err := requireAdmin(caller); err != nil {
+		return models.Category{}, err
+	}
+
+	if strings.TrimSpace(category.Title) == "" {
+		return models.Category{}, models.ErrBadCategory
+	}
+
+	if category.Parent != 0 {
+		cycle, err := a.appRepository.IsCategoryDescendant(category.Id, category.Parent)
+		if err != nil {
+			return models.Category{}, err
+		}
+
+		if cycle {
+			return models.Category{}, models.ErrBadPlacement
+		}
+	}
+
+	return a.appRepository.UpdateCategory(category)
+}
+
+// PlaceForum moves the forum into a category or under another forum.
+func (a appUseCase) PlaceForum(slug string, placement models.ForumPlacement, caller string) (models.Forum, error) {
+	if err := requireAdmin(caller); err != nil {
+		return models.Forum{}, err
+	}
+
+	if placement.Category != 0 && placement.Parent != "" {
+		return models.Forum{}, models.ErrBadPlacement
+	}
+
+	if placement.Parent != "" {
+		cycle, err := a.appRepository.IsForumDescendant(slug, placement.Parent)
+		if err != nil {
+			return models.Forum{}, err
+		}
+
+		if cycle {
+			return models.Forum{}, models.ErrBadPlacement
+		}
+	}
+
+	return a.appRepository.UpdateForumPlacement(slug, placement)
+}
+
+// CheckCategoryTree returns the top categories with their sub-categories,
+// forums and sub-forums nested inside.
+func (a appUseCase) CheckCategoryTree() ([]models.Category, error) {
+	categories, err := a.appRepository.SelectCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	forums, err := a.appRepository.SelectPlacedForums()
+	if err != nil {
+		return nil, err
+	}
+
+	subForums := make(map[string][]models.Forum)
+	categoryForums := make(map[int][]models.Forum)
+	for _, forum := range forums {
+		if forum.Parent != "" {
+			parent := strings.ToLower(forum.Parent)
+			subForums[parent] = append(subForums[parent], forum)
+		} else {
+			categoryForums[forum.Category] = append(categoryForums[forum.Category], forum)
+		}
+	}
+
+	var nestForums func(forums []models.Forum) []models.ForumNode
+	nestForums = func(forums []models.Forum) []models.ForumNode {
+		var nodes []models.ForumNode
+		for _, forum := range forums {
+			nodes = append(nodes, models.ForumNode{
+				Forum:  forum,
+				Forums: nestForums(subForums[strings.ToLower(forum.Slug)]),
+			})
+		}
+
+		return nodes
+	}
+
+	subCategories := make(map[int][]models.Category)
+	for _, category := range categories {
+		subCategories[category.Parent] = append(subCategories[category.Parent], category)
+	}
+
+	var nestCategories func(parent int) []models.Category
+	nestCategories = func(parent int) []models.Category {
+		var nodes []models.Category
+		for _, category := range subCategories[parent] {
+			category.Categories = nestCategories(category.Id)
+			category.Forums = nestForums(categoryForums[category.Id])
+
+			nodes = append(nodes, category)
+		}
+
+		return nodes
+	}
+
+	return nestCategories(0), nil
+}
@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+// CreateConversation starts a conversation of the creator with the members.
+// A conversation of two users is direct and is reused instead of duplicated.
+func (a appUseCase) CreateConversation(conversation models.Conversation) (models.Conversation, error) {
+	if conversation.CreatedBy == "" {
+		return models.Conversation{}, models.ErrForbidden
+	}
+
+	members := []string{conversation.CreatedBy}
+	seen := map[string]bool{strings.ToLower(conversation.CreatedBy): true}
+	for _, member := range conversation.Members {
+		if member == "" || seen[strings.ToLower(member)] {
+			continue
+		}
+		seen[strings.ToLower(member)] = true
+
+		members = append(members, member)
+	}
+
+	if len(members) < 2 || len(members) > configs.ConversationConfig.MaxMembers {
+		return models.Conversation{}, models.ErrBadConversation
+	}
+
+	if _, err := a.checkBans("", []string{conversation.CreatedBy}); err != nil {
+		return models.Conversation{}, err
+	}
+
+	if err := a.checkBlockers(conversation.CreatedBy, members[1:]); err != nil {
+		return models.Conversation{}, err
+	}
+
+	conversation.Members = members
+	conversation.Direct = len(members) == 2
+	if conversation.Direct {
+		existing, err := a.appRepository.SelectDirectConversation(members[0], members[1])
+		if err == nil {
+			return existing, nil
+		}
+		if err != pgx.ErrNoRows {
+			return models.Conversation{}, err
+		}
+	}
+
+	return a.appRepository.InsertConversation(conversation)
+}
+
+func (a appUseCase) CheckConversations(nickname string, parameters models.QueryParameters) ([]models.Conversation, error) {
+	if nickname == "" {
+		return nil, models.ErrForbidden
+	}
+
+	return a.appRepository.SelectConversations(nickname, parameters)
+}
+
+func (a appUseCase) CheckConversation(id int, viewer string) (models.Conversation, error) {
+	return a.conversationOf(id, viewer)
+}
+
+func (a appUseCase) SendMessage(message models.ConversationMessage) (models.ConversationMessage, error) {
+	conversation, err := a.conversationOf(message.Conversation, message.Author)
+	if err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	if _, err := a.checkBans("", []string{message.Author}); err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	others := make([]string, 0, len(conversation.Members))
+	for _, member := range conversation.Members {
+		if !strings.EqualFold(member, message.Author) {
+			others = append(others, member)
+		}
+	}
+
+	if err := a.checkBlockers(message.Author, others); err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	return a.appRepository.InsertConversationMessage(message)
+}
+
+func (a appUseCase) CheckConversationMessages(id int, viewer string, parameters models.QueryParameters) ([]models.ConversationMessage, error) {
+	if _, err := a.conversationOf(id, viewer); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectConversationMessages(id, parameters)
+}
+
+func (a appUseCase) EditConversationMessage(id int, text, caller string) (models.ConversationMessage, error) {
+	message, err := a.appRepository.SelectConversationMessageById(id)
+	if err != nil {
+		return models.ConversationMessage{}, err
+	}
+
+	if !strings.EqualFold(message.Author, caller) {
+		return models.ConversationMessage{}, models.ErrForbidden
+	}
+
+	if text == "" || text == message.Message {
+		return message, nil
+	}
+
+	return a.appRepository.UpdateConversationMessage(id, text)
+}
+
+func (a appUseCase) MarkConversationRead(id int, viewer string, message int) (int, error) {
+	if message != 0 {
+		m, err := a.appRepository.SelectConversationMessageById(message)
+		if err != nil {
+			return 0, err
+		}
+
+		if m.Conversation != id {
+			return 0, models.ErrMessageNotInConversation
+		}
+	}
+
+	return a.appRepository.MarkConversationRead(id, viewer, message)
+}
+
+// conversationOf returns the conversation when the viewer takes part in it.
+func (a appUseCase) conversationOf(id int, viewer string) (models.Conversation, error) {
+	conversation, err := a.appRepository.SelectConversationById(id, viewer)
+	if err == pgx.ErrNoRows {
+		return models.Conversation{}, models.ErrNotParticipant
+	}
+
+	return conversation, err
+}
@@ -0,0 +1,392 @@
+package usecase
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+const (
+	defaultReplacement = "***"
+	excerptLength      = 200
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+func (a appUseCase) CreateFilterRule(rule models.FilterRule) (models.FilterRule, error) {
+	if err := requireAdmin(rule.CreatedBy); err != nil {
+		return models.FilterRule{}, err
+	}
+
+	if err := validateFilterRule(&rule); err != nil {
+		return models.FilterRule{}, err
+	}
+
+	return a.appRepository.InsertFilterRule(rule)
+}
+
+func (a appUseCase) CheckFilterRules(forum, caller string) ([]models.FilterRule, error) {
+	if err := requireAdmin(caller); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectFilterRules(forum)
+}
+
+func (a appUseCase) RemoveFilterRule(id int, caller string) error {
+	if err := requireAdmin(caller); err != nil {
+		return err
+	}
+
+	return a.appRepository.DeleteFilterRule(id)
+}
+
+func (a appUseCase) CheckFilterHits(caller string, parameters models.QueryParameters) ([]models.FilterHit, error) {
+	if err := requireAdmin(caller); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectFilterHits(parameters)
+}
+
+// TestFilters runs the message through the forum rules as if it was posted,
+// without recording anything.
+func (a appUseCase) TestFilters(check models.FilterCheck, caller string) (models.FilterCheck, error) {
+	if err := requireAdmin(caller); err != nil {
+		return models.FilterCheck{}, err
+	}
+
+	rules, err := a.appRepository.SelectFilterRules(check.Forum)
+	if err != nil {
+		return models.FilterCheck{}, err
+	}
+
+	f := newMessageFilter(a, rules, check.Forum)
+	result, hits, err := f.apply(check.Author, check.Message)
+	if _, ok := err.(*models.FilterError); err != nil && !ok {
+		return models.FilterCheck{}, err
+	}
+
+	check.Result = result
+	check.Reject = err != nil
+	check.Hits = hits
+	if check.Hits == nil {
+		check.Hits = []models.FilterHit{}
+	}
+
+	return check, nil
+}
+
+func validateFilterRule(rule *models.FilterRule) error {
+	if rule.Action == "" {
+		rule.Action = models.FilterActionReject
+	}
+	if rule.Action != models.FilterActionReject && rule.Action != models.FilterActionReplace {
+		return models.ErrBadFilter
+	}
+
+	switch rule.Kind {
+	case models.FilterKindWords:
+		if len(rule.Words) == 0 {
+			return models.ErrBadFilter
+		}
+		for _, word := range rule.Words {
+			if strings.TrimSpace(word) == "" || strings.Contains(word, "\n") {
+				return models.ErrBadFilter
+			}
+		}
+	case models.FilterKindRegex:
+		if _, err := regexp.Compile(rule.Pattern); err != nil || rule.Pattern == "" {
+			return models.ErrBadFilter
+		}
+	case models.FilterKindLinks:
+		if rule.MaxLinks < 0 || rule.NewUserPosts < 0 || rule.Action != models.FilterActionReject {
+			return models.ErrBadFilter
+		}
+	case models.FilterKindDuplicate:
+		if rule.Window <= 0 || rule.Action != models.FilterActionReject {
+			return models.ErrBadFilter
+		}
+	default:
+		return models.ErrBadFilter
+	}
+
+	if rule.Action == models.FilterActionReplace && rule.Replacement == "" {
+		rule.Replacement = defaultReplacement
+	}
+
+	return nil
+}
+
+// messageFilter applies the rules of a forum to a batch of messages. Duplicates
+// are looked for in the batch as well as in the stored messages.
+type messageFilter struct {
+	a     appUseCase
+	rules []models.FilterRule
+	// patterns are the compiled words and regex rules, by rule index.
+	patterns []*regexp.Regexp
+	// skipDuplicates skips the duplicate rules, for text which doesn't add a
+	// new message.
+	skipDuplicates bool
+	forum          string
+	seen           map[string]bool
+	counts         map[string]int
+}
+
+func newMessageFilter(a appUseCase, rules []models.FilterRule, forum string) *messageFilter {
+	patterns := make([]*regexp.Regexp, len(rules))
+	for i, rule := range rules {
+		patterns[i] = compileRule(rule)
+	}
+
+	return &messageFilter{
+		a:        a,
+		rules:    rules,
+		patterns: patterns,
+		forum:    forum,
+		seen:     make(map[string]bool),
+		counts:   make(map[string]int),
+	}
+}
+
+// compileRule returns the pattern of a words or regex rule, nil for the other
+// kinds and for patterns which no longer compile.
+func compileRule(rule models.FilterRule) *regexp.Regexp {
+	switch rule.Kind {
+	case models.FilterKindWords:
+		quoted := make([]string, 0, len(rule.Words))
+		for _, word := range rule.Words {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+
+		return regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)
+	case models.FilterKindRegex:
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil
+		}
+
+		return pattern
+	}
+
+	return nil
+}
+
+// apply returns the message with the replacements made and the rules hit. It
+// fails with a FilterError on the first rejecting rule not in dry-run mode.
+func (f *messageFilter) apply(author, message string) (string, []models.FilterHit, error) {
+	var hits []models.FilterHit
+
+	for i, rule := range f.rules {
+		if f.skipDuplicates && rule.Kind == models.FilterKindDuplicate {
+			continue
+		}
+
+		matched, result, err := f.match(rule, f.patterns[i], author, message)
+		if err != nil {
+			return "", nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		hits = append(hits, models.FilterHit{
+			Rule:    rule.Id,
+			Forum:   f.forum,
+			Author:  author,
+			Action:  rule.Action,
+			DryRun:  rule.DryRun,
+			Excerpt: excerpt(message),
+		})
+
+		if rule.DryRun {
+			continue
+		}
+
+		if rule.Action == models.FilterActionReject {
+			return "", hits, &models.FilterError{Rule: rule}
+		}
+
+		message = result
+	}
+
+	f.seen[strings.ToLower(author)+"\n"+message] = true
+
+	return message, hits, nil
+}
+
+// match reports whether the rule applies to the message and the message with
+// the rule replacements made. Pattern is the compiled rule, if it has one.
+func (f *messageFilter) match(rule models.FilterRule, pattern *regexp.Regexp, author, message string) (bool, string, error) {
+	switch rule.Kind {
+	case models.FilterKindWords:
+		return replaceMatches(wholeWords(message, pattern.FindAllStringIndex(message, -1)), rule, message)
+	case models.FilterKindRegex:
+		if pattern == nil {
+			return false, message, nil
+		}
+
+		return replace(pattern, rule, message)
+	case models.FilterKindLinks:
+		if len(linkPattern.FindAllStringIndex(message, -1)) <= rule.MaxLinks {
+			return false, message, nil
+		}
+
+		if rule.NewUserPosts == 0 {
+			return true, message, nil
+		}
+
+		count, err := f.postCount(author)
+		if err != nil {
+			return false, message, err
+		}
+
+		return count < rule.NewUserPosts, message, nil
+	case models.FilterKindDuplicate:
+		if f.seen[strings.ToLower(author)+"\n"+message] {
+			return true, message, nil
+		}
+
+		found, err := f.a.appRepository.HasRecentMessage(author, message, rule.Window)
+
+		return found, message, err
+	}
+
+	return false, message, nil
+}
+
+func (f *messageFilter) postCount(author string) (int, error) {
+	key := strings.ToLower(author)
+	if count, ok := f.counts[key]; ok {
+		return count, nil
+	}
+
+	count, err := f.a.appRepository.CountPostsByAuthor(author)
+	if err != nil {
+		return 0, err
+	}
+	f.counts[key] = count
+
+	return count, nil
+}
+
+func replace(pattern *regexp.Regexp, rule models.FilterRule, message string) (bool, string, error) {
+	return replaceMatches(pattern.FindAllStringIndex(message, -1), rule, message)
+}
+
+func replaceMatches(matches [][]int, rule models.FilterRule, message string) (bool, string, error) {
+	if len(matches) == 0 {
+		return false, message, nil
+	}
+
+	if rule.Action != models.FilterActionReplace {
+		return true, message, nil
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, match := range matches {
+		result.WriteString(message[last:match[0]])
+		result.WriteString(rule.Replacement)
+		last = match[1]
+	}
+	result.WriteString(message[last:])
+
+	return true, result.String(), nil
+}
+
+// wholeWords keeps the matches not glued to letters or digits. The \b of
+// regexp only knows ASCII, which misses Cyrillic words.
+func wholeWords(message string, matches [][]int) [][]int {
+	var result [][]int
+	for _, match := range matches {
+		before, _ := utf8.DecodeLastRuneInString(message[:match[0]])
+		after, _ := utf8.DecodeRuneInString(message[match[1]:])
+		if isWordRune(before) || isWordRune(after) {
+			continue
+		}
+
+		result = append(result, match)
+	}
+
+	return result
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+func excerpt(message string) string {
+	runes := []rune(message)
+	if len(runes) > excerptLength {
+		return string(runes[:excerptLength])
+	}
+
+	return message
+}
+
+// filterMessages runs the messages of the authors through the forum filters,
+// records the hits and returns the messages to store.
+func (a appUseCase) filterMessages(forum string, authors, messages []string) ([]string, error) {
+	return a.runFilters(forum, authors, messages, false)
+}
+
+// filterTitle runs a thread title through the forum filters like a message,
+// except for the duplicate rules: titles often repeat the message or earlier
+// titles.
+func (a appUseCase) filterTitle(forum, author, title string) (string, error) {
+	titles, err := a.runFilters(forum, []string{author}, []string{title}, true)
+	if err != nil {
+		return "", err
+	}
+
+	return titles[0], nil
+}
+
+// filterEdit runs an edited message through the forum filters. The duplicate
+// rules are skipped, an edit adds no message and would be found as a
+// duplicate of the one it replaces.
+func (a appUseCase) filterEdit(forum, author, message string) (string, error) {
+	messages, err := a.runFilters(forum, []string{author}, []string{message}, true)
+	if err != nil {
+		return "", err
+	}
+
+	return messages[0], nil
+}
+
+func (a appUseCase) runFilters(forum string, authors, messages []string, skipDuplicates bool) ([]string, error) {
+	rules, err := a.appRepository.SelectFilterRules(forum)
+	if err != nil || len(rules) == 0 {
+		return messages, err
+	}
+
+	f := newMessageFilter(a, rules, forum)
+	f.skipDuplicates = skipDuplicates
+	result := make([]string, len(messages))
+	var hits []models.FilterHit
+	var rejected error
+	for i := range messages {
+		message, messageHits, err := f.apply(authors[i], messages[i])
+		hits = append(hits, messageHits...)
+		if err != nil {
+			rejected = err
+			break
+		}
+
+		result[i] = message
+	}
+
+	if err := a.appRepository.InsertFilterHits(hits); err != nil {
+		return nil, err
+	}
+
+	if rejected != nil {
+		return nil, rejected
+	}
+
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (a appUseCase) CheckForums(parameters models.QueryParameters) ([]models.Forum, error) {
+	return a.appRepository.SelectForums(parameters)
+}
+
+// EditForum re-titles the forum or transfers it to another owner.
+func (a appUseCase) EditForum(forum models.Forum, caller string) (models.Forum, error) {
+	current, err := a.appRepository.SelectForumBySlug(forum.Slug)
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	if err := a.requireForumOwner(current, caller); err != nil {
+		return models.Forum{}, err
+	}
+
+	if current.Archived {
+		return models.Forum{}, models.ErrForumArchived
+	}
+
+	if forum.User != "" && !strings.EqualFold(forum.User, current.User) {
+		if _, err := a.checkBans(current.Slug, []string{forum.User}); err != nil {
+			return models.Forum{}, err
+		}
+	}
+
+	return a.appRepository.UpdateForum(forum)
+}
+
+// DeleteForum either archives the forum or removes it with all its content.
+// The mode has to be given, there is no default for removing everything.
+func (a appUseCase) DeleteForum(slug, mode, caller string) (models.Forum, error) {
+	if !models.IsForumDeleteMode(mode) {
+		return models.Forum{}, models.ErrBadDeleteMode
+	}
+
+	forum, err := a.appRepository.SelectForumBySlug(slug)
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	if err := a.requireForumOwner(forum, caller); err != nil {
+		return models.Forum{}, err
+	}
+
+	if mode == models.ForumDeleteArchive {
+		return a.appRepository.ArchiveForum(forum.Slug)
+	}
+
+	if err := a.appRepository.DeleteForum(forum.Slug); err != nil {
+		return models.Forum{}, err
+	}
+
+	_, err = a.CleanupAttachments()
+
+	return forum, err
+}
+
+// requireForumOwner lets the owner of the forum and admins through.
+func (a appUseCase) requireForumOwner(forum models.Forum, nickname string) error {
+	if nickname != "" && strings.EqualFold(forum.User, nickname) {
+		return nil
+	}
+
+	return requireAdmin(nickname)
+}
+
+// checkForumWritable fails with ErrForumArchived for archived forums.
+func (a appUseCase) checkForumWritable(forum string) error {
+	f, err := a.appRepository.SelectForumBySlug(forum)
+	if err != nil {
+		return err
+	}
+
+	if f.Archived {
+		return models.ErrForumArchived
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func (a appUseCase) SetForumVisibility(forum, visibility, caller string) (models.Forum, error) {
+	if !models.IsForumVisibility(visibility) {
+		return models.Forum{}, models.ErrBadVisibility
+	}
+
+	if err := a.requireModerator(forum, caller); err != nil {
+		return models.Forum{}, err
+	}
+
+	return a.appRepository.UpdateForumVisibility(forum, visibility)
+}
+
+// JoinForum adds the user to a public forum at once. Joining other forums
+// files a request for the moderators.
+func (a appUseCase) JoinForum(request models.JoinRequest) (models.JoinRequest, error) {
+	forum, err := a.appRepository.SelectForumBySlug(request.Forum)
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	if _, err := a.checkBans(forum.Slug, []string{request.Nickname}); err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	if forum.Visibility != models.ForumPublic {
+		return a.appRepository.InsertJoinRequest(request)
+	}
+
+	member, err := a.appRepository.InsertForumMember(forum.Slug, request.Nickname)
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	return models.JoinRequest{
+		Forum:    member.Forum,
+		Nickname: member.Nickname,
+		Status:   models.JoinRequestApproved,
+	}, nil
+}
+
+func (a appUseCase) CheckJoinRequests(forum, moderator, status string, parameters models.QueryParameters) ([]models.JoinRequest, error) {
+	if err := a.requireModerator(forum, moderator); err != nil {
+		return nil, err
+	}
+
+	if status == "" {
+		status = models.JoinRequestPending
+	}
+
+	return a.appRepository.SelectJoinRequests(forum, status, parameters)
+}
+
+func (a appUseCase) DecideJoinRequest(id int, decision models.JoinDecision) (models.JoinRequest, error) {
+	request, err := a.appRepository.SelectJoinRequestById(id)
+	if err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	if err := a.requireModerator(request.Forum, decision.Actor); err != nil {
+		return models.JoinRequest{}, err
+	}
+
+	request.Status = models.JoinRequestRejected
+	if decision.Approve {
+		request.Status = models.JoinRequestApproved
+	}
+	request.DecidedBy = decision.Actor
+
+	return a.appRepository.DecideJoinRequest(request)
+}
+
+func (a appUseCase) CreateInvitation(invitation models.Invitation) (models.Invitation, error) {
+	if err := a.requireModerator(invitation.Forum, invitation.CreatedBy); err != nil {
+		return models.Invitation{}, err
+	}
+
+	if invitation.MaxUses < 0 {
+		return models.Invitation{}, models.ErrBadInvitation
+	}
+
+	invitation.Token = uuid.NewString()
+
+	return a.appRepository.InsertInvitation(invitation)
+}
+
+func (a appUseCase) AcceptInvitation(token, nickname string) (models.ForumMember, error) {
+	if nickname == "" {
+		return models.ForumMember{}, models.ErrBadInvitation
+	}
+
+	return a.appRepository.AcceptInvitation(token, nickname)
+}
+
+func (a appUseCase) CheckForumMembers(forum, viewer string, parameters models.QueryParameters) ([]models.ForumMember, error) {
+	if err := a.CheckForumAccess(forum, viewer); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectForumMembers(forum, parameters)
+}
+
+// RemoveForumMember lets users leave forums and moderators remove members.
+// Owners stay members of their forums.
+func (a appUseCase) RemoveForumMember(forum, nickname, caller string) error {
+	f, err := a.appRepository.SelectForumBySlug(forum)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(f.User, nickname) {
+		return models.ErrForbidden
+	}
+
+	if !strings.EqualFold(nickname, caller) {
+		if err := a.requireModerator(forum, caller); err != nil {
+			return err
+		}
+	}
+
+	return a.appRepository.DeleteForumMember(forum, nickname)
+}
+
+// CheckForumAccess fails with ErrForumPrivate when the forum is private and
+// the viewer is not its member.
+func (a appUseCase) CheckForumAccess(forum, viewer string) error {
+	f, err := a.appRepository.SelectForumBySlug(forum)
+	if err != nil {
+		return err
+	}
+
+	if f.Visibility != models.ForumPrivate {
+		return nil
+	}
+
+	if err := a.requireMembers(f.Slug, []string{viewer}); err != nil {
+		return models.ErrForumPrivate
+	}
+
+	return nil
+}
+
+// checkPostingAccess fails with ErrNotMember when the forum takes posts from
+// members only and one of the authors is not, and with ErrForumArchived when
+// the forum takes no posts at all.
+func (a appUseCase) checkPostingAccess(forum string, authors []string) error {
+	f, err := a.appRepository.SelectForumBySlug(forum)
+	if err != nil {
+		return err
+	}
+
+	if f.Archived {
+		return models.ErrForumArchived
+	}
+
+	if f.Visibility == models.ForumPublic {
+		return nil
+	}
+
+	return a.requireMembers(f.Slug, authors)
+}
+
+func (a appUseCase) requireMembers(forum string, nicknames []string) error {
+	checked := make(map[string]bool)
+	for _, nickname := range nicknames {
+		key := strings.ToLower(nickname)
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		if nickname == "" {
+			return models.ErrNotMember
+		}
+
+		member, err := a.appRepository.IsForumMember(forum, nickname)
+		if err != nil {
+			return err
+		}
+
+		if !member {
+			return models.ErrNotMember
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (a appUseCase) CreateReport(report models.Report) (models.Report, error) {
+	if !models.IsReportReason(report.Reason) {
+		return models.Report{}, models.ErrBadReport
+	}
+
+	switch {
+	case report.Post != 0:
+		post, err := a.appRepository.SelectPostById(report.Post)
+		if err != nil {
+			return models.Report{}, err
+		}
+
+		report.Thread = post.Thread
+		report.Forum = post.Forum
+	case report.Thread != 0:
+		thread, err := a.appRepository.SelectThreadById(report.Thread)
+		if err != nil {
+			return models.Report{}, err
+		}
+
+		report.Forum = thread.Forum
+	default:
+		return models.Report{}, models.ErrBadReport
+	}
+
+	if _, err := a.checkBans(report.Forum, []string{report.Reporter}); err != nil {
+		return models.Report{}, err
+	}
+
+	return a.appRepository.InsertReport(report)
+}
+
+func (a appUseCase) CheckForumReports(forum, moderator, status string, parameters models.QueryParameters) ([]models.Report, error) {
+	if err := a.requireModerator(forum, moderator); err != nil {
+		return nil, err
+	}
+
+	if status == "" {
+		status = models.ReportStatusOpen
+	}
+
+	return a.appRepository.SelectReportsByForum(forum, status, parameters)
+}
+
+// ResolveReport applies the moderation action and closes the report in one
+// unit of work, so the action is applied once and never goes unlogged.
+func (a appUseCase) ResolveReport(id int, action models.ModerationAction) (models.Report, error) {
+	var result models.Report
+	err := a.inTransaction(func(tx appUseCase) error {
+		var err error
+		result, err = tx.resolveReport(id, action)
+
+		return err
+	})
+
+	return result, err
+}
+
+func (a appUseCase) resolveReport(id int, action models.ModerationAction) (models.Report, error) {
+	report, err := a.appRepository.LockReport(id)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	if report.Status != models.ReportStatusOpen {
+		return models.Report{}, models.ErrReportResolved
+	}
+
+	if err := a.requireModerator(report.Forum, action.Moderator); err != nil {
+		return models.Report{}, err
+	}
+
+	report.Status = models.ReportStatusResolved
+	var target string
+
+	switch action.Action {
+	case models.ModerationDismiss:
+		report.Status = models.ReportStatusDismissed
+		target = fmt.Sprintf("report:%d", report.Id)
+	case models.ModerationHidePost:
+		if report.Post == 0 {
+			return models.Report{}, models.ErrBadAction
+		}
+
+		if err := a.appRepository.HidePost(report.Post); err != nil {
+			return models.Report{}, err
+		}
+		target = fmt.Sprintf("post:%d", report.Post)
+	case models.ModerationLockThread:
+		if err := a.appRepository.LockThread(report.Thread); err != nil {
+			return models.Report{}, err
+		}
+		target = fmt.Sprintf("thread:%d", report.Thread)
+	case models.ModerationBanAuthor:
+		author, err := a.reportedAuthor(report)
+		if err != nil {
+			return models.Report{}, err
+		}
+
+		_, err = a.appRepository.InsertBan(models.Ban{
+			Nickname:  author,
+			Forum:     report.Forum,
+			Reason:    report.Reason,
+			CreatedBy: action.Moderator,
+		})
+		if err != nil {
+			return models.Report{}, err
+		}
+		target = "user:" + author
+	default:
+		return models.Report{}, models.ErrBadAction
+	}
+
+	report.ResolvedBy = action.Moderator
+	report.Action = action.Action
+
+	return a.appRepository.ResolveReport(report, models.ModerationLogEntry{
+		Report:    report.Id,
+		Forum:     report.Forum,
+		Moderator: action.Moderator,
+		Action:    action.Action,
+		Target:    target,
+		Comment:   action.Comment,
+	})
+}
+
+func (a appUseCase) reportedAuthor(report models.Report) (string, error) {
+	if report.Post != 0 {
+		post, err := a.appRepository.SelectPostById(report.Post)
+
+		return post.Author, err
+	}
+
+	thread, err := a.appRepository.SelectThreadById(report.Thread)
+
+	return thread.Author, err
+}
+
+func (a appUseCase) CheckModerationLog(forum, moderator string, parameters models.QueryParameters) ([]models.ModerationLogEntry, error) {
+	if err := a.requireModerator(forum, moderator); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectModerationLog(forum, parameters)
+}
+
+func (a appUseCase) CheckForumModerators(forum string) ([]string, error) {
+	if _, err := a.appRepository.SelectForumBySlug(forum); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectForumModerators(forum)
+}
+
+// AddForumModerator lets the forum owner appoint a moderator.
+func (a appUseCase) AddForumModerator(slug, nickname, owner string) error {
+	forum, err := a.appRepository.SelectForumBySlug(slug)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(forum.User, owner) {
+		return models.ErrForbidden
+	}
+
+	return a.appRepository.InsertForumModerator(forum.Slug, nickname)
+}
+
+func (a appUseCase) requireModerator(forum, nickname string) error {
+	if nickname == "" {
+		return models.ErrForbidden
+	}
+
+	moderator, err := a.appRepository.IsForumModerator(forum, nickname)
+	if err != nil {
+		return err
+	}
+
+	if !moderator {
+		return models.ErrForbidden
+	}
+
+	return nil
+}
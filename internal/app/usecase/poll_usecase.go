@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// CreatePoll attaches a poll to the thread. Only the author of the thread
+// may do so, and a thread has one poll at most.
+func (a appUseCase) CreatePoll(thread int, poll models.Poll, caller string) (models.Poll, error) {
+	current, err := a.appRepository.SelectThreadById(thread)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	if caller == "" || !strings.EqualFold(current.Author, caller) {
+		return models.Poll{}, models.ErrForbidden
+	}
+
+	if _, err := a.checkBans(current.Forum, []string{caller}); err != nil {
+		return models.Poll{}, err
+	}
+
+	if err := a.checkForumWritable(current.Forum); err != nil {
+		return models.Poll{}, err
+	}
+
+	poll, err = validatePoll(poll)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	poll.Thread = current.Id
+	poll.CreatedBy = current.Author
+
+	return a.appRepository.InsertPoll(poll)
+}
+
+func (a appUseCase) CheckPoll(thread int, viewer string) (models.Poll, error) {
+	return a.appRepository.SelectPollByThread(thread, viewer)
+}
+
+// VotePoll replaces the choice of the viewer while the poll is open. Votes of
+// shadow-banned users are silently dropped.
+func (a appUseCase) VotePoll(thread int, viewer string, vote models.PollVote) (models.Poll, error) {
+	if viewer == "" {
+		return models.Poll{}, models.ErrForbidden
+	}
+
+	current, err := a.appRepository.SelectThreadById(thread)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	if err := a.CheckForumAccess(current.Forum, viewer); err != nil {
+		return models.Poll{}, err
+	}
+
+	if err := a.checkForumWritable(current.Forum); err != nil {
+		return models.Poll{}, err
+	}
+
+	shadowed, err := a.checkBans(current.Forum, []string{viewer})
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	poll, err := a.appRepository.SelectPollByThread(current.Id, viewer)
+	if err != nil {
+		return models.Poll{}, err
+	}
+
+	seen := make(map[int]bool)
+	for _, option := range vote.Options {
+		if seen[option] {
+			return models.Poll{}, models.ErrBadPollVote
+		}
+		seen[option] = true
+	}
+
+	if len(vote.Options) == 0 || (!poll.Multiple && len(vote.Options) > 1) {
+		return models.Poll{}, models.ErrBadPollVote
+	}
+
+	if poll.Closed {
+		return models.Poll{}, models.ErrPollClosed
+	}
+
+	if shadowed[strings.ToLower(viewer)] {
+		return poll, nil
+	}
+
+	if err := a.appRepository.ReplacePollVote(poll.Id, viewer, vote.Options); err != nil {
+		return models.Poll{}, err
+	}
+
+	return a.appRepository.SelectPollByThread(current.Id, viewer)
+}
+
+// validatePoll trims the poll and fails with ErrBadPoll when it has no
+// question, too few or too many options, or closes in the past.
+func validatePoll(poll models.Poll) (models.Poll, error) {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" {
+		return models.Poll{}, models.ErrBadPoll
+	}
+
+	if len(poll.Options) < configs.PollConfig.MinOptions || len(poll.Options) > configs.PollConfig.MaxOptions {
+		return models.Poll{}, models.ErrBadPoll
+	}
+
+	options := make([]models.PollOption, 0, len(poll.Options))
+	for _, option := range poll.Options {
+		title := strings.TrimSpace(option.Title)
+		if title == "" {
+			return models.Poll{}, models.ErrBadPoll
+		}
+
+		options = append(options, models.PollOption{Title: title})
+	}
+	poll.Options = options
+
+	if poll.Closes != "" {
+		closes, err := time.Parse(time.RFC3339Nano, poll.Closes)
+		if err != nil || !closes.After(time.Now()) {
+			return models.Poll{}, models.ErrBadPoll
+		}
+	}
+
+	return poll, nil
+}
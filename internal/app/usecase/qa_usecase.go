@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (a appUseCase) SetForumQA(forum string, qa bool, caller string) (models.Forum, error) {
+	if err := a.requireModerator(forum, caller); err != nil {
+		return models.Forum{}, err
+	}
+
+	return a.appRepository.UpdateForumQA(forum, qa)
+}
+
+// AcceptAnswer lets the author of a question in a Q&A forum mark one of its
+// posts as the accepted answer.
+func (a appUseCase) AcceptAnswer(thread int, answer models.AcceptedAnswer, caller string) (models.Thread, error) {
+	current, err := a.appRepository.SelectThreadById(thread)
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	if caller == "" || !strings.EqualFold(current.Author, caller) {
+		return models.Thread{}, models.ErrForbidden
+	}
+
+	forum, err := a.appRepository.SelectForumBySlug(current.Forum)
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	if !forum.QA {
+		return models.Thread{}, models.ErrNotQAForum
+	}
+
+	if forum.Archived {
+		return models.Thread{}, models.ErrForumArchived
+	}
+
+	if _, err := a.checkBans(forum.Slug, []string{caller}); err != nil {
+		return models.Thread{}, err
+	}
+
+	if answer.Post != 0 {
+		post, err := a.appRepository.SelectPostById(answer.Post)
+		if err != nil {
+			return models.Thread{}, err
+		}
+
+		if post.Thread != current.Id {
+			return models.Thread{}, models.ErrPostNotInThread
+		}
+	}
+
+	return a.appRepository.UpdateThreadAnswer(current.Id, answer.Post)
+}
+
+// AcceptedAnswerFirst moves the accepted answer of the thread to the top of
+// the first page of its posts, whatever their order, and leaves it out of the
+// later pages. The first page keeps its size: when the answer comes from
+// further on, the last post goes to the next page. A limit of 0 stands for
+// pages not counted in posts, which keep all of theirs.
+func (a appUseCase) AcceptedAnswerFirst(posts []models.Post, since, limit int, viewer string) ([]models.Post, error) {
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	thread, err := a.appRepository.SelectThreadById(posts[0].Thread)
+	if err != nil || thread.Answer == 0 {
+		return posts, err
+	}
+
+	answer, err := a.appRepository.SelectPostById(thread.Answer)
+	if err != nil {
+		return nil, err
+	}
+
+	if answer.Shadow && !strings.EqualFold(answer.Author, viewer) {
+		return posts, nil
+	}
+
+	rest := make([]models.Post, 0, len(posts))
+	for _, post := range posts {
+		if post.Id != answer.Id {
+			rest = append(rest, post)
+		}
+	}
+
+	if since != 0 {
+		// An empty page would end the listing early.
+		if len(rest) == 0 {
+			return posts, nil
+		}
+
+		return rest, nil
+	}
+
+	// A page of one post would carry the answer alone, and the next page,
+	// following the answer, would skip the posts before it.
+	if len(rest) == len(posts) && limit > 1 && len(posts) >= limit {
+		rest = rest[:len(rest)-1]
+	}
+
+	answers := []models.Post{answer}
+	if err := a.fillAttachments(answers); err != nil {
+		return nil, err
+	}
+
+	return append(answers, rest...), nil
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+// validName rejects names that would not fit into a route segment.
+func validName(name string) bool {
+	return name != "" && !strings.ContainsRune(name, '/') && strings.IndexFunc(name, unicode.IsSpace) < 0
+}
+
+// RenameForum lets the owner of the forum or an admin change its slug.
+func (a appUseCase) RenameForum(slug string, rename models.Rename, caller string) (models.Forum, error) {
+	forum, err := a.appRepository.SelectForumBySlug(slug)
+	if err != nil {
+		return models.Forum{}, err
+	}
+
+	if err := a.requireForumOwner(forum, caller); err != nil {
+		return models.Forum{}, err
+	}
+
+	if !validName(rename.Slug) {
+		return models.Forum{}, models.ErrBadName
+	}
+
+	return a.appRepository.RenameForum(forum.Slug, rename.Slug)
+}
+
+// RenameThread lets the author of the thread or a moderator of its forum
+// change the slug. Numeric slugs are rejected as they read as thread ids.
+func (a appUseCase) RenameThread(id int, rename models.Rename, caller string) (models.Thread, error) {
+	thread, err := a.appRepository.SelectThreadById(id)
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	if caller == "" || !strings.EqualFold(thread.Author, caller) {
+		if err := a.requireModerator(thread.Forum, caller); err != nil {
+			return models.Thread{}, err
+		}
+	}
+
+	if !validName(rename.Slug) {
+		return models.Thread{}, models.ErrBadName
+	}
+
+	if _, err := strconv.Atoi(rename.Slug); err == nil {
+		return models.Thread{}, models.ErrBadName
+	}
+
+	result, err := a.appRepository.RenameThread(thread.Id, rename.Slug)
+	if err != nil {
+		return models.Thread{}, err
+	}
+
+	return a.fillThreadTags(result)
+}
+
+// RenameUser lets users change their own nickname. Admins can rename anyone.
+func (a appUseCase) RenameUser(nickname string, rename models.Rename, caller string) (models.User, error) {
+	if caller == "" || !strings.EqualFold(nickname, caller) {
+		if err := requireAdmin(caller); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if !validName(rename.Nickname) {
+		return models.User{}, models.ErrBadName
+	}
+
+	return a.appRepository.RenameUser(nickname, rename.Nickname)
+}
+
+func (a appUseCase) ResolveRename(kind, old string) (string, error) {
+	return a.appRepository.SelectRenamed(kind, old)
+}
@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yarikTri/dbms-term-proj/configs"
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (a appUseCase) CheckForumTags(forum string, parameters models.QueryParameters) ([]models.TagUsage, error) {
+	if _, err := a.appRepository.SelectForumBySlug(forum); err != nil {
+		return nil, err
+	}
+
+	return a.appRepository.SelectForumTags(forum, parameters)
+}
+
+func (a appUseCase) CheckThreadsByTag(parameters models.QueryParameters) ([]models.Thread, error) {
+	tag, err := normalizeTag(parameters.Tag)
+	if err != nil {
+		return nil, err
+	}
+	parameters.Tag = tag
+
+	threads, err := a.appRepository.SelectThreadsByTag(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.fillTags(threads); err != nil {
+		return nil, err
+	}
+
+	err = a.fillUnread(parameters.Viewer, threads)
+
+	return threads, err
+}
+
+// normalizeTags lowercases the tags and drops duplicates. It fails with
+// ErrBadTags on too many or malformed tags.
+func normalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		result = append(result, tag)
+	}
+
+	if len(result) > configs.TagConfig.MaxTags {
+		return nil, models.ErrBadTags
+	}
+
+	return result, nil
+}
+
+// normalizeTag takes letters, digits, dashes and underscores only.
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || utf8.RuneCountInString(tag) > configs.TagConfig.MaxLength {
+		return "", models.ErrBadTags
+	}
+
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return "", models.ErrBadTags
+		}
+	}
+
+	return tag, nil
+}
+
+// fillTags sets the tags of the threads.
+func (a appUseCase) fillTags(threads []models.Thread) error {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(threads))
+	for _, thread := range threads {
+		ids = append(ids, thread.Id)
+	}
+
+	tags, err := a.appRepository.SelectThreadTags(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range threads {
+		threads[i].Tags = tags[threads[i].Id]
+	}
+
+	return nil
+}
+
+func (a appUseCase) fillThreadTags(thread models.Thread) (models.Thread, error) {
+	threads := []models.Thread{thread}
+	err := a.fillTags(threads)
+
+	return threads[0], err
+}
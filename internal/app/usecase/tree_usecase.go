@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/jackc/pgx"
+)
+
+func (a appUseCase) CheckPostChildren(id int, parameters models.PostTreeParameters) ([]models.Post, error) {
+	post, err := a.treePost(id, parameters.Viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := a.appRepository.SelectPostChildren(post, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.fillAttachments(posts)
+
+	return posts, err
+}
+
+func (a appUseCase) CheckPostAncestors(id int, viewer string) ([]models.Post, error) {
+	post, err := a.treePost(id, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := a.appRepository.SelectPostAncestors(post, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.fillAttachments(posts)
+
+	return posts, err
+}
+
+// treePost loads the post a subtree is asked for, checking that the viewer
+// may see it before anything around it is selected, so that an empty subtree
+// doesn't tell a hidden post exists.
+func (a appUseCase) treePost(id int, viewer string) (models.Post, error) {
+	post, err := a.appRepository.SelectPostById(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	if post.Shadow && !strings.EqualFold(post.Author, viewer) {
+		return models.Post{}, pgx.ErrNoRows
+	}
+
+	if err := a.CheckForumAccess(post.Forum, viewer); err != nil {
+		return models.Post{}, err
+	}
+
+	return post, nil
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+)
+
+func (a appUseCase) MarkThreadRead(marker models.ReadMarker) (models.ReadMarker, error) {
+	if marker.Post != 0 {
+		post, err := a.appRepository.SelectPostById(marker.Post)
+		if err != nil {
+			return models.ReadMarker{}, err
+		}
+
+		if post.Thread != marker.Thread {
+			return models.ReadMarker{}, models.ErrPostNotInThread
+		}
+	}
+
+	return a.appRepository.UpsertReadMarker(marker)
+}
+
+// CheckUnreadThreads returns a page of the unread threads of the user and the
+// unread posts over all of them.
+func (a appUseCase) CheckUnreadThreads(nickname string, parameters models.QueryParameters) ([]models.UnreadThread, int, error) {
+	if _, err := a.appRepository.SelectUserByNickname(nickname); err != nil {
+		return nil, 0, err
+	}
+
+	threads, err := a.appRepository.SelectUnreadThreads(nickname, parameters)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := a.appRepository.SelectUnreadTotal(nickname)
+
+	return threads, total, err
+}
+
+// fillUnread sets the unread counters of threads for the viewer, if any.
+func (a appUseCase) fillUnread(viewer string, threads []models.Thread) error {
+	if viewer == "" || len(threads) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(threads))
+	for _, thread := range threads {
+		ids = append(ids, thread.Id)
+	}
+
+	counts, err := a.appRepository.SelectUnreadCounts(viewer, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range threads {
+		unread := counts[threads[i].Id]
+		threads[i].Unread = &unread
+	}
+
+	return nil
+}
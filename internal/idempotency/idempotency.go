@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"net/http"
+	"time"
+)
+
+// Response is the answer to the first request with a key, replayed to its
+// retries.
+type Response struct {
+	Status int
+	// Header holds the replayedHeaders the response was sent with.
+	Header http.Header
+	Body   []byte
+}
+
+// replayedHeaders describe the stored response itself. The others, like the
+// request id or the rate limits, belong to the request answered.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location", "Vary"}
+
+// Claim describes who holds a key after Begin.
+type Claim struct {
+	// New is set when the key was free and has been taken by the request.
+	New bool
+	// Hash identifies the request holding the key.
+	Hash string
+	// Response is nil while the request holding the key is being served.
+	Response *Response
+}
+
+// Store keeps the keys with the hash of the request holding them and its
+// response until the keys expire.
+type Store interface {
+	// Begin takes the key for the request unless another request holds it, in
+	// which case the claim of that request is returned.
+	Begin(key, hash string, ttl time.Duration) (Claim, error)
+	// Finish stores the response to the request holding the key.
+	Finish(key string, response Response) error
+	// Release frees the key so that a retry runs the request again.
+	Release(key string) error
+}
@@ -0,0 +1,276 @@
+package idempotency
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type request struct {
+	path   string
+	key    string
+	caller string
+	body   string
+}
+
+func (r request) send(router http.Handler) *httptest.ResponseRecorder {
+	if r.path == "" {
+		r.path = "/api/forum/f/create"
+	}
+
+	req := httptest.NewRequest(http.MethodPost, r.path, strings.NewReader(r.body))
+	if r.key != "" {
+		req.Header.Set(Header, r.key)
+	}
+	if r.caller != "" {
+		req.Header.Set("X-Nickname", r.caller)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+// newRouter counts the calls of its handler, which answers with the status
+// the body asks for and a body of its own.
+func newRouter(store Store) (http.Handler, *int) {
+	calls := 0
+	router := mux.NewRouter()
+	router.HandleFunc("/api/forum/{slug}/create", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		body, _ := io.ReadAll(r.Body)
+		status := http.StatusCreated
+		fmt.Sscanf(string(body), "%d", &status)
+
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, calls))
+		w.Header().Set("X-Request-Id", fmt.Sprint(calls))
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	})
+	router.HandleFunc("/api/forum/{slug}/details", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	router.Use(Middleware(store, time.Hour, []string{"/api/forum/{slug}/create"}))
+
+	return router, &calls
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     request
+		retry     request
+		status    int
+		body      string
+		calls     int
+		replayed  bool
+		retryETag string
+	}{
+		{
+			name:      "retry is replayed",
+			first:     request{key: "k", body: "201"},
+			retry:     request{key: "k", body: "201"},
+			status:    http.StatusCreated,
+			body:      `{"call":1}`,
+			calls:     1,
+			replayed:  true,
+			retryETag: `"1"`,
+		},
+		{
+			name:   "key reused for another body",
+			first:  request{key: "k", body: "201"},
+			retry:  request{key: "k", body: "409"},
+			status: http.StatusUnprocessableEntity,
+			calls:  1,
+		},
+		{
+			name:   "key reused for another path",
+			first:  request{key: "k", body: "201"},
+			retry:  request{key: "k", body: "201", path: "/api/forum/g/create"},
+			status: http.StatusUnprocessableEntity,
+			calls:  1,
+		},
+		{
+			name:      "client errors are replayed",
+			first:     request{key: "k", body: "409"},
+			retry:     request{key: "k", body: "409"},
+			status:    http.StatusConflict,
+			body:      `{"call":1}`,
+			calls:     1,
+			replayed:  true,
+			retryETag: `"1"`,
+		},
+		{
+			name:      "server errors are retried",
+			first:     request{key: "k", body: "500"},
+			retry:     request{key: "k", body: "500"},
+			status:    http.StatusInternalServerError,
+			body:      `{"call":2}`,
+			calls:     2,
+			retryETag: `"2"`,
+		},
+		{
+			name:      "redirects are retried",
+			first:     request{key: "k", body: "308"},
+			retry:     request{key: "k", body: "308"},
+			status:    http.StatusPermanentRedirect,
+			body:      `{"call":2}`,
+			calls:     2,
+			retryETag: `"2"`,
+		},
+		{
+			name:      "keys are scoped to the caller",
+			first:     request{key: "k", caller: "Alice", body: "201"},
+			retry:     request{key: "k", caller: "bob", body: "201"},
+			status:    http.StatusCreated,
+			body:      `{"call":2}`,
+			calls:     2,
+			retryETag: `"2"`,
+		},
+		{
+			name:      "caller case does not matter",
+			first:     request{key: "k", caller: "Alice", body: "201"},
+			retry:     request{key: "k", caller: "alice", body: "201"},
+			status:    http.StatusCreated,
+			body:      `{"call":1}`,
+			calls:     1,
+			replayed:  true,
+			retryETag: `"1"`,
+		},
+		{
+			name:      "requests without a key",
+			first:     request{body: "201"},
+			retry:     request{body: "201"},
+			status:    http.StatusCreated,
+			body:      `{"call":2}`,
+			calls:     2,
+			retryETag: `"2"`,
+		},
+		{
+			name:   "routes without keys",
+			first:  request{key: "k", path: "/api/forum/f/details"},
+			retry:  request{key: "k", path: "/api/forum/f/details"},
+			status: http.StatusOK,
+			calls:  2,
+		},
+		{
+			name:   "key too long",
+			first:  request{key: strings.Repeat("k", maxKeyLength+1), body: "201"},
+			retry:  request{key: strings.Repeat("k", maxKeyLength+1), body: "201"},
+			status: http.StatusBadRequest,
+			calls:  0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, calls := newRouter(NewMemoryStore(1 << 20))
+
+			test.first.send(router)
+			retry := test.retry.send(router)
+
+			if retry.Code != test.status {
+				t.Errorf("retry status = %d, want %d", retry.Code, test.status)
+			}
+			if test.body != "" && retry.Body.String() != test.body {
+				t.Errorf("retry body = %s, want %s", retry.Body.String(), test.body)
+			}
+			if *calls != test.calls {
+				t.Errorf("handler ran %d times, want %d", *calls, test.calls)
+			}
+			if replayed := retry.Header().Get(ReplayedHeader) == "true"; replayed != test.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, test.replayed)
+			}
+			if etag := retry.Header().Get("ETag"); etag != test.retryETag {
+				t.Errorf("retry ETag = %q, want %q", etag, test.retryETag)
+			}
+			if test.replayed && retry.Header().Get("X-Request-Id") != "" {
+				t.Error("replay carries the request id of the first request")
+			}
+		})
+	}
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+	router, calls := newRouter(store)
+
+	if _, err := store.Begin(":k", requestHash(httptest.NewRequest(http.MethodPost, "/api/forum/f/create", nil), []byte("201")), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	retry := request{key: "k", body: "201"}.send(router)
+	if retry.Code != http.StatusConflict || *calls != 0 {
+		t.Errorf("status = %d after %d calls, want 409 without calling the handler", retry.Code, *calls)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore(1 << 20)
+
+	if claim, _ := store.Begin("k", "a", -time.Second); !claim.New {
+		t.Fatal("free key was not taken")
+	}
+
+	if claim, _ := store.Begin("k", "b", time.Hour); !claim.New || claim.Hash != "b" {
+		t.Errorf("expired key was not taken over: %+v", claim)
+	}
+
+	if claim, _ := store.Begin("k", "c", time.Hour); claim.New || claim.Hash != "b" {
+		t.Errorf("live key was taken over: %+v", claim)
+	}
+}
+
+func TestMemoryStoreBound(t *testing.T) {
+	body := make([]byte, 1000)
+	tests := []struct {
+		name     string
+		maxBytes int64
+		keys     int
+		kept     []string
+		gone     []string
+	}{
+		{"room for all", 1 << 20, 3, []string{"k0", "k1", "k2"}, nil},
+		{"oldest evicted", 3 * (entryOverhead + 1000 + 4), 5, []string{"k2", "k3", "k4"}, []string{"k0", "k1"}},
+		{"newest kept over the limit", 10, 2, []string{"k1"}, []string{"k0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryStore(test.maxBytes).(*memoryStore)
+
+			for i := 0; i < test.keys; i++ {
+				key := fmt.Sprintf("k%d", i)
+				store.Begin(key, "h", time.Hour)
+				store.Finish(key, Response{Status: http.StatusCreated, Body: body})
+			}
+
+			for _, key := range test.kept {
+				if e, ok := store.entries[key]; !ok || e.response == nil {
+					t.Errorf("%s was not kept with its response", key)
+				}
+			}
+			for _, key := range test.gone {
+				if _, ok := store.entries[key]; ok {
+					t.Errorf("%s was kept", key)
+				}
+			}
+
+			var size int64
+			for _, e := range store.entries {
+				size += e.size
+			}
+			if size != store.size || store.order.Len() != len(store.entries) {
+				t.Errorf("store accounts %d bytes in %d entries, holds %d in %d", store.size, store.order.Len(), size, len(store.entries))
+			}
+		})
+	}
+}
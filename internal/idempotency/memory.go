@@ -0,0 +1,137 @@
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// entryOverhead approximates the memory an entry takes besides its key, hash
+// and response, so that keys of requests without a body count as well.
+const entryOverhead = 256
+
+type entry struct {
+	key      string
+	hash     string
+	response *Response
+	expires  time.Time
+	size     int64
+	element  *list.Element
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	entries  map[string]*entry
+	order    *list.List
+	size     int64
+	maxBytes int64
+	swept    time.Time
+}
+
+// NewMemoryStore keeps the keys in the process, which is enough for a single
+// instance. The keys and responses kept take about maxBytes at most, the
+// oldest keys are forgotten first to make room for new ones.
+func NewMemoryStore(maxBytes int64) Store {
+	return &memoryStore{
+		entries:  make(map[string]*entry),
+		order:    list.New(),
+		maxBytes: maxBytes,
+		swept:    time.Now(),
+	}
+}
+
+func (m *memoryStore) Begin(key, hash string, ttl time.Duration) (Claim, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	if e, ok := m.entries[key]; ok {
+		if now.Before(e.expires) {
+			return Claim{Hash: e.hash, Response: e.response}, nil
+		}
+
+		m.remove(e)
+	}
+
+	e := &entry{key: key, hash: hash, expires: now.Add(ttl)}
+	e.element = m.order.PushBack(e)
+	m.entries[key] = e
+	m.resize(e, int64(entryOverhead+len(key)+len(hash)))
+
+	return Claim{New: true, Hash: hash}, nil
+}
+
+func (m *memoryStore) Finish(key string, response Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+
+	size := int64(entryOverhead + len(key) + len(e.hash) + len(response.Body))
+	for name, values := range response.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+
+	e.response = &response
+	m.resize(e, size)
+
+	return nil
+}
+
+func (m *memoryStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+
+	return nil
+}
+
+// resize accounts the entry at its new size and evicts the oldest other
+// entries while the store is over its limit. Keys all live for the same TTL,
+// so the oldest ones are the closest to expiring anyway.
+func (m *memoryStore) resize(e *entry, size int64) {
+	m.size += size - e.size
+	e.size = size
+
+	for element := m.order.Front(); element != nil && m.size > m.maxBytes; {
+		next := element.Next()
+		if oldest := element.Value.(*entry); oldest != e {
+			m.remove(oldest)
+		}
+		element = next
+	}
+}
+
+func (m *memoryStore) remove(e *entry) {
+	m.order.Remove(e.element)
+	delete(m.entries, e.key)
+	m.size -= e.size
+}
+
+// sweep forgets the expired keys.
+func (m *memoryStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+
+	for _, e := range m.entries {
+		if !now.Before(e.expires) {
+			m.remove(e)
+		}
+	}
+	m.swept = now
+}
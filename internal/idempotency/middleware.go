@@ -0,0 +1,176 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// ReplayedHeader marks responses stored for an earlier request.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// Middleware makes POST requests to the routes with the given path templates
+// safe to retry when they carry an Idempotency-Key header. Keys are scoped to
+// the caller. A retry gets the stored response, the key used for a different
+// request gets 422 and a retry racing the first request gets 409. Server
+// errors and redirects are not stored, so the request can be retried. The
+// store failing does not block requests.
+func Middleware(store Store, ttl time.Duration, routes []string) mux.MiddlewareFunc {
+	templates := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		templates[route] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || r.Method != http.MethodPost || !matches(r, templates) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxKeyLength {
+				writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Bad request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key = strings.ToLower(r.Header.Get("X-Nickname")) + ":" + key
+			hash := requestHash(r, body)
+
+			claim, err := store.Begin(key, hash, ttl)
+			if err != nil {
+				log.Printf("idempotency: %s", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !claim.New {
+				replay(w, claim, hash)
+				return
+			}
+
+			recorder := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			// Redirects aren't answers either, the request is retried at its
+			// new location.
+			if recorder.status >= http.StatusInternalServerError ||
+				recorder.status >= http.StatusMultipleChoices && recorder.status < http.StatusBadRequest {
+				err = store.Release(key)
+			} else {
+				err = store.Finish(key, Response{Status: recorder.status, Header: recorder.header, Body: recorder.body.Bytes()})
+			}
+			if err != nil {
+				log.Printf("idempotency: %s", err.Error())
+			}
+		})
+	}
+}
+
+func matches(r *http.Request, templates map[string]bool) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	template, err := route.GetPathTemplate()
+
+	return err == nil && templates[template]
+}
+
+// requestHash tells requests reusing a key apart from retries.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, claim Claim, hash string) {
+	switch {
+	case claim.Hash != hash:
+		writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+	case claim.Response == nil:
+		writeError(w, http.StatusConflict, "Request with this Idempotency-Key is in progress")
+	default:
+		for name, values := range claim.Response.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(claim.Response.Status)
+		w.Write(claim.Response.Body)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	body, err := json.Marshal(models.Error{Message: message})
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// recorder keeps a copy of the response passing through it.
+type recorder struct {
+	http.ResponseWriter
+	status  int
+	written bool
+	header  http.Header
+	body    bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.written {
+		r.status = status
+		r.keepHeader()
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.written {
+		r.keepHeader()
+	}
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
+
+// keepHeader copies the replayed headers as they are when the response
+// starts.
+func (r *recorder) keepHeader() {
+	r.written = true
+	r.header = make(http.Header)
+
+	for _, name := range replayedHeaders {
+		if values := r.ResponseWriter.Header().Values(name); len(values) > 0 {
+			r.header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+}
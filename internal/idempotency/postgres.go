@@ -0,0 +1,108 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+type postgresStore struct {
+	Conn *pgx.ConnPool
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// NewPostgresStore shares the keys between instances through the
+// idempotency_key table.
+func NewPostgresStore(conn *pgx.ConnPool) Store {
+	return &postgresStore{
+		Conn:  conn,
+		swept: time.Now(),
+	}
+}
+
+func (p *postgresStore) Begin(key, hash string, ttl time.Duration) (Claim, error) {
+	p.sweep()
+
+	// An expired key is taken over as if it were free.
+	var taken bool
+	err := p.Conn.QueryRow(
+		`INSERT INTO idempotency_key (key, hash, expires)
+		VALUES ($1, $2, NOW() + $3::DOUBLE PRECISION * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE
+		SET hash = EXCLUDED.hash, status = NULL, header = NULL, body = NULL, expires = EXCLUDED.expires
+		WHERE idempotency_key.expires <= NOW()
+		RETURNING TRUE`,
+		key,
+		hash,
+		ttl.Seconds(),
+	).Scan(&taken)
+	if err == nil {
+		return Claim{New: true, Hash: hash}, nil
+	}
+	if err != pgx.ErrNoRows {
+		return Claim{}, err
+	}
+
+	var claim Claim
+	var response Response
+	var header string
+	err = p.Conn.QueryRow(
+		`SELECT hash, COALESCE(status, 0), COALESCE(header::TEXT, '{}'), COALESCE(body, '') FROM idempotency_key WHERE key=$1`,
+		key,
+	).Scan(&claim.Hash, &response.Status, &header, &response.Body)
+	if err != nil {
+		return Claim{}, err
+	}
+
+	if response.Status != 0 {
+		if err := json.Unmarshal([]byte(header), &response.Header); err != nil {
+			return Claim{}, err
+		}
+		claim.Response = &response
+	}
+
+	return claim, nil
+}
+
+func (p *postgresStore) Finish(key string, response Response) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Conn.Exec(
+		`UPDATE idempotency_key SET status=$2, header=$3::JSONB, body=$4 WHERE key=$1`,
+		key,
+		response.Status,
+		string(header),
+		response.Body,
+	)
+
+	return err
+}
+
+func (p *postgresStore) Release(key string) error {
+	_, err := p.Conn.Exec(`DELETE FROM idempotency_key WHERE key=$1`, key)
+
+	return err
+}
+
+// sweep deletes the expired keys, at most once a sweepInterval per instance.
+func (p *postgresStore) sweep() {
+	p.mu.Lock()
+	if time.Since(p.swept) < sweepInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.swept = time.Now()
+	p.mu.Unlock()
+
+	if _, err := p.Conn.Exec(`DELETE FROM idempotency_key WHERE expires <= NOW()`); err != nil {
+		log.Printf("idempotency: %s", err.Error())
+	}
+}
@@ -0,0 +1,90 @@
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Renderer turns CommonMark messages into sanitized HTML. Rendered output is
+// kept in a bounded LRU cache keyed by the message content, so an edited
+// message never hits a stale entry.
+type Renderer struct {
+	markdown goldmark.Markdown
+	policy   *bluemonday.Policy
+
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[[sha256.Size]byte]*list.Element
+}
+
+type entry struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+func NewRenderer(capacity int) *Renderer {
+	return &Renderer{
+		markdown: goldmark.New(goldmark.WithExtensions(extension.Linkify)),
+		policy:   bluemonday.UGCPolicy().RequireNoFollowOnLinks(true).AddTargetBlankToFullyQualifiedLinks(true),
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+func (r *Renderer) Render(source string) string {
+	key := sha256.Sum256([]byte(source))
+
+	if html, ok := r.cached(key); ok {
+		return html
+	}
+
+	var buf bytes.Buffer
+	if err := r.markdown.Convert([]byte(source), &buf); err != nil {
+		return r.policy.Sanitize(source)
+	}
+
+	html := r.policy.SanitizeBytes(buf.Bytes())
+	r.store(key, string(html))
+
+	return string(html)
+}
+
+func (r *Renderer) cached(key [sha256.Size]byte) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	r.order.MoveToFront(element)
+
+	return element.Value.(*entry).html, true
+}
+
+func (r *Renderer) store(key [sha256.Size]byte, html string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.entries[key]; ok {
+		r.order.MoveToFront(element)
+		return
+	}
+
+	r.entries[key] = r.order.PushFront(&entry{key: key, html: html})
+
+	for r.capacity > 0 && r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*entry).key)
+	}
+}
@@ -0,0 +1,105 @@
+package markdown
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "script block",
+			source:   "<script>alert(1)</script>hi",
+			excludes: []string{"<script", "alert(1)"},
+		},
+		{
+			name:     "inline script",
+			source:   "text <script>alert(1)</script>",
+			excludes: []string{"<script"},
+		},
+		{
+			name:     "javascript link",
+			source:   "[x](javascript:alert(1))",
+			contains: []string{"x"},
+			excludes: []string{"javascript:", "href"},
+		},
+		{
+			name:     "javascript anchor",
+			source:   `**b** <a href="javascript:alert(1)">y</a>`,
+			contains: []string{"<strong>b</strong>"},
+			excludes: []string{"javascript:"},
+		},
+		{
+			name:     "event handler",
+			source:   `<img src=x onerror=alert(1)>`,
+			excludes: []string{"onerror"},
+		},
+		{
+			name:     "safe link",
+			source:   "[ok](https://example.com)",
+			contains: []string{`href="https://example.com"`, "nofollow", `target="_blank"`},
+		},
+		{
+			name:     "bare link",
+			source:   "see https://example.com",
+			contains: []string{`<a href="https://example.com"`},
+		},
+	}
+
+	r := NewRenderer(10)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			html := r.Render(test.source)
+
+			for _, want := range test.contains {
+				if !strings.Contains(html, want) {
+					t.Errorf("Render(%q) = %q, want it to contain %q", test.source, html, want)
+				}
+			}
+
+			for _, unwanted := range test.excludes {
+				if strings.Contains(html, unwanted) {
+					t.Errorf("Render(%q) = %q, want it without %q", test.source, html, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderCache(t *testing.T) {
+	r := NewRenderer(2)
+
+	first := r.Render("*a*")
+	if again := r.Render("*a*"); again != first {
+		t.Fatalf("cached Render = %q, want %q", again, first)
+	}
+
+	r.Render("*b*")
+	r.Render("*c*")
+
+	if len(r.entries) != 2 || r.order.Len() != 2 {
+		t.Fatalf("cache holds %d entries, want 2", len(r.entries))
+	}
+
+	if _, ok := r.entries[sha256.Sum256([]byte("*a*"))]; ok {
+		t.Error("least recently used entry was not evicted")
+	}
+}
+
+func TestRenderUnboundedCache(t *testing.T) {
+	r := NewRenderer(0)
+
+	for _, source := range []string{"a", "b", "c"} {
+		r.Render(source)
+	}
+
+	if len(r.entries) != 3 {
+		t.Fatalf("cache holds %d entries, want 3", len(r.entries))
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"encoding/json"
 
-	"github.com/google/uuid"
 	"github.com/jackc/pgx/pgtype"
 )
 
@@ -17,6 +16,7 @@ type User struct {
 	Email    string `json:"email"`
 	FullName string `json:"fullname"`
 	Nickname string `json:"nickname"`
+	Version  int    `json:"-"`
 }
 
 type Forum struct {
@@ -25,6 +25,17 @@ type Forum struct {
 	Slug    string `json:"slug"`
 	Posts   int    `json:"posts"`
 	Threads int    `json:"threads"`
+
+	Visibility string `json:"visibility,omitempty"`
+	Archived   bool   `json:"archived,omitempty"`
+
+	Parent       string `json:"parent,omitempty"`
+	Category     int    `json:"category,omitempty"`
+	Position     int    `json:"position,omitempty"`
+	TotalPosts   int    `json:"totalPosts,omitempty"`
+	TotalThreads int    `json:"totalThreads,omitempty"`
+	QA           bool   `json:"qa,omitempty"`
+	Version      int    `json:"-"`
 }
 
 type Thread struct {
@@ -36,6 +47,21 @@ type Thread struct {
 	Message string `json:"message"`
 	Slug    string `json:"slug"`
 	Votes   int    `json:"votes"`
+
+	Posts          int      `json:"posts"`
+	LastPostAt     string   `json:"lastPostAt,omitempty"`
+	LastPostAuthor string   `json:"lastPostAuthor,omitempty"`
+	Unread         *int     `json:"unread,omitempty"`
+	MessageHTML    string   `json:"messageHtml,omitempty"`
+	Locked         bool     `json:"locked,omitempty"`
+	Collapsed      bool     `json:"collapsed,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Poll           *Poll    `json:"poll,omitempty"`
+	Answer         int      `json:"answer,omitempty"`
+	Shadow         bool     `json:"-"`
+	// SlugGenerated marks slugs made by the server, which the API never shows.
+	SlugGenerated bool `json:"-"`
+	Version       int  `json:"-"`
 }
 
 type ThreadWithoutSlug struct {
@@ -46,6 +72,18 @@ type ThreadWithoutSlug struct {
 	Title   string `json:"title"`
 	Message string `json:"message"`
 	Votes   int    `json:"votes"`
+
+	Posts          int      `json:"posts"`
+	LastPostAt     string   `json:"lastPostAt,omitempty"`
+	LastPostAuthor string   `json:"lastPostAuthor,omitempty"`
+	Unread         *int     `json:"unread,omitempty"`
+	MessageHTML    string   `json:"messageHtml,omitempty"`
+	Locked         bool     `json:"locked,omitempty"`
+	Collapsed      bool     `json:"collapsed,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Poll           *Poll    `json:"poll,omitempty"`
+	Answer         int      `json:"answer,omitempty"`
+	Version        int      `json:"-"`
 }
 
 func ThreadToWithout(thread Thread) ThreadWithoutSlug {
@@ -57,19 +95,55 @@ func ThreadToWithout(thread Thread) ThreadWithoutSlug {
 		Title:   thread.Title,
 		Message: thread.Message,
 		Votes:   thread.Votes,
+
+		Posts:          thread.Posts,
+		LastPostAt:     thread.LastPostAt,
+		LastPostAuthor: thread.LastPostAuthor,
+		Unread:         thread.Unread,
+		MessageHTML:    thread.MessageHTML,
+		Locked:         thread.Locked,
+		Collapsed:      thread.Collapsed,
+		Tags:           thread.Tags,
+		Poll:           thread.Poll,
+		Answer:         thread.Answer,
+		Version:        thread.Version,
 	}
 }
 
+// ThreadWithPosts is a thread created together with its first posts.
+type ThreadWithPosts struct {
+	Thread Thread `json:"thread"`
+	Posts  []Post `json:"posts"`
+}
+
 type Post struct {
-	Id       int              `json:"id"`
-	Author   string           `json:"author"`
-	Created  string           `json:"created"`
-	Forum    string           `json:"forum"`
-	Message  string           `json:"message"`
-	IsEdited bool             `json:"isEdited"`
-	Parent   JsonNullInt      `json:"parent"`
-	Thread   int              `json:"thread"`
-	Path     pgtype.Int8Array `json:"-"`
+	Id        int              `json:"id"`
+	Author    string           `json:"author"`
+	Created   string           `json:"created"`
+	Forum     string           `json:"forum"`
+	Message   string           `json:"message"`
+	IsEdited  bool             `json:"isEdited"`
+	Parent    JsonNullInt      `json:"parent"`
+	Thread    int              `json:"thread"`
+	Path      pgtype.Int8Array `json:"-"`
+	Depth     int              `json:"depth"`
+	Children  int              `json:"childCount"`
+	Hidden    bool             `json:"hidden,omitempty"`
+	Collapsed bool             `json:"collapsed,omitempty"`
+	Shadow    bool             `json:"-"`
+	Version   int              `json:"-"`
+
+	MessageHTML string       `json:"messageHtml,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+type PostTreeParameters struct {
+	Depth  int
+	Limit  int
+	Since  int
+	Sort   string
+	Desc   bool
+	Viewer string
 }
 
 type JsonNullInt struct {
@@ -110,16 +184,30 @@ type QueryParameters struct {
 	Limit int
 	Since string
 	Desc  bool
+	Forum string
+	From  string
+	To    string
+	Sort  string
+	Tag   string
+	// Solved filters questions of Q&A forums by having an accepted answer.
+	Solved string
+
+	Viewer string
 }
 
-func IsUUID(value string) bool {
-	n := len(value)
+const (
+	ThreadSortCreated  = "created"
+	ThreadSortVotes    = "votes"
+	ThreadSortActivity = "activity"
+	ThreadSortPosts    = "posts"
+	ThreadSortHot      = "hot"
+)
 
-	if n > 36 || n < 32 {
-		return false
+func IsThreadSort(sort string) bool {
+	switch sort {
+	case "", ThreadSortCreated, ThreadSortVotes, ThreadSortActivity, ThreadSortPosts, ThreadSortHot:
+		return true
 	}
 
-	_, err := uuid.Parse(value)
-
-	return err == nil
+	return false
 }
@@ -0,0 +1,28 @@
+package models
+
+import "errors"
+
+type Attachment struct {
+	Id           int    `json:"id"`
+	Post         int    `json:"post"`
+	Name         string `json:"name"`
+	ContentType  string `json:"contentType"`
+	Size         int64  `json:"size"`
+	Created      string `json:"created"`
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnailUrl,omitempty"`
+
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+}
+
+// Upload is a file received for a post, before it is stored.
+type Upload struct {
+	Name string
+	Data []byte
+}
+
+var (
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrAttachmentType     = errors.New("attachment type is not allowed")
+)
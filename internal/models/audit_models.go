@@ -0,0 +1,28 @@
+package models
+
+import "encoding/json"
+
+type AuditEntry struct {
+	Id         int             `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetId   string          `json:"targetId"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestId  string          `json:"requestId"`
+	Created    string          `json:"created"`
+}
+
+// AuditFilter selects audit entries. Empty fields match everything, Since is
+// the id to list the entries before.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetId   string
+	From       string
+	To         string
+	Since      int
+	Limit      int
+}
@@ -0,0 +1,29 @@
+package models
+
+import "errors"
+
+// UserBlock keeps the blocked user from messaging, replying to or mentioning
+// the blocker. Blocked users are muted for the blocker as well.
+type UserBlock struct {
+	Blocker string `json:"blocker"`
+	Blocked string `json:"blocked"`
+	Created string `json:"created"`
+}
+
+// UserMute hides the content of the muted user from the muter only.
+type UserMute struct {
+	Muter   string `json:"muter"`
+	Muted   string `json:"muted"`
+	Created string `json:"created"`
+}
+
+const (
+	MuteModeCollapse = "collapse"
+	MuteModeOmit     = "omit"
+)
+
+func IsMuteMode(mode string) bool {
+	return mode == MuteModeCollapse || mode == MuteModeOmit
+}
+
+var ErrUserBlocked = errors.New("user has blocked you")
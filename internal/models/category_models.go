@@ -0,0 +1,36 @@
+package models
+
+import "errors"
+
+// Category groups forums and other categories. Posts and threads are rolled
+// up from the forums and categories below it.
+type Category struct {
+	Id       int    `json:"id"`
+	Title    string `json:"title"`
+	Parent   int    `json:"parent,omitempty"`
+	Position int    `json:"position"`
+	Posts    int    `json:"posts"`
+	Threads  int    `json:"threads"`
+
+	Categories []Category  `json:"categories,omitempty"`
+	Forums     []ForumNode `json:"forums,omitempty"`
+}
+
+// ForumNode is a forum of the category tree along with its sub-forums.
+type ForumNode struct {
+	Forum
+	Forums []ForumNode `json:"forums,omitempty"`
+}
+
+// ForumPlacement puts a forum into a category or under a parent forum, not
+// both. The zero placement makes the forum a top one outside categories.
+type ForumPlacement struct {
+	Category int    `json:"category"`
+	Parent   string `json:"parent"`
+	Position int    `json:"position"`
+}
+
+var (
+	ErrBadCategory  = errors.New("category title is required")
+	ErrBadPlacement = errors.New("bad category or parent")
+)
@@ -0,0 +1,33 @@
+package models
+
+import "errors"
+
+// Conversation is a direct conversation of two users or a small group one.
+// Unread is counted for the user listing the conversations.
+type Conversation struct {
+	Id            int      `json:"id"`
+	Title         string   `json:"title,omitempty"`
+	Direct        bool     `json:"direct"`
+	Members       []string `json:"members"`
+	CreatedBy     string   `json:"createdBy"`
+	Created       string   `json:"created"`
+	LastMessageAt string   `json:"lastMessageAt,omitempty"`
+	Messages      int      `json:"messages"`
+	Unread        int      `json:"unread"`
+}
+
+type ConversationMessage struct {
+	Id           int    `json:"id"`
+	Conversation int    `json:"conversation"`
+	Author       string `json:"author"`
+	Message      string `json:"message"`
+	Created      string `json:"created"`
+	IsEdited     bool   `json:"isEdited"`
+}
+
+var (
+	ErrBadConversation = errors.New("bad conversation members")
+	ErrNotParticipant  = errors.New("user is not a member of the conversation")
+
+	ErrMessageNotInConversation = errors.New("message is from different conversation")
+)
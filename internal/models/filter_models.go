@@ -0,0 +1,67 @@
+package models
+
+import "errors"
+
+const (
+	FilterKindWords     = "words"
+	FilterKindLinks     = "links"
+	FilterKindDuplicate = "duplicate"
+	FilterKindRegex     = "regex"
+)
+
+const (
+	FilterActionReject  = "reject"
+	FilterActionReplace = "replace"
+)
+
+// FilterRule checks incoming messages of a forum, or of every forum when the
+// forum is empty. Dry-run rules only record what they would have done.
+type FilterRule struct {
+	Id          int      `json:"id"`
+	Forum       string   `json:"forum,omitempty"`
+	Kind        string   `json:"kind"`
+	Action      string   `json:"action"`
+	Words       []string `json:"words,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+	// MaxLinks is the number of links allowed to users having fewer than
+	// NewUserPosts posts.
+	MaxLinks     int `json:"maxLinks,omitempty"`
+	NewUserPosts int `json:"newUserPosts,omitempty"`
+	// Window is the number of seconds a message may not be repeated for.
+	Window    int    `json:"window,omitempty"`
+	DryRun    bool   `json:"dryRun"`
+	CreatedBy string `json:"createdBy"`
+	Created   string `json:"created"`
+}
+
+type FilterHit struct {
+	Id      int    `json:"id"`
+	Rule    int    `json:"rule"`
+	Forum   string `json:"forum"`
+	Author  string `json:"author"`
+	Action  string `json:"action"`
+	DryRun  bool   `json:"dryRun"`
+	Excerpt string `json:"excerpt"`
+	Created string `json:"created"`
+}
+
+// FilterCheck is a message run through the filters without being posted.
+type FilterCheck struct {
+	Forum   string      `json:"forum"`
+	Author  string      `json:"author"`
+	Message string      `json:"message"`
+	Result  string      `json:"result"`
+	Reject  bool        `json:"reject"`
+	Hits    []FilterHit `json:"hits"`
+}
+
+type FilterError struct {
+	Rule FilterRule
+}
+
+func (e *FilterError) Error() string {
+	return "message rejected by content filter"
+}
+
+var ErrBadFilter = errors.New("bad filter rule")
@@ -0,0 +1,34 @@
+package models
+
+import "errors"
+
+const (
+	ForumSortPosts   = "posts"
+	ForumSortThreads = "threads"
+	ForumSortTitle   = "title"
+)
+
+func IsForumSort(sort string) bool {
+	switch sort {
+	case "", ForumSortPosts, ForumSortThreads, ForumSortTitle:
+		return true
+	}
+
+	return false
+}
+
+const (
+	// ForumDeleteCascade removes the forum with all its content.
+	ForumDeleteCascade = "cascade"
+	// ForumDeleteArchive keeps the content readable but takes no more writes.
+	ForumDeleteArchive = "archive"
+)
+
+func IsForumDeleteMode(mode string) bool {
+	return mode == ForumDeleteCascade || mode == ForumDeleteArchive
+}
+
+var (
+	ErrForumArchived = errors.New("forum is archived")
+	ErrBadDeleteMode = errors.New("unknown forum delete mode")
+)
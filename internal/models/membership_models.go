@@ -0,0 +1,75 @@
+package models
+
+import "errors"
+
+const (
+	ForumPublic = "public"
+	// ForumRestricted forums are readable by everyone, but only members post.
+	ForumRestricted = "restricted"
+	ForumPrivate    = "private"
+)
+
+func IsForumVisibility(visibility string) bool {
+	switch visibility {
+	case ForumPublic, ForumRestricted, ForumPrivate:
+		return true
+	}
+
+	return false
+}
+
+const (
+	MemberRoleOwner     = "owner"
+	MemberRoleModerator = "moderator"
+	MemberRoleMember    = "member"
+)
+
+type ForumMember struct {
+	Forum    string `json:"forum"`
+	Nickname string `json:"nickname"`
+	Role     string `json:"role"`
+	Joined   string `json:"joined"`
+}
+
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+type JoinRequest struct {
+	Id        int    `json:"id,omitempty"`
+	Forum     string `json:"forum"`
+	Nickname  string `json:"nickname"`
+	Message   string `json:"message,omitempty"`
+	Status    string `json:"status"`
+	Created   string `json:"created,omitempty"`
+	DecidedBy string `json:"decidedBy,omitempty"`
+	Decided   string `json:"decided,omitempty"`
+}
+
+type JoinDecision struct {
+	Approve bool   `json:"approve"`
+	Actor   string `json:"-"`
+}
+
+// Invitation lets whoever holds the token join the forum, or only the invited
+// user when the nickname is set. Zero MaxUses means unlimited uses.
+type Invitation struct {
+	Token     string `json:"token"`
+	Forum     string `json:"forum"`
+	Nickname  string `json:"nickname,omitempty"`
+	CreatedBy string `json:"createdBy"`
+	Expires   string `json:"expires,omitempty"`
+	MaxUses   int    `json:"maxUses"`
+	Uses      int    `json:"uses"`
+	Created   string `json:"created"`
+}
+
+var (
+	ErrForumPrivate       = errors.New("forum is private")
+	ErrNotMember          = errors.New("user is not a member of the forum")
+	ErrBadVisibility      = errors.New("unknown forum visibility")
+	ErrBadInvitation      = errors.New("invitation is invalid or expired")
+	ErrJoinRequestDecided = errors.New("join request is already decided")
+)
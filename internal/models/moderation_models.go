@@ -0,0 +1,103 @@
+package models
+
+import "errors"
+
+type Report struct {
+	Id         int    `json:"id"`
+	Reporter   string `json:"reporter"`
+	Forum      string `json:"forum"`
+	Thread     int    `json:"thread"`
+	Post       int    `json:"post,omitempty"`
+	Reason     string `json:"reason"`
+	Comment    string `json:"comment,omitempty"`
+	Status     string `json:"status"`
+	Created    string `json:"created"`
+	ResolvedBy string `json:"resolvedBy,omitempty"`
+	Resolved   string `json:"resolved,omitempty"`
+	Action     string `json:"action,omitempty"`
+}
+
+const (
+	ReportReasonSpam     = "spam"
+	ReportReasonAbuse    = "abuse"
+	ReportReasonOffTopic = "off_topic"
+	ReportReasonIllegal  = "illegal"
+	ReportReasonOther    = "other"
+)
+
+func IsReportReason(reason string) bool {
+	switch reason {
+	case ReportReasonSpam, ReportReasonAbuse, ReportReasonOffTopic, ReportReasonIllegal, ReportReasonOther:
+		return true
+	}
+
+	return false
+}
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusResolved  = "resolved"
+)
+
+const (
+	ModerationDismiss    = "dismiss"
+	ModerationHidePost   = "hide_post"
+	ModerationLockThread = "lock_thread"
+	ModerationBanAuthor  = "ban_author"
+)
+
+type ModerationAction struct {
+	Action    string `json:"action"`
+	Comment   string `json:"comment"`
+	Moderator string `json:"-"`
+}
+
+type ModerationLogEntry struct {
+	Id        int    `json:"id"`
+	Report    int    `json:"report,omitempty"`
+	Forum     string `json:"forum"`
+	Moderator string `json:"moderator"`
+	Action    string `json:"action"`
+	Target    string `json:"target"`
+	Comment   string `json:"comment,omitempty"`
+	Created   string `json:"created"`
+}
+
+// Ban forbids writes of the user in the forum, or everywhere when the forum
+// is empty. A shadow ban lets the user write, but the content stays visible to
+// the user only.
+type Ban struct {
+	Id        int    `json:"id"`
+	Nickname  string `json:"nickname"`
+	Forum     string `json:"forum,omitempty"`
+	Reason    string `json:"reason"`
+	Expires   string `json:"expires,omitempty"`
+	Shadow    bool   `json:"shadow"`
+	CreatedBy string `json:"createdBy"`
+	Created   string `json:"created"`
+}
+
+// BanError is returned by write use cases when the author is banned.
+type BanError struct {
+	Ban Ban
+}
+
+func (e *BanError) Error() string {
+	return "user is banned"
+}
+
+var (
+	ErrForbidden      = errors.New("forbidden")
+	ErrBadReport      = errors.New("report has no target or reason")
+	ErrBadAction      = errors.New("action is not applicable")
+	ErrReportResolved = errors.New("report is already resolved")
+	ErrThreadLocked   = errors.New("thread is locked")
+)
+
+type BanResponse struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Forum   string `json:"forum,omitempty"`
+	Expires string `json:"expires,omitempty"`
+}
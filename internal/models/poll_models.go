@@ -0,0 +1,37 @@
+package models
+
+import "errors"
+
+// Poll of a thread. Voters of anonymous polls are not disclosed, and MyChoice
+// holds the options picked by the user viewing the poll.
+type Poll struct {
+	Id        int          `json:"id"`
+	Thread    int          `json:"thread"`
+	Question  string       `json:"question"`
+	Multiple  bool         `json:"multiple"`
+	Anonymous bool         `json:"anonymous"`
+	Closes    string       `json:"closes,omitempty"`
+	Closed    bool         `json:"closed"`
+	CreatedBy string       `json:"createdBy"`
+	Created   string       `json:"created"`
+	Voters    int          `json:"voters"`
+	Options   []PollOption `json:"options"`
+	MyChoice  []int        `json:"myChoice,omitempty"`
+}
+
+type PollOption struct {
+	Id     int      `json:"id"`
+	Title  string   `json:"title"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+type PollVote struct {
+	Options []int `json:"options"`
+}
+
+var (
+	ErrBadPoll     = errors.New("bad poll")
+	ErrBadPollVote = errors.New("bad poll options")
+	ErrPollClosed  = errors.New("poll is closed")
+)
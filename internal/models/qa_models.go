@@ -0,0 +1,11 @@
+package models
+
+import "errors"
+
+// AcceptedAnswer marks the post as the answer to the question. The zero post
+// takes the acceptance back.
+type AcceptedAnswer struct {
+	Post int `json:"post"`
+}
+
+var ErrNotQAForum = errors.New("forum is not in Q&A mode")
@@ -0,0 +1,18 @@
+package models
+
+import "errors"
+
+const (
+	RenameKindForum  = "forum"
+	RenameKindThread = "thread"
+	RenameKindUser   = "user"
+)
+
+// Rename carries the new slug of a forum or thread or the new nickname of a
+// user.
+type Rename struct {
+	Slug     string `json:"slug,omitempty"`
+	Nickname string `json:"nickname,omitempty"`
+}
+
+var ErrBadName = errors.New("name is empty or contains slashes or spaces")
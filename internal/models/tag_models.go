@@ -0,0 +1,11 @@
+package models
+
+import "errors"
+
+// TagUsage is an entry of the tag directory of a forum.
+type TagUsage struct {
+	Tag     string `json:"tag"`
+	Threads int    `json:"threads"`
+}
+
+var ErrBadTags = errors.New("bad thread tags")
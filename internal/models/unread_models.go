@@ -0,0 +1,18 @@
+package models
+
+import "errors"
+
+type ReadMarker struct {
+	Nickname string `json:"nickname"`
+	Thread   int    `json:"thread"`
+	Post     int    `json:"post"`
+	Unread   int    `json:"unread"`
+}
+
+type UnreadThread struct {
+	Thread       Thread
+	LastReadPost int
+	Unread       int
+}
+
+var ErrPostNotInThread = errors.New("post is from different thread")
@@ -0,0 +1,7 @@
+package models
+
+import "errors"
+
+// ErrVersionMismatch fails an edit made against a version other than the
+// current one, see the If-Match header.
+var ErrVersionMismatch = errors.New("resource was changed since the given version")
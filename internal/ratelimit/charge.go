@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type authored struct {
+	Author string `json:"author"`
+}
+
+// BodyAuthors charges a token per object in the JSON body of the request,
+// from the IP bucket and from the bucket of the author of the object, so that
+// the user buckets follow the authors the objects are created for rather than
+// the X-Nickname header. Field names the top-level field holding the objects,
+// the body itself when empty, and may hold an object or an array of them.
+// Objects without an author are counted against the IP only. Bodies which
+// can't be read cost a token from the IP bucket and are left to the handler
+// to reject.
+func BodyAuthors(field string) func(r *http.Request) Charge {
+	return func(r *http.Request) Charge {
+		body, err := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return Charge{Tokens: 1}
+		}
+
+		raw := json.RawMessage(body)
+		if field != "" {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(body, &fields); err != nil {
+				return Charge{Tokens: 1}
+			}
+
+			var ok bool
+			if raw, ok = fields[field]; !ok || string(raw) == "null" {
+				return Charge{}
+			}
+		}
+
+		var objects []authored
+		if err := json.Unmarshal(raw, &objects); err != nil {
+			var object authored
+			if err := json.Unmarshal(raw, &object); err != nil {
+				return Charge{Tokens: 1}
+			}
+			objects = []authored{object}
+		}
+
+		charge := Charge{Tokens: len(objects), Users: make(map[string]int)}
+		for _, object := range objects {
+			if object.Author != "" {
+				charge.Users[strings.ToLower(object.Author)]++
+			}
+		}
+
+		return charge
+	}
+}
@@ -0,0 +1,235 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarikTri/dbms-term-proj/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// Group limits the requests matching its method and route. Callers are
+// limited per IP and, when they name themselves, per nickname as well. Groups
+// sharing a name share their buckets.
+type Group struct {
+	Name    string
+	Methods []string
+	// Prefix and Routes match the path template of the route, so that a
+	// variable can't be filled in to look like another route. Routes, when
+	// set, are the only templates matched.
+	Prefix  string
+	Routes  []string
+	PerIP   Limit
+	PerUser Limit
+	// Charge prices the requests, by default a token from the IP bucket and
+	// one from the bucket of the X-Nickname caller.
+	Charge func(r *http.Request) Charge
+	// Continue lets the later groups matching a request apply to it as well.
+	Continue bool
+}
+
+// Charge is what a request takes: Tokens from the IP bucket and, by
+// nickname, tokens from the user buckets.
+type Charge struct {
+	Tokens int
+	Users  map[string]int
+}
+
+func callerCharge(r *http.Request) Charge {
+	charge := Charge{Tokens: 1}
+	if nickname := r.Header.Get("X-Nickname"); nickname != "" {
+		charge.Users = map[string]int{strings.ToLower(nickname): 1}
+	}
+
+	return charge
+}
+
+// over reports whether the charge costs more than a full bucket of the group
+// and can't ever be taken.
+func (c Charge) over(group Group) bool {
+	if !group.PerIP.Unlimited() && c.Tokens > group.PerIP.Burst {
+		return true
+	}
+
+	if !group.PerUser.Unlimited() {
+		for _, tokens := range c.Users {
+			if tokens > group.PerUser.Burst {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (g Group) matches(request *http.Request, template string) bool {
+	if !strings.HasPrefix(template, g.Prefix) {
+		return false
+	}
+
+	if len(g.Routes) > 0 && !contains(g.Routes, template) {
+		return false
+	}
+
+	return len(g.Methods) == 0 || contains(g.Methods, request.Method)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routeTemplate is the path template of the route matched by the router, or
+// the path itself when there is none.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return r.URL.Path
+	}
+
+	return template
+}
+
+// Middleware applies the first group matching a request, and the groups after
+// it while they let the request continue. The store failing does not block
+// requests.
+func Middleware(store Store, groups []Group, trustForwardedFor bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			template := routeTemplate(r)
+			for _, group := range groups {
+				if !group.matches(r, template) {
+					continue
+				}
+
+				if !take(w, store, group, r, trustForwardedFor) {
+					return
+				}
+
+				if !group.Continue {
+					break
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// take takes the charge of the request from every bucket of the caller,
+// reports the tightest one in the headers and answers 429 when any of them is
+// empty. A charge over a full bucket is refused without taking anything, as
+// waiting would not let it through.
+func take(w http.ResponseWriter, store Store, group Group, r *http.Request, trustForwardedFor bool) bool {
+	charge := callerCharge(r)
+	if group.Charge != nil {
+		charge = group.Charge(r)
+	}
+
+	if charge.over(group) {
+		tooManyRequests(w, "Too many objects in one request")
+
+		return false
+	}
+
+	var results []Result
+
+	if charge.Tokens > 0 && !group.PerIP.Unlimited() {
+		ip := clientIP(r, trustForwardedFor)
+		result, err := store.Take(group.Name+":ip:"+ip, group.PerIP, charge.Tokens)
+		if err != nil {
+			log.Printf("rate limit: %s", err.Error())
+			return true
+		}
+		results = append(results, result)
+	}
+
+	if !group.PerUser.Unlimited() {
+		nicknames := make([]string, 0, len(charge.Users))
+		for nickname := range charge.Users {
+			nicknames = append(nicknames, nickname)
+		}
+		sort.Strings(nicknames)
+
+		for _, nickname := range nicknames {
+			result, err := store.Take(group.Name+":user:"+nickname, group.PerUser, charge.Users[nickname])
+			if err != nil {
+				log.Printf("rate limit: %s", err.Error())
+				return true
+			}
+			results = append(results, result)
+		}
+	}
+
+	if len(results) == 0 {
+		return true
+	}
+
+	tightest := results[0]
+	for _, result := range results[1:] {
+		if !result.Allowed && (tightest.Allowed || result.RetryAfter > tightest.RetryAfter) ||
+			result.Allowed && tightest.Allowed && result.Remaining < tightest.Remaining {
+			tightest = result
+		}
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(tightest.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.Reset)))
+
+	if tightest.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(tightest.RetryAfter)))
+	tooManyRequests(w, "Too many requests")
+
+	return false
+}
+
+func tooManyRequests(w http.ResponseWriter, message string) {
+	body, err := json.Marshal(models.Error{Message: message})
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write(body)
+}
+
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx"
+)
+
+// refill is the token count of the stored bucket topped up for the time
+// passed since its last update. $2 is the burst and $3 the rate.
+const refill = `LEAST($2, rate_limit.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit.updated) * $3)`
+
+type postgresStore struct {
+	Conn *pgx.ConnPool
+}
+
+// NewPostgresStore shares the buckets between instances through the
+// rate_limit table. The database clock is used, so instance clocks may drift.
+func NewPostgresStore(conn *pgx.ConnPool) Store {
+	return &postgresStore{
+		Conn: conn,
+	}
+}
+
+func (p *postgresStore) Take(key string, limit Limit, cost int) (Result, error) {
+	need := limit.tokens(cost)
+	var tokens float64
+	var allowed bool
+
+	err := p.Conn.QueryRow(
+		fmt.Sprintf(
+			`INSERT INTO rate_limit (key, tokens, updated, allowed)
+			VALUES ($1, $2::DOUBLE PRECISION - $4, NOW(), TRUE)
+			ON CONFLICT (key) DO UPDATE
+			SET tokens = %[1]s - CASE WHEN %[1]s >= $4 THEN $4 ELSE 0 END,
+				allowed = %[1]s >= $4,
+				updated = NOW()
+			RETURNING tokens, allowed`,
+			refill,
+		),
+		key,
+		float64(limit.Burst),
+		limit.Rate,
+		need,
+	).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(limit, tokens, need, allowed), nil
+}
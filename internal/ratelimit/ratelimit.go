@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second and holding at
+// most Burst tokens. The zero Limit does not limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// tokens is the cost of a request, at least a token. A cost over the burst is
+// never taken, the middleware rejects such requests before they get here.
+func (l Limit) tokens(cost int) float64 {
+	if cost < 1 {
+		cost = 1
+	}
+
+	return float64(cost)
+}
+
+// Result describes the bucket after a request took a token from it.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets by key and takes the cost of every request from
+// them, a token for most requests.
+type Store interface {
+	Take(key string, limit Limit, cost int) (Result, error)
+}
+
+// result derives the response of a bucket from the tokens left in it after a
+// request took the cost from it.
+func result(limit Limit, tokens, cost float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(math.Floor(tokens), 0)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+
+	if !allowed {
+		r.RetryAfter = seconds((cost - tokens) / limit.Rate)
+	}
+
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
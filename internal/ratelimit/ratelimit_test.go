@@ -0,0 +1,288 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// clock is a memory store time source moved by hand.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestStore() (*memoryStore, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore().(*memoryStore)
+	store.now = c.Now
+	store.swept = c.now
+
+	return store, c
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+
+	// Each step moves the clock, then takes the cost from the bucket.
+	steps := []struct {
+		after     time.Duration
+		cost      int
+		allowed   bool
+		remaining int
+	}{
+		{0, 1, true, 2},
+		{0, 1, true, 1},
+		{0, 1, true, 0},
+		{0, 1, false, 0},
+		{250 * time.Millisecond, 1, false, 0},
+		{250 * time.Millisecond, 1, true, 0},
+		{time.Second, 2, true, 0},
+		{10 * time.Second, 1, true, 2},
+		// A cost over the burst never passes.
+		{0, 5, false, 2},
+		{time.Second, 5, false, 3},
+	}
+
+	store, c := newTestStore()
+	for i, step := range steps {
+		c.now = c.now.Add(step.after)
+
+		result, err := store.Take("key", limit, step.cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Allowed != step.allowed || result.Remaining != step.remaining {
+			t.Errorf("step %d: allowed %v with %d left, want %v with %d",
+				i, result.Allowed, result.Remaining, step.allowed, step.remaining)
+		}
+	}
+}
+
+func TestMemoryStoreKeys(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 1}
+	store, _ := newTestStore()
+
+	for _, key := range []string{"a", "b"} {
+		if result, _ := store.Take(key, limit, 1); !result.Allowed {
+			t.Errorf("first request of %q was limited", key)
+		}
+	}
+
+	if result, _ := store.Take("a", limit, 1); result.Allowed {
+		t.Error("second request of a was allowed")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	store, c := newTestStore()
+
+	store.Take("a", limit, 1)
+	c.now = c.now.Add(sweepInterval)
+	store.Take("b", limit, 1)
+
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := store.buckets["b"]; !ok {
+		t.Error("bucket in use was swept")
+	}
+}
+
+func TestResult(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 10}
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		cost    float64
+		allowed bool
+		want    Result
+	}{
+		{
+			name:    "full",
+			tokens:  10,
+			cost:    1,
+			allowed: true,
+			want:    Result{Allowed: true, Limit: 10, Remaining: 10},
+		},
+		{
+			name:    "half",
+			tokens:  5.5,
+			cost:    1,
+			allowed: true,
+			want:    Result{Allowed: true, Limit: 10, Remaining: 5, Reset: 2250 * time.Millisecond},
+		},
+		{
+			name:   "empty",
+			tokens: 0.5,
+			cost:   1,
+			want:   Result{Limit: 10, Reset: 4750 * time.Millisecond, RetryAfter: 250 * time.Millisecond},
+		},
+		{
+			name:   "costly",
+			tokens: 1,
+			cost:   5,
+			want:   Result{Limit: 10, Remaining: 1, Reset: 4500 * time.Millisecond, RetryAfter: 2 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := result(limit, test.tokens, test.cost, test.allowed); got != test.want {
+				t.Errorf("result() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBodyAuthors(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  string
+		body   string
+		caller string
+		want   Charge
+	}{
+		{
+			name: "posts array",
+			body: `[{"author":"Alice"},{"author":"bob"},{"author":"alice"}]`,
+			want: Charge{Tokens: 3, Users: map[string]int{"alice": 2, "bob": 1}},
+		},
+		{
+			name:  "field with an object",
+			field: "thread",
+			body:  `{"thread":{"author":"Alice","title":"t"},"posts":[]}`,
+			want:  Charge{Tokens: 1, Users: map[string]int{"alice": 1}},
+		},
+		{
+			name:  "field with an array",
+			field: "posts",
+			body:  `{"thread":{"author":"a"},"posts":[{"author":"b"},{"author":"c"}]}`,
+			want:  Charge{Tokens: 2, Users: map[string]int{"b": 1, "c": 1}},
+		},
+		{
+			name:  "missing field",
+			field: "posts",
+			body:  `{"thread":{"author":"a"}}`,
+			want:  Charge{},
+		},
+		{
+			name:   "caller is not an author",
+			body:   `[{"author":"bob"},{"message":"m"}]`,
+			caller: "Carol",
+			want:   Charge{Tokens: 2, Users: map[string]int{"bob": 1}},
+		},
+		{
+			name:   "unreadable body",
+			body:   `not json`,
+			caller: "Carol",
+			want:   Charge{Tokens: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			if test.caller != "" {
+				request.Header.Set("X-Nickname", test.caller)
+			}
+
+			got := BodyAuthors(test.field)(request)
+			if got.Tokens != test.want.Tokens || len(got.Users) != len(test.want.Users) ||
+				len(got.Users) > 0 && !reflect.DeepEqual(got.Users, test.want.Users) {
+				t.Errorf("charge = %+v, want %+v", got, test.want)
+			}
+
+			rest, err := io.ReadAll(request.Body)
+			if err != nil || string(rest) != test.body {
+				t.Errorf("body left for the handler = %q, want %q", rest, test.body)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	groups := []Group{
+		{
+			Name:     "posts",
+			Methods:  []string{http.MethodPost},
+			Routes:   []string{"/api/forum/{slug}/create-with-posts"},
+			PerIP:    Limit{Rate: 0.001, Burst: 3},
+			Charge:   BodyAuthors("posts"),
+			Continue: true,
+		},
+		{
+			Name:    "threads",
+			Methods: []string{http.MethodPost},
+			Routes:  []string{"/api/forum/{slug}/create-with-posts"},
+			PerIP:   Limit{Rate: 0.001, Burst: 2},
+			Charge:  BodyAuthors("thread"),
+		},
+		{
+			Name:    "users",
+			Methods: []string{http.MethodPost},
+			Routes:  []string{"/api/forum/{slug}/create"},
+			PerUser: Limit{Rate: 0.001, Burst: 2},
+			Charge:  BodyAuthors(""),
+		},
+		{
+			Name:  "writes",
+			PerIP: Limit{Rate: 0.001, Burst: 1},
+		},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/forum/{slug}/create-with-posts", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/api/forum/{slug}/create", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/api/forum/create", func(w http.ResponseWriter, r *http.Request) {})
+	router.Use(Middleware(NewMemoryStore(), groups, false))
+
+	withPosts := `{"thread":{"author":"a"},"posts":[{"author":"a"},{"author":"a"}]}`
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		caller     string
+		want       int
+		retryAfter bool
+	}{
+		{"both buckets have room", "/api/forum/f/create-with-posts", withPosts, "", http.StatusOK, false},
+		{"posts bucket is short", "/api/forum/f/create-with-posts", withPosts, "", http.StatusTooManyRequests, true},
+		{"batch over the burst", "/api/forum/g/create-with-posts", `{"posts":[{},{},{},{}]}`, "", http.StatusTooManyRequests, false},
+		{"author is charged", "/api/forum/f/create", `[{"author":"bob"},{"author":"bob"}]`, "", http.StatusOK, false},
+		{"caller header is not", "/api/forum/f/create", `[{"author":"bob"}]`, "carol", http.StatusTooManyRequests, true},
+		{"template, not path, is matched", "/api/forum/create", `[{"author":"bob"}]`, "", http.StatusOK, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			if test.caller != "" {
+				request.Header.Set("X-Nickname", test.caller)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Errorf("status = %d, want %d", recorder.Code, test.want)
+			}
+
+			if retryAfter := recorder.Header().Get("Retry-After") != ""; retryAfter != test.retryAfter {
+				t.Errorf("Retry-After set = %v, want %v", retryAfter, test.retryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxLength bounds generated slugs so that a numeric suffix still fits.
+const MaxLength = 64
+
+// fallback is used for titles without a single usable letter or digit, and
+// as a prefix for all-digit slugs that would be taken for thread ids.
+const fallback = "thread"
+
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+}
+
+// Make builds a readable slug from the title: Cyrillic is transliterated,
+// letters are lowercased and every other run of characters becomes a dash.
+func Make(title string) string {
+	var builder strings.Builder
+	dash := false
+
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if dash && builder.Len() > 0 {
+			builder.WriteByte('-')
+		}
+		dash = false
+		builder.WriteString(s)
+	}
+
+	for _, r := range strings.ToLower(title) {
+		if latin, ok := cyrillic[r]; ok {
+			write(latin)
+			continue
+		}
+
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			write(string(r))
+			continue
+		}
+
+		dash = true
+	}
+
+	result := truncate(builder.String())
+	if result == "" {
+		return fallback
+	}
+
+	if strings.Trim(result, "0123456789") == "" {
+		return fallback + "-" + result
+	}
+
+	return result
+}
+
+// WithSuffix appends the uniqueness suffix to the slug.
+func WithSuffix(slug string, n int) string {
+	if n <= 1 {
+		return slug
+	}
+
+	return slug + "-" + strconv.Itoa(n)
+}
+
+// truncate cuts the slug to MaxLength at a word boundary when there is one.
+func truncate(slug string) string {
+	if len(slug) <= MaxLength {
+		return slug
+	}
+
+	slug = slug[:MaxLength]
+	if i := strings.LastIndexByte(slug, '-'); i > 0 {
+		slug = slug[:i]
+	}
+
+	return strings.TrimSuffix(slug, "-")
+}
@@ -0,0 +1,89 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Leading and trailing  ", "leading-and-trailing"},
+		{"Go 1.20 released", "go-1-20-released"},
+		{"Привет, мир", "privet-mir"},
+		{"Щука и ёж", "shchuka-i-ezh"},
+		{"Подъезд", "podezd"},
+		{"Mixed Привет world", "mixed-privet-world"},
+		{"", "thread"},
+		{"!!! ???", "thread"},
+		{"日本語", "thread"},
+		{"2024", "thread-2024"},
+		{"1 2 3", "1-2-3"},
+		{"42!", "thread-42"},
+	}
+
+	for _, test := range tests {
+		if got := Make(test.title); got != test.want {
+			t.Errorf("Make(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestMakeTruncates(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{
+			name:  "at a word boundary",
+			title: strings.Repeat("word ", 20),
+			want:  strings.TrimSuffix(strings.Repeat("word-", 12), "-"),
+		},
+		{
+			name:  "a single long word",
+			title: strings.Repeat("a", 100),
+			want:  strings.Repeat("a", MaxLength),
+		},
+		{
+			name:  "transliterated letters count",
+			title: strings.Repeat("щ", 20),
+			want:  strings.Repeat("shch", 16),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Make(test.title)
+			if got != test.want {
+				t.Errorf("Make(%q) = %q, want %q", test.title, got, test.want)
+			}
+
+			if len(got) > MaxLength || strings.HasSuffix(got, "-") {
+				t.Errorf("Make(%q) = %q, longer than %d or ending with a dash", test.title, got, MaxLength)
+			}
+		})
+	}
+}
+
+func TestWithSuffix(t *testing.T) {
+	tests := []struct {
+		slug string
+		n    int
+		want string
+	}{
+		{"title", 0, "title"},
+		{"title", 1, "title"},
+		{"title", 2, "title-2"},
+		{"thread-2024", 10, "thread-2024-10"},
+	}
+
+	for _, test := range tests {
+		if got := WithSuffix(test.slug, test.n); got != test.want {
+			t.Errorf("WithSuffix(%q, %d) = %q, want %q", test.slug, test.n, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encode(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	source := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			source.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, source); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// withDimensions rewrites the IHDR chunk of the PNG to declare other
+// dimensions, leaving the pixel data as it is.
+func withDimensions(data []byte, width, height uint32) []byte {
+	patched := append([]byte(nil), data...)
+
+	// The signature is followed by the IHDR length, type and data.
+	ihdr := patched[8+4 : 8+4+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:8], width)
+	binary.BigEndian.PutUint32(ihdr[8:12], height)
+	binary.BigEndian.PutUint32(patched[8+4+4+13:], crc32.ChecksumIEEE(ihdr))
+
+	return patched
+}
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		size          int
+		wantW, wantH  int
+	}{
+		{"landscape", 100, 50, 20, 20, 10},
+		{"portrait", 50, 100, 20, 10, 20},
+		{"square", 64, 64, 16, 16, 16},
+		{"already fits", 10, 5, 20, 10, 5},
+		{"thin line", 1000, 1, 10, 10, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			thumb, err := Make(encode(t, test.width, test.height), test.size, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if format != "png" || config.Width != test.wantW || config.Height != test.wantH {
+				t.Errorf("thumbnail is %s %dx%d, want png %dx%d", format, config.Width, config.Height, test.wantW, test.wantH)
+			}
+		})
+	}
+}
+
+func TestMakeRejects(t *testing.T) {
+	small := encode(t, 100, 50)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		want      error
+	}{
+		{"over the pixel limit", small, 4999, ErrTooLarge},
+		{"declared huge", withDimensions(small, 60000, 60000), 8192 * 8192, ErrTooLarge},
+		{"one huge side", withDimensions(small, 1<<30, 1), 8192 * 8192, ErrTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Make(test.data, 16, test.maxPixels); err != test.want {
+				t.Errorf("Make() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	if _, err := Make([]byte("not an image"), 16, 1<<20); err == nil {
+		t.Error("Make() of garbage succeeded")
+	}
+
+	if _, err := Make(small, 16, 5000); err != nil {
+		t.Errorf("Make() at the pixel limit: %v", err)
+	}
+}